@@ -118,6 +118,10 @@ func TestAll(t *testing.T) {
 					"a",
 					"",
 				},
+				[]string{
+					"aaaaaaaabbbbbbbbccccccccaaaaaaaabbbbbbbbcccccccc",
+					"xaaaaaaabbbbbbbbccccccccaaaaaaaabbbbbbbbccccccccdd",
+				},
 				[]string{
 					"SSenhor. – Eu nam escrevo a vos alteza per minha mão, porque, quando esta faço, tenho muito grande saluço, que he sinal de morrer: eu, senhor, deixo quá ese filho per minha memória, a que deixo toda minha fazemda, que he assaz de pouca, mas deixo lhe a obrigaçam de todos meus seruiços, que he mui grande: as cousas da india ellas falarám por mim e por elle: deixo a india com as principaes cabeças tomadas em voso poder, sem nela ficar outra pendença senam cerrar se e mui bem a porta do estreito;a isto he o que me vosa alteza encomendou: eu, senhor, vos dey sempre por comselho, pera segurar de lá india, irdes vos tirando de despesas: peçoa vos alteza por mercee que se lembre de tudo isto, e que me faça meu filho grande, e lhe dè toda satisfaçam de meu seruiço: todas minhas confianças pus nas mãs de vos alteza e da senhora Rainha, a elles m emcomemwdo, que façam mwinhas cousas grandes, pois acabo em cousas de voso seruiço, e por elles vollo tenho merecido; e as minhas tenças, as quaes comprey pela maior parte, como vossa alteza sabe, beijar lh ey as mãos pollas em meu filho: escrita no mar a 6 dias de dezembro de 1515. Afomso dalboquerqueL",
 					"Senhor. – Eu nam escrevo a vos alteza per minha mão, porque, quando esta faço, tenho muito grande saluço, que he sinal de morrer: eu, senhor, deixo quá ese filho per minha memória, a que deixo toda minha fazemda, que he assaz de pouca, mas deixo lhe a obrigaçam de todos meus seruiços, que he mui grande: as cousas da india ellas falarám por mim e por elle: deixo a india com as principaes cabeças tomadas em voso poder, sem nela ficar outra pendença senam cerrar se e mui bem a porta do estreito; isto he o que me vosa alteza encomendou: eu, senhor, vos dey sempre por comselho, pera segurar de lá india, irdes vos tirando de despesas: peçoa vos alteza por mercee que se lembre de tudo isto, e que me faça meu filho grande, e lhe dè toda satisfaçam de meu seruiço: todas minhas confianças pus nas mãs de vos alteza e da senhora Rainha, a elles m emcomemdo, que façam minhas cousas grandes, pois acabo em cousas de voso seruiço, e por elles vollo tenho merecido; e as minhas tenças, as quaes comprey pela maior parte, como vossa alteza sabe, beijar lh ey as mãos pollas em meu filho: escrita no mar a 6 dias de dezembro de 1515. Afomso dalboquerque",
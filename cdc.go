@@ -0,0 +1,242 @@
+package deltadiff
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/xrash/deltadiff/hasher"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"github.com/xrash/deltadiff/internal/chunker"
+	"io"
+	"io/ioutil"
+)
+
+// CDC_SIGNATURE_MAGIC begins signatures whose blocks were cut
+// by content. Fixed signatures begin with a hasher code, and
+// the code these two bytes would make is reserved, so one
+// can't be taken for the other.
+//
+// After the magic come the hasher code, the minimum, average
+// and maximum block sizes and the base size, 4 bytes each, and
+// then, until the end, each block's offset and length in base,
+// 4 bytes each, followed by its hash.
+const CDC_SIGNATURE_MAGIC = "DDCSIG01"
+
+// CDC_HEADER_SIZE is how many bytes come before the blocks.
+const CDC_HEADER_SIZE = len(CDC_SIGNATURE_MAGIC) + 2 + 4*4
+
+// cdcBlockSizes fills in the minimum and maximum block sizes
+// that weren't given.
+func cdcBlockSizes(min, avg, max int) (int, int) {
+	if min == 0 {
+		min = avg / 4
+	}
+
+	if max == 0 {
+		max = avg * 4
+	}
+
+	return min, max
+}
+
+// autoCDCBlockSize is AutoBlockSize rounded down to a power of
+// 2, as FastCDC needs.
+func autoCDCBlockSize(baseSize int) int {
+	blockSize := AutoBlockSize(baseSize)
+
+	avg := 1
+	for avg*2 <= blockSize {
+		avg *= 2
+	}
+
+	return avg
+}
+
+// cdcSignature is SignatureContext for c.CDC.
+func cdcSignature(ctx context.Context, base io.Reader, out io.Writer, c *SignatureConfig, h hasher.Hasher) error {
+	avg := c.BlockSize
+	if avg == 0 {
+		avg = autoCDCBlockSize(c.BaseSize)
+	}
+
+	min, max := cdcBlockSizes(c.MinBlockSize, avg, c.MaxBlockSize)
+
+	chunks, err := chunker.NewCDC(base, min, avg, max)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	w := binfmt.NewWriter(out)
+	w.Magic(CDC_SIGNATURE_MAGIC)
+	w.Raw(h.Code())
+	w.Uint32(uint32(min))
+	w.Uint32(uint32(avg))
+	w.Uint32(uint32(max))
+	w.Uint32(uint32(c.BaseSize))
+
+	offset := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			w.Flush()
+			return err
+		}
+
+		chunk, err := chunks.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		h.Reset()
+		hashed, err := h.Hash(chunk)
+		if err != nil {
+			return err
+		}
+
+		w.Uint32(uint32(offset))
+		w.Uint32(uint32(len(chunk)))
+		w.Raw(hashed)
+
+		offset += len(chunk)
+		c.Progress.report(PHASE_HASHING, int64(offset), int64(c.BaseSize))
+	}
+
+	if _, err := w.Flush(); err != nil {
+		return err
+	}
+
+	// Blocks must cover base exactly, or the signature can't
+	// be read.
+	if offset != c.BaseSize {
+		return fmt.Errorf("%w: base has %d bytes instead of BaseSize %d", ErrInvalidConfig, offset, c.BaseSize)
+	}
+
+	return nil
+}
+
+// readCDCHeader reads the header of a CDC signature, after the
+// first two bytes of the magic.
+func readCDCHeader(signature io.Reader) (*SignatureFile, hasher.Hasher, error) {
+	magic := make([]byte, len(CDC_SIGNATURE_MAGIC)-2)
+	if _, err := io.ReadFull(signature, magic); err != nil {
+		return nil, nil, truncated(err, ErrCorruptSignature, "it ends in the magic")
+	}
+
+	if string(magic) != CDC_SIGNATURE_MAGIC[2:] {
+		return nil, nil, fmt.Errorf("%w: bad magic %q", ErrCorruptSignature, CDC_SIGNATURE_MAGIC[:2]+string(magic))
+	}
+
+	hashcode, err := readHashCode(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sizes := make([]byte, 16)
+	if _, err := io.ReadFull(signature, sizes); err != nil {
+		return nil, nil, truncated(err, ErrCorruptSignature, "it ends in the block and base sizes")
+	}
+
+	min := int(binary.BigEndian.Uint32(sizes[0:4]))
+	avg := int(binary.BigEndian.Uint32(sizes[4:8]))
+	max := int(binary.BigEndian.Uint32(sizes[8:12]))
+	baseSize := int(binary.BigEndian.Uint32(sizes[12:16]))
+
+	if err := chunker.CheckCDC(min, avg, max); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrCorruptSignature, err)
+	}
+
+	h, name, err := lookupHasher(hashcode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &SignatureFile{
+		Hasher:       name,
+		BlockSize:    avg,
+		BaseSize:     baseSize,
+		CDC:          true,
+		MinBlockSize: min,
+		MaxBlockSize: max,
+	}, h, nil
+}
+
+// readCDCBlocks reads the blocks of a CDC signature, which must
+// follow each other from the beginning of base to its end.
+func (s *SignatureFile) readCDCBlocks(signature io.Reader, h hasher.Hasher) error {
+	data, err := ioutil.ReadAll(signature)
+	if err != nil {
+		return err
+	}
+
+	entrySize := 8 + h.HashSize()
+
+	if len(data)%entrySize != 0 {
+		n := len(data) / entrySize
+		return fmt.Errorf("%w: it ends in the middle of block %d, at offset %d", ErrCorruptSignature, n, CDC_HEADER_SIZE+n*entrySize)
+	}
+
+	blocks := make([][]byte, 0, len(data)/entrySize)
+	offsets := make([]int, 0, len(data)/entrySize+1)
+	end := 0
+
+	for i := 0; i < len(data); i += entrySize {
+		offset := int(binary.BigEndian.Uint32(data[i : i+4]))
+		length := int(binary.BigEndian.Uint32(data[i+4 : i+8]))
+
+		if offset != end {
+			return fmt.Errorf("%w: block %d begins at %d instead of %d", ErrCorruptSignature, len(blocks), offset, end)
+		}
+
+		if length == 0 || length > s.MaxBlockSize {
+			return fmt.Errorf("%w: block %d has %d bytes, more than %d or none", ErrCorruptSignature, len(blocks), length, s.MaxBlockSize)
+		}
+
+		blocks = append(blocks, data[i+8:i+entrySize:i+entrySize])
+		offsets = append(offsets, offset)
+		end = offset + length
+	}
+
+	// Like in fixed signatures, missing blocks mean it was cut
+	// short.
+	if end != s.BaseSize {
+		return fmt.Errorf("%w: its blocks cover %d bytes of base instead of %d", ErrCorruptSignature, end, s.BaseSize)
+	}
+
+	s.Blocks = blocks
+	s.Offsets = append(offsets, end)
+
+	return nil
+}
+
+// writeCDC is WriteTo for CDC signatures.
+func (s *SignatureFile) writeCDC(out io.Writer, h hasher.Hasher) (int64, error) {
+	if len(s.Offsets) != len(s.Blocks)+1 {
+		return 0, fmt.Errorf("Signature has %d offsets for %d blocks, must have one more", len(s.Offsets), len(s.Blocks))
+	}
+
+	for i, block := range s.Blocks {
+		if len(block) != h.HashSize() {
+			return 0, fmt.Errorf("Block %d has %d bytes instead of hash size %d", i, len(block), h.HashSize())
+		}
+	}
+
+	w := binfmt.NewWriter(out)
+	w.Magic(CDC_SIGNATURE_MAGIC)
+	w.Raw(h.Code())
+	w.Uint32(uint32(s.MinBlockSize))
+	w.Uint32(uint32(s.BlockSize))
+	w.Uint32(uint32(s.MaxBlockSize))
+	w.Uint32(uint32(s.BaseSize))
+
+	for i, block := range s.Blocks {
+		w.Uint32(uint32(s.Offsets[i]))
+		w.Uint32(uint32(s.Offsets[i+1] - s.Offsets[i]))
+		w.Raw(block)
+	}
+
+	return w.Flush()
+}
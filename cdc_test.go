@@ -0,0 +1,136 @@
+package deltadiff
+
+import (
+	"bytes"
+	"errors"
+	"github.com/franela/goblin"
+	"math/rand"
+	"testing"
+)
+
+func TestCDC(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("cdc signatures", func() {
+
+		base := make([]byte, 64<<10)
+		rand.New(rand.NewSource(1)).Read(base)
+
+		// An insertion near the start shifts everything after it.
+		shifted := append(append(append([]byte{}, base[:100]...), "inserted"...), base[100:]...)
+
+		sign := func(data []byte) []byte {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewReader(data), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 1024,
+				BaseSize:  len(data),
+				CDC:       true,
+			})
+			g.Assert(err).Equal(nil)
+
+			return signature.Bytes()
+		}
+
+		g.It("should cover base with blocks between the minimum and maximum sizes", func() {
+			sig, err := ReadSignatureFile(bytes.NewReader(sign(base)))
+			g.Assert(err).Equal(nil)
+			g.Assert(sig.CDC).IsTrue()
+			g.Assert(sig.BlockSize).Equal(1024)
+			g.Assert(sig.MinBlockSize).Equal(256)
+			g.Assert(sig.MaxBlockSize).Equal(4096)
+
+			end := 0
+			for i := range sig.Blocks {
+				from, to := sig.BlockBounds(i)
+				g.Assert(from).Equal(end)
+				g.Assert(to-from <= 4096).IsTrue()
+				end = to
+			}
+
+			g.Assert(end).Equal(len(base))
+			g.Assert(DetectFileKind(sign(base))).Equal(FileKindSignature)
+		})
+
+		g.It("should keep blocks after an insertion in base", func() {
+			before, err := ReadSignatureFile(bytes.NewReader(sign(base)))
+			g.Assert(err).Equal(nil)
+
+			after, err := ReadSignatureFile(bytes.NewReader(sign(shifted)))
+			g.Assert(err).Equal(nil)
+
+			hashes := make(map[string]bool)
+			for _, block := range before.Blocks {
+				hashes[string(block)] = true
+			}
+
+			kept := 0
+			for _, block := range after.Blocks {
+				if hashes[string(block)] {
+					kept++
+				}
+			}
+
+			g.Assert(kept >= len(after.Blocks)-2).IsTrue()
+		})
+
+		g.It("should make deltas that patch back into target", func() {
+			signature := sign(base)
+
+			delta := bytes.NewBuffer(nil)
+			err := Delta(bytes.NewReader(signature), bytes.NewReader(shifted), delta, &DeltaConfig{Checksum: true})
+			g.Assert(err).Equal(nil)
+			g.Assert(delta.Len() < 8<<10).IsTrue()
+
+			out := bytes.NewBuffer(nil)
+			err = Patch(bytes.NewReader(base), delta, out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.Bytes()).Equal(shifted)
+		})
+
+		g.It("should write back what it reads", func() {
+			signature := sign(base)
+
+			sig, err := ReadSignatureFile(bytes.NewReader(signature))
+			g.Assert(err).Equal(nil)
+
+			out := bytes.NewBuffer(nil)
+			n, err := sig.WriteTo(out)
+			g.Assert(err).Equal(nil)
+			g.Assert(int(n)).Equal(len(signature))
+			g.Assert(out.Bytes()).Equal(signature)
+		})
+
+		g.It("should refuse average sizes that aren't powers of 2", func() {
+			err := Signature(bytes.NewReader(base), bytes.NewBuffer(nil), &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 1000,
+				BaseSize:  len(base),
+				CDC:       true,
+			})
+			g.Assert(errors.Is(err, ErrInvalidConfig)).IsTrue()
+		})
+
+		g.It("should refuse blocks that don't follow each other", func() {
+			signature := sign(base)
+
+			// The offset of the second block.
+			corrupt := append([]byte{}, signature...)
+			corrupt[CDC_HEADER_SIZE+8+16+3]++
+
+			_, err := ReadSignatureFile(bytes.NewReader(corrupt))
+			g.Assert(errors.Is(err, ErrCorruptSignature)).IsTrue()
+		})
+
+		g.It("should refuse signatures cut short", func() {
+			signature := sign(base)
+
+			_, err := ReadSignatureFile(bytes.NewReader(signature[:len(signature)-24]))
+			g.Assert(errors.Is(err, ErrCorruptSignature)).IsTrue()
+
+			_, err = ReadSignatureFile(bytes.NewReader(signature[:CDC_HEADER_SIZE-1]))
+			g.Assert(errors.Is(err, ErrCorruptSignature)).IsTrue()
+		})
+	})
+}
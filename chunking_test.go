@@ -0,0 +1,108 @@
+package deltadiff
+
+import (
+	"bytes"
+	"github.com/franela/goblin"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestChunking(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("readers returning short reads", func() {
+
+		// 1800 bytes, so the last block of 64 is partial.
+		base := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 40)
+		target := "intro " + base[:700] + "a change" + base[720:] + " outro"
+
+		// Readers that return fewer bytes than asked for, or
+		// data along with io.EOF, all of which must give the
+		// same results as reading everything at once.
+		chunkers := map[string]func(io.Reader) io.Reader{
+			"one byte": iotest.OneByteReader,
+			"half":     iotest.HalfReader,
+			"data err": iotest.DataErrReader,
+		}
+
+		sign := func(base io.Reader, hasher string) []byte {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(base, signature, &SignatureConfig{
+				Hasher:    hasher,
+				BlockSize: 64,
+				BaseSize:  1800,
+			})
+			g.Assert(err).Equal(nil)
+
+			return signature.Bytes()
+		}
+
+		delta := func(signature, target io.Reader) []byte {
+			delta := bytes.NewBuffer(nil)
+			err := Delta(signature, target, delta, &DeltaConfig{Checksum: true})
+			g.Assert(err).Equal(nil)
+
+			return delta.Bytes()
+		}
+
+		g.It("should make the same signatures, deltas and patches", func() {
+			for _, hasher := range []string{"md5", "crc32", "polyroll"} {
+				signature := sign(strings.NewReader(base), hasher)
+				d := delta(bytes.NewReader(signature), strings.NewReader(target))
+
+				for _, chunker := range chunkers {
+					g.Assert(sign(chunker(strings.NewReader(base)), hasher)).Equal(signature)
+					g.Assert(delta(chunker(bytes.NewReader(signature)), chunker(strings.NewReader(target)))).Equal(d)
+
+					out := bytes.NewBuffer(nil)
+					err := Patch(chunker(strings.NewReader(base)), chunker(bytes.NewReader(d)), out)
+					g.Assert(err).Equal(nil)
+					g.Assert(out.String()).Equal(target)
+
+					ops, err := DecodeDelta(chunker(bytes.NewReader(d)))
+					g.Assert(err).Equal(nil)
+
+					encoded := bytes.NewBuffer(nil)
+					g.Assert(EncodeDelta(ops, encoded)).Equal(nil)
+					g.Assert(encoded.Bytes()).Equal(d)
+				}
+			}
+		})
+
+		g.It("should match the last block of base when it's partial", func() {
+			for _, hasher := range []string{"md5", "crc32", "polyroll"} {
+				signature := sign(strings.NewReader(base), hasher)
+				ops, err := DecodeDelta(bytes.NewReader(delta(bytes.NewReader(signature), strings.NewReader(base+" outro"))))
+				g.Assert(err).Equal(nil)
+
+				g.Assert(ops[0]).Equal(&ReadOp{From: 0, To: len(base)})
+				g.Assert(ops[1]).Equal(&WriteOp{Data: []byte(" outro")})
+			}
+		})
+
+		g.It("should keep zeros following the last block", func() {
+			// The last block used to be hashed padded with zeros,
+			// which matched here and lost the zeros.
+			base := "0123456789"
+			target := base + "\x00\x00zz"
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 4,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			d := delta(signature, strings.NewReader(target))
+
+			out := bytes.NewBuffer(nil)
+			err = Patch(strings.NewReader(base), bytes.NewReader(d), out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.String()).Equal(target)
+		})
+	})
+}
@@ -0,0 +1,407 @@
+// Package chunkstore stores files as chunks addressed by their
+// SHA-256, so chunks that files have in common, or that a file
+// has more than once, are only stored once. Each file has a
+// manifest listing its chunks, and chunks no manifest lists
+// anymore are removed by GC.
+//
+// A store is a directory holding manifests/, with a manifest
+// per file named after it, and chunks/, with the chunks spread
+// over subdirectories by the first byte of their digest. GC
+// must not run while files are being put.
+package chunkstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/internal/chunker"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DIGEST_SIZE = sha256.Size
+
+const (
+	// Chunks of ChunkSize bytes, like the blocks of a signature.
+	CHUNKING_FIXED = "fixed"
+
+	// Content-defined chunks of ChunkSize bytes on average,
+	// which keep matching when data is shifted.
+	CHUNKING_CDC = "cdc"
+)
+
+// Chunks are this size unless Config says otherwise.
+const DEFAULT_CHUNK_SIZE = 64 << 10
+
+// ErrNotFound means there's no file of that name in the store.
+var ErrNotFound = errors.New("File not found")
+
+type Config struct {
+	// Chunking is CHUNKING_FIXED, the default, or CHUNKING_CDC.
+	// Files put with different chunkings or sizes still share
+	// chunks, but hardly any.
+	Chunking string
+
+	// ChunkSize is the size of fixed chunks, or the average one
+	// of content-defined chunks, which are a quarter of it to
+	// four times it. DEFAULT_CHUNK_SIZE if it's 0.
+	ChunkSize int
+
+	// If Progress is not nil, it's called on every chunk that's
+	// put or got.
+	Progress deltadiff.ProgressFunc
+}
+
+type Store struct {
+	dir string
+	c   *Config
+}
+
+// PutResult describes a file that was put in a store.
+type PutResult struct {
+	Manifest *Manifest
+
+	// NewChunks and NewBytes are the chunks that weren't in the
+	// store yet, and their size.
+	NewChunks int
+	NewBytes  int64
+}
+
+// GCResult describes what GC removed.
+type GCResult struct {
+	Chunks int
+	Bytes  int64
+}
+
+// Open opens the store in dir, creating it if needed.
+func Open(dir string, c *Config) (*Store, error) {
+	s := &Store{
+		dir: dir,
+		c:   c,
+	}
+
+	if _, err := s.newChunker(bytes.NewReader(nil)); err != nil {
+		return nil, fmt.Errorf("%w: %v", deltadiff.ErrInvalidConfig, err)
+	}
+
+	for _, sub := range []string{"manifests", "chunks"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Store) newChunker(r io.Reader) (chunker.Chunker, error) {
+	size := s.c.ChunkSize
+	if size == 0 {
+		size = DEFAULT_CHUNK_SIZE
+	}
+
+	switch s.c.Chunking {
+	case "", CHUNKING_FIXED:
+		if size < 1 {
+			return nil, fmt.Errorf("Invalid chunk size %d", size)
+		}
+
+		return chunker.NewFixed(r, size), nil
+
+	case CHUNKING_CDC:
+		return chunker.NewCDC(r, size/4, size, size*4)
+	}
+
+	return nil, fmt.Errorf("Unknown chunking %s, must be %s or %s", s.c.Chunking, CHUNKING_FIXED, CHUNKING_CDC)
+}
+
+// Put stores content as the file name, replacing any file of
+// that name. Its chunks are all stored before its manifest, so
+// it's never listed without them.
+func (s *Store) Put(name string, content io.Reader) (*PutResult, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Files must have a name")
+	}
+
+	c, err := s.newChunker(content)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PutResult{
+		Manifest: &Manifest{
+			Name:   name,
+			Time:   time.Now(),
+			Chunks: make([]*ChunkRef, 0),
+		},
+	}
+
+	whole := sha256.New()
+
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		whole.Write(chunk)
+		digest := sha256.Sum256(chunk)
+
+		created, err := s.putChunk(digest[:], chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		if created {
+			result.NewChunks++
+			result.NewBytes += int64(len(chunk))
+		}
+
+		result.Manifest.Size += int64(len(chunk))
+		result.Manifest.Chunks = append(result.Manifest.Chunks, &ChunkRef{
+			Digest: digest[:],
+			Size:   len(chunk),
+		})
+
+		s.report(deltadiff.PHASE_HASHING, result.Manifest.Size, -1)
+	}
+
+	result.Manifest.Digest = whole.Sum(nil)
+
+	err = s.writeFile(s.manifestFilename(name), func(w io.Writer) error {
+		_, err := result.Manifest.WriteTo(w)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Store) report(phase string, done, total int64) {
+	if s.c.Progress != nil {
+		s.c.Progress(deltadiff.Progress{
+			Phase: phase,
+			Done:  done,
+			Total: total,
+		})
+	}
+}
+
+// putChunk stores chunk unless it's there already.
+func (s *Store) putChunk(digest, chunk []byte) (bool, error) {
+	filename := s.chunkFilename(digest)
+
+	if _, err := os.Stat(filename); err == nil {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return false, err
+	}
+
+	err := s.writeFile(filename, func(w io.Writer) error {
+		_, err := w.Write(chunk)
+		return err
+	})
+
+	return err == nil, err
+}
+
+// Get writes the file name to out. Every chunk is checked
+// against its digest before it's written, and the whole file
+// against its own at the end, failing with ErrChecksumMismatch.
+func (s *Store) Get(name string, out io.Writer) error {
+	m, err := s.Manifest(name)
+	if err != nil {
+		return err
+	}
+
+	whole := sha256.New()
+	done := int64(0)
+
+	for i, c := range m.Chunks {
+		chunk, err := ioutil.ReadFile(s.chunkFilename(c.Digest))
+		if err != nil {
+			return fmt.Errorf("Error reading chunk %d of %s: %w", i, name, err)
+		}
+
+		if digest := sha256.Sum256(chunk); !bytes.Equal(digest[:], c.Digest) || len(chunk) != c.Size {
+			return fmt.Errorf("%w: chunk %d of %s is corrupt", deltadiff.ErrChecksumMismatch, i, name)
+		}
+
+		whole.Write(chunk)
+
+		if _, err := out.Write(chunk); err != nil {
+			return err
+		}
+
+		done += int64(len(chunk))
+		s.report(deltadiff.PHASE_WRITING, done, m.Size)
+	}
+
+	if !bytes.Equal(whole.Sum(nil), m.Digest) {
+		return fmt.Errorf("%w: %s is %x, expected %x", deltadiff.ErrChecksumMismatch, name, whole.Sum(nil), m.Digest)
+	}
+
+	return nil
+}
+
+// Manifest returns the manifest of the file name.
+func (s *Store) Manifest(name string) (*Manifest, error) {
+	file, err := os.Open(s.manifestFilename(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadManifest(file)
+}
+
+// Manifests returns the manifests of every file in the store,
+// sorted by name.
+func (s *Store) Manifests() ([]*Manifest, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.dir, "manifests"))
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]*Manifest, 0, len(entries))
+
+	for _, entry := range entries {
+		name, err := url.PathUnescape(entry.Name())
+		if err != nil || isTemp(entry.Name()) {
+			continue
+		}
+
+		m, err := s.Manifest(name)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, m)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].Name < manifests[j].Name
+	})
+
+	return manifests, nil
+}
+
+// Remove removes the file name. Its chunks are only removed by
+// GC, once no other file uses them.
+func (s *Store) Remove(name string) error {
+	err := os.Remove(s.manifestFilename(name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return err
+}
+
+// GC removes the chunks no manifest lists, and temporary files
+// left behind by puts that didn't finish.
+func (s *Store) GC() (*GCResult, error) {
+	manifests, err := s.Manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, m := range manifests {
+		for _, c := range m.Chunks {
+			used[hex.EncodeToString(c.Digest)] = true
+		}
+	}
+
+	result := &GCResult{}
+
+	err = filepath.Walk(filepath.Join(s.dir, "chunks"), func(filename string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || used[info.Name()] {
+			return err
+		}
+
+		if err := os.Remove(filename); err != nil {
+			return err
+		}
+
+		if !isTemp(info.Name()) {
+			result.Chunks++
+			result.Bytes += info.Size()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	temps, _ := filepath.Glob(filepath.Join(s.dir, "manifests", ".tmp-*"))
+	for _, temp := range temps {
+		os.Remove(temp)
+	}
+
+	return result, nil
+}
+
+func (s *Store) chunkFilename(digest []byte) string {
+	name := hex.EncodeToString(digest)
+	return filepath.Join(s.dir, "chunks", name[:2], name)
+}
+
+// manifestFilename escapes name, so any name makes a single
+// file name, which doesn't begin with a dot either.
+func (s *Store) manifestFilename(name string) string {
+	escaped := url.PathEscape(name)
+	if strings.HasPrefix(escaped, ".") {
+		escaped = "%2E" + escaped[1:]
+	}
+
+	return filepath.Join(s.dir, "manifests", escaped)
+}
+
+// writeFile writes a file through a temporary one next to it,
+// so it's never seen half written.
+func (s *Store) writeFile(filename string, write func(w io.Writer) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(filename), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filename)
+}
+
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, ".tmp-")
+}
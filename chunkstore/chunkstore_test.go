@@ -0,0 +1,169 @@
+package chunkstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkStore(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("chunkstore", func() {
+
+		random := rand.New(rand.NewSource(47))
+
+		data := make([]byte, 300000)
+		random.Read(data)
+
+		// Shares most of data, shifted by a few bytes.
+		shifted := append([]byte("a new beginning"), data[:200000]...)
+
+		get := func(s *Store, name string) []byte {
+			out := bytes.NewBuffer(nil)
+			g.Assert(s.Get(name, out)).Equal(nil)
+			return out.Bytes()
+		}
+
+		g.It("should give back what was put", func() {
+			s, err := Open(t.TempDir(), &Config{})
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Put("data", bytes.NewReader(data))
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Put("../escaped/name", bytes.NewReader(shifted))
+			g.Assert(err).Equal(nil)
+
+			g.Assert(get(s, "data")).Equal(data)
+			g.Assert(get(s, "../escaped/name")).Equal(shifted)
+
+			manifests, err := s.Manifests()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(manifests)).Equal(2)
+			g.Assert(manifests[0].Name).Equal("../escaped/name")
+		})
+
+		g.It("should report progress on put and get", func() {
+			phases := make(map[string]deltadiff.Progress)
+
+			s, err := Open(t.TempDir(), &Config{
+				ChunkSize: 4096,
+				Progress: func(p deltadiff.Progress) {
+					phases[p.Phase] = p
+				},
+			})
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Put("data", bytes.NewReader(data))
+			g.Assert(err).Equal(nil)
+			g.Assert(phases[deltadiff.PHASE_HASHING].Done).Equal(int64(len(data)))
+
+			get(s, "data")
+			g.Assert(phases[deltadiff.PHASE_WRITING].Done).Equal(int64(len(data)))
+			g.Assert(phases[deltadiff.PHASE_WRITING].Total).Equal(int64(len(data)))
+		})
+
+		g.It("should store chunks files have in common once", func() {
+			s, err := Open(t.TempDir(), &Config{ChunkSize: 4096})
+			g.Assert(err).Equal(nil)
+
+			first, err := s.Put("first", bytes.NewReader(data))
+			g.Assert(err).Equal(nil)
+			g.Assert(first.NewBytes).Equal(int64(len(data)))
+
+			second, err := s.Put("second", bytes.NewReader(data[:100000]))
+			g.Assert(err).Equal(nil)
+			g.Assert(second.NewChunks).Equal(1)
+		})
+
+		g.It("should store shifted data once with content-defined chunks", func() {
+			s, err := Open(t.TempDir(), &Config{Chunking: CHUNKING_CDC, ChunkSize: 4096})
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Put("data", bytes.NewReader(data))
+			g.Assert(err).Equal(nil)
+
+			result, err := s.Put("shifted", bytes.NewReader(shifted))
+			g.Assert(err).Equal(nil)
+			g.Assert(result.NewBytes < 40000).IsTrue()
+
+			g.Assert(get(s, "shifted")).Equal(shifted)
+		})
+
+		g.It("should only collect chunks nothing uses", func() {
+			s, err := Open(t.TempDir(), &Config{ChunkSize: 4096})
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Put("data", bytes.NewReader(data))
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Put("part", bytes.NewReader(data[:100000]))
+			g.Assert(err).Equal(nil)
+
+			result, err := s.GC()
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Chunks).Equal(0)
+
+			g.Assert(s.Remove("data")).Equal(nil)
+
+			result, err = s.GC()
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Bytes).Equal(int64(len(data) - 98304))
+
+			g.Assert(get(s, "part")).Equal(data[:100000])
+
+			err = s.Get("data", ioutil.Discard)
+			g.Assert(errors.Is(err, ErrNotFound)).IsTrue()
+		})
+
+		g.It("should notice corrupt chunks", func() {
+			dir := t.TempDir()
+
+			s, err := Open(dir, &Config{})
+			g.Assert(err).Equal(nil)
+
+			put, err := s.Put("data", bytes.NewReader(data))
+			g.Assert(err).Equal(nil)
+
+			filename := s.chunkFilename(put.Manifest.Chunks[1].Digest)
+			chunk, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+
+			chunk[0] ^= 1
+			g.Assert(ioutil.WriteFile(filename, chunk, 0644)).Equal(nil)
+
+			err = s.Get("data", ioutil.Discard)
+			g.Assert(errors.Is(err, deltadiff.ErrChecksumMismatch)).IsTrue()
+		})
+
+		g.It("should keep names inside the store", func() {
+			dir := t.TempDir()
+
+			s, err := Open(filepath.Join(dir, "store"), &Config{})
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Put("..", bytes.NewReader([]byte("dots")))
+			g.Assert(err).Equal(nil)
+
+			entries, err := ioutil.ReadDir(dir)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(entries)).Equal(1)
+
+			_, err = os.Stat(filepath.Join(dir, "store", "manifests", "%2E."))
+			g.Assert(err).Equal(nil)
+		})
+
+		g.It("should reject chunkings it doesn't know", func() {
+			_, err := Open(t.TempDir(), &Config{Chunking: "other"})
+			g.Assert(errors.Is(err, deltadiff.ErrInvalidConfig)).IsTrue()
+		})
+	})
+}
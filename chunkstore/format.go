@@ -0,0 +1,75 @@
+package chunkstore
+
+import (
+	"fmt"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+	"time"
+)
+
+const MANIFEST_MAGIC = "DDCMAN01"
+
+// Manifest lists the chunks a file is made of.
+type Manifest struct {
+	Name string
+	Size int64
+
+	// Digest is the SHA-256 of the whole file.
+	Digest []byte
+
+	Time   time.Time
+	Chunks []*ChunkRef
+}
+
+// ChunkRef is a chunk of a file, addressed by its SHA-256.
+type ChunkRef struct {
+	Digest []byte
+	Size   int
+}
+
+func (m *Manifest) WriteTo(out io.Writer) (int64, error) {
+	w := binfmt.NewWriter(out)
+	w.Magic(MANIFEST_MAGIC)
+	w.String(m.Name)
+	w.Uint64(uint64(m.Size))
+	w.Bytes(m.Digest)
+	w.Uint64(uint64(m.Time.UnixNano()))
+	w.Uint32(uint32(len(m.Chunks)))
+
+	for _, c := range m.Chunks {
+		w.Raw(c.Digest)
+		w.Uint32(uint32(c.Size))
+	}
+
+	return w.Flush()
+}
+
+func ReadManifest(in io.Reader) (*Manifest, error) {
+	r := binfmt.NewReader(in)
+	r.Magic(MANIFEST_MAGIC)
+
+	m := &Manifest{
+		Name:   r.String(),
+		Size:   int64(r.Uint64()),
+		Digest: r.Bytes(),
+		Time:   time.Unix(0, int64(r.Uint64())),
+		Chunks: make([]*ChunkRef, 0),
+	}
+
+	count := r.Uint32()
+
+	for i := uint32(0); i < count && r.Err == nil; i++ {
+		c := &ChunkRef{
+			Digest: r.Fixed(DIGEST_SIZE),
+			Size:   int(r.Uint32()),
+		}
+
+		m.Chunks = append(m.Chunks, c)
+	}
+
+	if r.Err != nil {
+		return nil, fmt.Errorf("Error reading manifest: %v", r.Err)
+	}
+
+	return m, nil
+}
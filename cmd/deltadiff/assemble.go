@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff"
+	"io"
+	"os"
+)
+
+type AssembleCommand struct {
+	program *Program
+}
+
+func (ac *AssembleCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) > 2 {
+		fmt.Println("command assemble requires at most 2 args")
+		ac.program.Exit(1)
+	}
+
+	inputReader, err := ac.decideInputReader(args)
+	if err != nil {
+		fmt.Println(err)
+		ac.program.Exit(1)
+	}
+
+	deltaWriter, err := ac.decideDeltaWriter(args)
+	if err != nil {
+		fmt.Println(err)
+		ac.program.Exit(1)
+	}
+
+	if err := deltadiff.AssembleDelta(inputReader, deltaWriter); err != nil {
+		fmt.Println("Error", err)
+		ac.program.Exit(1)
+	}
+
+	ac.program.Exit(0)
+}
+
+func (p *Program) createAssembleCmd() *cobra.Command {
+
+	ac := &AssembleCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "assemble <input> <delta>",
+		Short: "Convert the text or JSON form of a delta back into a delta",
+		Long:  `Convert the text or JSON form of a delta, as produced by the dump command, back into a delta.`,
+		Run:   ac.Run,
+	}
+
+	return cmd
+}
+
+func (ac *AssembleCommand) decideInputReader(args []string) (io.Reader, error) {
+	if len(args) == 0 {
+		return os.Stdin, nil
+	}
+
+	if args[0] == "-" {
+		return os.Stdin, nil
+	}
+
+	filename := args[0]
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening input file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
+
+func (ac *AssembleCommand) decideDeltaWriter(args []string) (io.Writer, error) {
+	if len(args) == 0 || len(args) == 1 {
+		return os.Stdout, nil
+	}
+
+	filename := args[1]
+
+	if filename == "-" {
+		return os.Stdout, nil
+	}
+
+	file, err := ac.program.createOutput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening delta file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/chunkstore"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+type ChunkStorePutCommand struct {
+	program *Program
+
+	options struct {
+		name      string
+		chunking  string
+		chunkSize string
+	}
+}
+
+type ChunkStoreGetCommand struct {
+	program *Program
+}
+
+type ChunkStoreListCommand struct {
+	program *Program
+}
+
+type ChunkStoreRemoveCommand struct {
+	program *Program
+}
+
+type ChunkStoreGCCommand struct {
+	program *Program
+}
+
+func (p *Program) createChunkStoreCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "chunkstore",
+		Short: "Store files as deduplicated chunks",
+		Long:  `Store files as chunks addressed by their SHA-256, so chunks files have in common are only stored once. Each file has a manifest listing its chunks, and gc removes the chunks no file uses anymore.`,
+	}
+
+	cmd.AddCommand(p.createChunkStorePutCmd())
+	cmd.AddCommand(p.createChunkStoreGetCmd())
+	cmd.AddCommand(p.createChunkStoreListCmd())
+	cmd.AddCommand(p.createChunkStoreRemoveCmd())
+	cmd.AddCommand(p.createChunkStoreGCCmd())
+
+	return cmd
+}
+
+func (cc *ChunkStorePutCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("command chunkstore put requires 1 or 2 args")
+		cc.program.Exit(1)
+	}
+
+	c, err := cc.decideConfig()
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	s, err := openChunkStore(args[0], c)
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	content, name, err := cc.decideContentReader(args)
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	result, err := s.Put(name, content)
+	if err != nil {
+		fmt.Println("Error", err)
+		cc.program.Exit(1)
+	}
+
+	m := result.Manifest
+	fmt.Printf("Put %s, %d bytes in %d chunks, %d new chunks of %d bytes\n", m.Name, m.Size, len(m.Chunks), result.NewChunks, result.NewBytes)
+
+	cc.program.Exit(0)
+}
+
+func (p *Program) createChunkStorePutCmd() *cobra.Command {
+
+	cc := &ChunkStorePutCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "put <store> [file] [--name <name>]",
+		Short: "Put a file in a chunk store",
+		Long:  `Put the content of file, or of stdin, in a chunk store, named after the file unless --name is given, replacing any file of that name. The store is created if it doesn't exist.`,
+		Run:   cc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&cc.options.name,
+		"name",
+		"",
+		"",
+		"Name of the file in the store, required when reading stdin",
+	)
+
+	cmd.Flags().StringVarP(
+		&cc.options.chunking,
+		"chunking",
+		"",
+		chunkstore.CHUNKING_FIXED,
+		"How files are split, fixed for chunks of --chunk-size, or cdc for content-defined chunks of --chunk-size on average, which survive insertions",
+	)
+
+	cmd.Flags().StringVarP(
+		&cc.options.chunkSize,
+		"chunk-size",
+		"",
+		"64K",
+		"Size of the chunks, such as 64K, a power of 2 with cdc",
+	)
+
+	return cmd
+}
+
+func (cc *ChunkStorePutCommand) decideConfig() (*chunkstore.Config, error) {
+	size, ok := parseSize(cc.options.chunkSize)
+	if !ok || size > 1<<30 {
+		return nil, fmt.Errorf("Invalid chunk size %s, must be a positive number of bytes, optionally followed by K, M or G", cc.options.chunkSize)
+	}
+
+	return &chunkstore.Config{
+		Chunking:  cc.options.chunking,
+		ChunkSize: int(size),
+		Progress:  cc.program.progressFunc(),
+	}, nil
+}
+
+func (cc *ChunkStorePutCommand) decideContentReader(args []string) (io.Reader, string, error) {
+	if len(args) == 1 || args[1] == "-" {
+		if cc.options.name == "" {
+			return nil, "", fmt.Errorf("--name is required when reading stdin")
+		}
+
+		return os.Stdin, cc.options.name, nil
+	}
+
+	filename := args[1]
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error opening file %s: %v", filename, err)
+	}
+
+	name := cc.options.name
+	if name == "" {
+		name = filepath.Base(filename)
+	}
+
+	return file, name, nil
+}
+
+func (cc *ChunkStoreGetCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) < 2 || len(args) > 3 {
+		fmt.Println("command chunkstore get requires 2 or 3 args")
+		cc.program.Exit(1)
+	}
+
+	s, err := openChunkStore(args[0], &chunkstore.Config{Progress: cc.program.progressFunc()})
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	out, err := cc.decideOutputWriter(args)
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	w := bufio.NewWriter(out)
+
+	if err := s.Get(args[1], w); err != nil {
+		fmt.Println("Error", err)
+		cc.program.Exit(1)
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Println("Error", err)
+		cc.program.Exit(1)
+	}
+
+	cc.program.Exit(0)
+}
+
+func (p *Program) createChunkStoreGetCmd() *cobra.Command {
+
+	cc := &ChunkStoreGetCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "get <store> <name> [output]",
+		Short: "Get a file out of a chunk store",
+		Long:  `Write a file to output or to stdout. Every chunk is checked against its digest before it's written.`,
+		Run:   cc.Run,
+	}
+
+	return cmd
+}
+
+func (cc *ChunkStoreGetCommand) decideOutputWriter(args []string) (io.Writer, error) {
+	if len(args) == 2 || args[2] == "-" {
+		return os.Stdout, nil
+	}
+
+	filename := args[2]
+	file, err := cc.program.createOutput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening output file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
+
+func (cc *ChunkStoreListCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("command chunkstore list requires 1 arg")
+		cc.program.Exit(1)
+	}
+
+	s, err := openChunkStore(args[0], &chunkstore.Config{})
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	manifests, err := s.Manifests()
+	if err != nil {
+		fmt.Println("Error", err)
+		cc.program.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "name\ttime\tsize\tchunks\n")
+
+	for _, m := range manifests {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", m.Name, m.Time.Format(time.RFC3339), m.Size, len(m.Chunks))
+	}
+
+	w.Flush()
+	cc.program.Exit(0)
+}
+
+func (p *Program) createChunkStoreListCmd() *cobra.Command {
+
+	cc := &ChunkStoreListCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list <store>",
+		Short: "List the files in a chunk store",
+		Long:  `List the files in a chunk store, sorted by name.`,
+		Run:   cc.Run,
+	}
+
+	return cmd
+}
+
+func (cc *ChunkStoreRemoveCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 2 {
+		fmt.Println("command chunkstore rm requires 2 args")
+		cc.program.Exit(1)
+	}
+
+	s, err := openChunkStore(args[0], &chunkstore.Config{})
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	if err := s.Remove(args[1]); err != nil {
+		fmt.Println("Error", err)
+		cc.program.Exit(1)
+	}
+
+	cc.program.Exit(0)
+}
+
+func (p *Program) createChunkStoreRemoveCmd() *cobra.Command {
+
+	cc := &ChunkStoreRemoveCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "rm <store> <name>",
+		Short: "Remove a file from a chunk store",
+		Long:  `Remove a file from a chunk store. Its chunks are only removed by gc, once no other file uses them.`,
+		Run:   cc.Run,
+	}
+
+	return cmd
+}
+
+func (cc *ChunkStoreGCCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("command chunkstore gc requires 1 arg")
+		cc.program.Exit(1)
+	}
+
+	s, err := openChunkStore(args[0], &chunkstore.Config{})
+	if err != nil {
+		fmt.Println(err)
+		cc.program.Exit(1)
+	}
+
+	result, err := s.GC()
+	if err != nil {
+		fmt.Println("Error", err)
+		cc.program.Exit(1)
+	}
+
+	fmt.Printf("Removed %d chunks, %d bytes\n", result.Chunks, result.Bytes)
+
+	cc.program.Exit(0)
+}
+
+func (p *Program) createChunkStoreGCCmd() *cobra.Command {
+
+	cc := &ChunkStoreGCCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "gc <store>",
+		Short: "Remove the chunks no file uses",
+		Long:  `Remove the chunks no file uses anymore, after files were removed or replaced. It must not run while files are being put.`,
+		Run:   cc.Run,
+	}
+
+	return cmd
+}
+
+func openChunkStore(dir string, c *chunkstore.Config) (*chunkstore.Store, error) {
+	s, err := chunkstore.Open(dir, c)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening chunk store %s: %v", dir, err)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/xrash/deltadiff/deltacrypt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// decideKey turns the value of --encrypt-key and --decrypt-key
+// into a key: pass:<file> reads a passphrase from file, env:<var>
+// from an environment variable, and anything else is a file
+// holding a raw key, as 32 bytes or 64 hex digits.
+func decideKey(spec string) (*deltacrypt.Key, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	if name := strings.TrimPrefix(spec, "env:"); name != spec {
+		passphrase, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("Environment variable %s isn't set", name)
+		}
+
+		return deltacrypt.NewPassphrase([]byte(passphrase))
+	}
+
+	if filename := strings.TrimPrefix(spec, "pass:"); filename != spec {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading passphrase file %s: %v", filename, err)
+		}
+
+		return deltacrypt.NewPassphrase(bytes.TrimRight(data, "\r\n"))
+	}
+
+	data, err := ioutil.ReadFile(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading key file %s: %v", spec, err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 2*deltacrypt.KEY_SIZE {
+		if raw, err := hex.DecodeString(string(trimmed)); err == nil {
+			data = raw
+		}
+	}
+
+	return deltacrypt.NewKey(data)
+}
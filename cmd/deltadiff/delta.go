@@ -1,19 +1,37 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/deltacrypt"
+	"github.com/xrash/deltadiff/deltasign"
+	"github.com/xrash/deltadiff/gzipdiff"
+	"github.com/xrash/deltadiff/internal/localfile"
+	"github.com/xrash/deltadiff/tardiff"
+	"github.com/xrash/deltadiff/treediff"
 	"io"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 )
 
 type DeltaCommand struct {
 	program *Program
 
 	options struct {
-		debug     bool
-		debugFile string
+		debug       bool
+		debugFile   string
+		stats       bool
+		statsFormat string
+		checksum    bool
+		memoryLimit string
+		encryptKey  string
+		signKey     string
 	}
 }
 
@@ -35,34 +53,107 @@ func (dc *DeltaCommand) Run(cmd *cobra.Command, args []string) {
 		dc.program.Exit(1)
 	}
 
-	targetReader, err := dc.decideTargetReader(args)
+	deltaWriter, err := dc.decideDeltaWriter(args)
 	if err != nil {
 		fmt.Println(err)
 		dc.program.Exit(1)
 	}
 
-	deltaWriter, err := dc.decideDeltaWriter(args)
+	debugFile, err := dc.decideDebugFile(dc.options.debug, dc.options.debugFile)
 	if err != nil {
 		fmt.Println(err)
 		dc.program.Exit(1)
 	}
 
-	debugFile, err := dc.decideDebugFile(dc.options.debug, dc.options.debugFile)
+	memoryLimit, err := decideMemoryLimit(dc.options.memoryLimit)
+	if err != nil {
+		fmt.Println(err)
+		dc.program.Exit(1)
+	}
+
+	// What's written is counted here, outside of signing and
+	// encryption, for the stats to tell the size of the file.
+	counted := &localfile.CountingWriter{W: deltaWriter}
+	deltaWriter = counted
+
+	// Deltas of every kind are signed and encrypted as a whole,
+	// so it's done here rather than through DeltaConfig, which
+	// only plain deltas honour. Signing goes outside, so it can
+	// be checked without decrypting.
+	signed, err := dc.decideSigning(deltaWriter)
 	if err != nil {
 		fmt.Println(err)
 		dc.program.Exit(1)
 	}
 
+	if signed != nil {
+		deltaWriter = signed
+	}
+
+	encrypted, err := dc.decideEncryption(deltaWriter)
+	if err != nil {
+		fmt.Println(err)
+		dc.program.Exit(1)
+	}
+
+	if encrypted != nil {
+		deltaWriter = encrypted
+	}
+
 	c := &deltadiff.DeltaConfig{
 		Debug:       dc.options.debug,
 		DebugWriter: debugFile,
+		Progress:    dc.program.progressFunc(),
+		Checksum:    dc.options.checksum,
+		MemoryLimit: memoryLimit,
+	}
+
+	if dc.options.stats {
+		c.Stats = &deltadiff.DeltaStats{}
+	}
+
+	if isTreeSignature(signatureReader) {
+		err = treediff.Delta(signatureReader, args[1], deltaWriter, c)
+	} else {
+		var targetReader io.Reader
+
+		targetReader, err = dc.decideTargetReader(args)
+		if err != nil {
+			fmt.Println(err)
+			dc.program.Exit(1)
+		}
+
+		if isTarSignature(signatureReader) {
+			err = tardiff.Delta(signatureReader, targetReader, deltaWriter, c)
+		} else if isGzipSignature(signatureReader) {
+			err = dc.deltaGzip(signatureReader, targetReader, deltaWriter, c)
+		} else {
+			err = deltadiff.DeltaContext(dc.program.context(), signatureReader, targetReader, deltaWriter, c)
+		}
+	}
+
+	if err == nil && encrypted != nil {
+		err = encrypted.Close()
+	}
+
+	if err == nil && signed != nil {
+		err = signed.Close()
 	}
 
-	if err := deltadiff.Delta(signatureReader, targetReader, deltaWriter, c); err != nil {
+	if err != nil {
 		fmt.Println("Error", err)
 		dc.program.Exit(1)
 	}
 
+	if dc.options.stats {
+		c.Stats.SetDeltaSize(counted.N)
+
+		if err := dc.printStats(os.Stderr, c.Stats); err != nil {
+			fmt.Println(err)
+			dc.program.Exit(1)
+		}
+	}
+
 	dc.program.Exit(0)
 }
 
@@ -75,7 +166,7 @@ func (p *Program) createDeltaCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "delta <signature> <target> <delta>",
 		Short: "Produce delta of signature and target",
-		Long:  `Produce delta of signature and target`,
+		Long:  `Produce delta of signature and target. If signature was made with --recursive, target must be a directory.`,
 		Run:   dc.Run,
 	}
 
@@ -95,6 +186,54 @@ func (p *Program) createDeltaCmd() *cobra.Command {
 		"File to write debug information to",
 	)
 
+	cmd.Flags().BoolVarP(
+		&dc.options.stats,
+		"stats",
+		"",
+		false,
+		"If enabled, prints statistics about the delta to stderr",
+	)
+
+	cmd.Flags().StringVarP(
+		&dc.options.statsFormat,
+		"stats-format",
+		"",
+		"text",
+		"Format of the statistics, can be text or json",
+	)
+
+	cmd.Flags().BoolVarP(
+		&dc.options.checksum,
+		"checksum",
+		"",
+		false,
+		"If enabled, ends the delta with the checksum of target, which patch and verify check",
+	)
+
+	cmd.Flags().StringVarP(
+		&dc.options.memoryLimit,
+		"memory-limit",
+		"",
+		"",
+		"Roughly how much memory to use, such as 512M or 2G, larger targets are read from disk",
+	)
+
+	cmd.Flags().StringVarP(
+		&dc.options.encryptKey,
+		"encrypt-key",
+		"",
+		"",
+		"Encrypts the delta with the raw key in this file, or a passphrase with pass:<file> or env:<variable>",
+	)
+
+	cmd.Flags().StringVarP(
+		&dc.options.signKey,
+		"sign-key",
+		"",
+		"",
+		"Signs the delta with the private key in this file, see keygen",
+	)
+
 	return cmd
 }
 
@@ -107,7 +246,7 @@ func (dc *DeltaCommand) decideDebugFile(debug bool, debugFile string) (io.Writer
 		return os.Stderr, nil
 	}
 
-	file, err := os.Open(debugFile)
+	file, err := os.Create(debugFile)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening debug file %s: %v", debugFile, err)
 	}
@@ -115,14 +254,138 @@ func (dc *DeltaCommand) decideDebugFile(debug bool, debugFile string) (io.Writer
 	return file, nil
 }
 
-func (dc *DeltaCommand) decideSignatureReader(args []string) (io.Reader, error) {
+func (dc *DeltaCommand) decideEncryption(out io.Writer) (io.WriteCloser, error) {
+	key, err := decideKey(dc.options.encryptKey)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	return deltacrypt.NewWriter(out, key)
+}
+
+func (dc *DeltaCommand) decideSigning(out io.Writer) (io.WriteCloser, error) {
+	key, err := decideSignKey(dc.options.signKey)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	return deltasign.NewWriter(out, key)
+}
+
+func decideMemoryLimit(limit string) (int64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+
+	n, ok := parseSize(limit)
+	if !ok {
+		return 0, fmt.Errorf("Invalid memory limit %s, must be a positive number of bytes, optionally followed by K, M or G", limit)
+	}
+
+	return n, nil
+}
+
+// parseSize parses a positive number of bytes, optionally
+// followed by K, M or G, powers of 1024.
+func parseSize(size string) (int64, bool) {
+	if size == "" {
+		return 0, false
+	}
+
+	digits := size
+	multiplier := int64(1)
+
+	switch strings.ToUpper(size[len(size)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+
+	if multiplier > 1 {
+		digits = size[:len(size)-1]
+	}
+
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+
+	if n > math.MaxInt64/multiplier {
+		return 0, false
+	}
+
+	return n * multiplier, true
+}
+
+func (dc *DeltaCommand) printStats(out io.Writer, stats *deltadiff.DeltaStats) error {
+	switch dc.options.statsFormat {
+	case "json":
+		encoded, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "%s\n", encoded)
+
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "target size\t%d\n", stats.TargetSize)
+		fmt.Fprintf(w, "delta size\t%d\n", stats.DeltaSize)
+		fmt.Fprintf(w, "bytes copied from base\t%d\n", stats.BaseBytes)
+		fmt.Fprintf(w, "literal bytes\t%d\n", stats.LiteralBytes)
+		fmt.Fprintf(w, "read ops\t%d\n", stats.ReadOps)
+		fmt.Fprintf(w, "write ops\t%d\n", stats.WriteOps)
+		fmt.Fprintf(w, "matched blocks\t%d/%d\n", stats.MatchedBlocks, stats.TotalBlocks)
+		fmt.Fprintf(w, "compression ratio\t%.4f\n", stats.CompressionRatio)
+		fmt.Fprintf(w, "time\t%s\n", stats.Duration)
+		w.Flush()
+
+	default:
+		return fmt.Errorf("Unknown stats format %s, must be text or json", dc.options.statsFormat)
+	}
+
+	return nil
+}
+
+func (dc *DeltaCommand) decideSignatureReader(args []string) (*bufio.Reader, error) {
 	filename := args[0]
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening base file %s: %v", filename, err)
 	}
 
-	return file, nil
+	return bufio.NewReader(file), nil
+}
+
+func isTreeSignature(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(treediff.SIGNATURE_MAGIC))
+	return treediff.IsSignature(magic)
+}
+
+func (dc *DeltaCommand) deltaGzip(signature, target io.Reader, out io.Writer, c *deltadiff.DeltaConfig) error {
+	mode, err := gzipdiff.Delta(signature, target, out, c)
+	if err != nil {
+		return err
+	}
+
+	if mode == gzipdiff.MODE_RAW {
+		fmt.Fprintln(os.Stderr, "Couldn't diff the decompressed content, fell back to raw diffing, use --debug to see why")
+	}
+
+	return nil
+}
+
+func isGzipSignature(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(gzipdiff.SIGNATURE_MAGIC))
+	return gzipdiff.IsSignature(magic)
+}
+
+func isTarSignature(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(tardiff.SIGNATURE_MAGIC))
+	return tardiff.IsSignature(magic)
 }
 
 func (dc *DeltaCommand) decideTargetReader(args []string) (io.Reader, error) {
@@ -146,7 +409,7 @@ func (dc *DeltaCommand) decideDeltaWriter(args []string) (io.Writer, error) {
 		return os.Stdout, nil
 	}
 
-	file, err := os.Create(filename)
+	file, err := dc.program.createOutput(filename)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening delta file %s: %v", filename, err)
 	}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/franela/goblin"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("parseSize", func() {
+
+		g.It("should parse sizes with suffixes", func() {
+			sizes := map[string]int64{
+				"1":           1,
+				"64k":         64 << 10,
+				"64K":         64 << 10,
+				"2M":          2 << 20,
+				"3G":          3 << 30,
+				"8589934591G": 8589934591 << 30,
+			}
+
+			for size, expected := range sizes {
+				n, ok := parseSize(size)
+				g.Assert(ok).IsTrue()
+				g.Assert(n).Equal(expected)
+			}
+		})
+
+		g.It("should refuse sizes that aren't positive or don't fit", func() {
+			for _, size := range []string{"", "0", "-1", "G", "1T", "abc", "9999999999999G", "8589934592G", "9223372036854775808"} {
+				_, ok := parseSize(size)
+				g.Assert(ok).IsFalse()
+			}
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff"
+	"io"
+	"os"
+)
+
+type DumpCommand struct {
+	program *Program
+
+	options struct {
+		format string
+	}
+}
+
+func (dc *DumpCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) > 2 {
+		fmt.Println("command dump requires at most 2 args")
+		dc.program.Exit(1)
+	}
+
+	deltaReader, err := dc.decideDeltaReader(args)
+	if err != nil {
+		fmt.Println(err)
+		dc.program.Exit(1)
+	}
+
+	outputWriter, err := dc.decideOutputWriter(args)
+	if err != nil {
+		fmt.Println(err)
+		dc.program.Exit(1)
+	}
+
+	switch dc.options.format {
+	case "text":
+		err = deltadiff.DumpDeltaText(deltaReader, outputWriter)
+	case "json":
+		err = deltadiff.DumpDeltaJSON(deltaReader, outputWriter)
+	default:
+		err = fmt.Errorf("Unknown format %s, must be text or json", dc.options.format)
+	}
+
+	if err != nil {
+		fmt.Println("Error", err)
+		dc.program.Exit(1)
+	}
+
+	dc.program.Exit(0)
+}
+
+func (p *Program) createDumpCmd() *cobra.Command {
+
+	dc := &DumpCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "dump <delta> <output>",
+		Short: "Convert a delta into text or JSON",
+		Long:  `Convert a delta into text or JSON. The output can be turned back into a delta with the assemble command.`,
+		Run:   dc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&dc.options.format,
+		"format",
+		"",
+		"text",
+		"Output format, can be text or json",
+	)
+
+	return cmd
+}
+
+func (dc *DumpCommand) decideDeltaReader(args []string) (io.Reader, error) {
+	if len(args) == 0 {
+		return os.Stdin, nil
+	}
+
+	if args[0] == "-" {
+		return os.Stdin, nil
+	}
+
+	filename := args[0]
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening delta file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
+
+func (dc *DumpCommand) decideOutputWriter(args []string) (io.Writer, error) {
+	if len(args) == 0 || len(args) == 1 {
+		return os.Stdout, nil
+	}
+
+	filename := args[1]
+
+	if filename == "-" {
+		return os.Stdout, nil
+	}
+
+	file, err := dc.program.createOutput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening output file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
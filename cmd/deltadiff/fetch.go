@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/deltahttp"
+)
+
+type FetchCommand struct {
+	program *Program
+
+	options struct {
+		signature   string
+		checksum    string
+		memoryLimit string
+	}
+}
+
+func (fc *FetchCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 2 {
+		fmt.Println("command fetch requires 2 args")
+		fc.program.Exit(1)
+	}
+
+	checksum, err := fc.decideChecksum(fc.options.checksum)
+	if err != nil {
+		fmt.Println(err)
+		fc.program.Exit(1)
+	}
+
+	memoryLimit, err := decideMemoryLimit(fc.options.memoryLimit)
+	if err != nil {
+		fmt.Println(err)
+		fc.program.Exit(1)
+	}
+
+	c := &deltahttp.RangeConfig{
+		SignatureURL: fc.options.signature,
+		Checksum:     checksum,
+		MemoryLimit:  memoryLimit,
+		Progress:     fc.program.progressFunc(),
+	}
+
+	result, err := deltahttp.FetchRanges(fc.program.context(), args[0], args[1], c)
+	if err != nil {
+		fmt.Println("Error", err)
+		fc.program.Exit(1)
+	}
+
+	fmt.Printf("Fetched %s, %d bytes, reused %d bytes, downloaded %d bytes in %d requests\n", args[1], result.Size, result.ReusedBytes, result.DownloadedBytes, result.Requests)
+
+	fc.program.Exit(0)
+}
+
+func (p *Program) createFetchCmd() *cobra.Command {
+
+	fc := &FetchCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "fetch <url> <local-path>",
+		Short: "Fetch a file over HTTP, downloading only what the local copy lacks",
+		Long:  `Fetch a file over HTTP, from any server that supports range requests, downloading only what the local copy lacks. The signature of the file, made with the signature command, must be published next to it, at its URL followed by .sig unless --signature says otherwise. Blocks found in the local file are reused and the others are downloaded with range requests.`,
+		Run:   fc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&fc.options.signature,
+		"signature",
+		"",
+		"",
+		"URL of the signature of the file, its URL followed by .sig by default",
+	)
+
+	cmd.Flags().StringVarP(
+		&fc.options.checksum,
+		"checksum",
+		"",
+		"",
+		"SHA-256 of the file in hex, the local file is only replaced if the copy matches it",
+	)
+
+	cmd.Flags().StringVarP(
+		&fc.options.memoryLimit,
+		"memory-limit",
+		"",
+		"",
+		"Roughly how much memory to use, such as 512M or 2G, see the delta command",
+	)
+
+	return cmd
+}
+
+func (fc *FetchCommand) decideChecksum(checksum string) ([]byte, error) {
+	if checksum == "" {
+		return nil, nil
+	}
+
+	digest, err := hex.DecodeString(checksum)
+	if err != nil || len(digest) != 32 {
+		return nil, fmt.Errorf("Invalid checksum %s, must be a SHA-256 in hex", checksum)
+	}
+
+	return digest, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/hasher"
+	"os"
+	"text/tabwriter"
+)
+
+type HashersCommand struct {
+	program *Program
+}
+
+func (hc *HashersCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) > 0 {
+		fmt.Println("command hashers takes no args")
+		hc.program.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "name\tcode\thash size\n")
+
+	for _, info := range hasher.Hashers() {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", info.Name, info.Code, info.HashSize)
+	}
+
+	w.Flush()
+	hc.program.Exit(0)
+}
+
+func (p *Program) createHashersCmd() *cobra.Command {
+
+	hc := &HashersCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "hashers",
+		Short: "List the available hashers",
+		Long:  `List the available hashers, with the code written in signatures and the size of their hashes.`,
+		Run:   hc.Run,
+	}
+
+	return cmd
+}
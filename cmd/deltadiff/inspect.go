@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/gzipdiff"
+	"github.com/xrash/deltadiff/tardiff"
+	"github.com/xrash/deltadiff/treediff"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+)
+
+type InspectCommand struct {
+	program *Program
+
+	options struct {
+		summary bool
+	}
+}
+
+func (ic *InspectCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) > 1 {
+		fmt.Println("command inspect requires at most 1 arg")
+		ic.program.Exit(1)
+	}
+
+	inputReader, err := ic.decideInputReader(args)
+	if err != nil {
+		fmt.Println(err)
+		ic.program.Exit(1)
+	}
+
+	data, err := ioutil.ReadAll(inputReader)
+	if err != nil {
+		fmt.Println("Error reading input", err)
+		ic.program.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	switch {
+	case treediff.IsSignature(data):
+		err = ic.inspectTreeSignature(w, data)
+	case treediff.IsDelta(data):
+		err = ic.inspectTreeDelta(w, data)
+	case tardiff.IsSignature(data):
+		err = ic.inspectTarSignature(w, data)
+	case gzipdiff.IsSignature(data):
+		err = ic.inspectGzipSignature(w, data)
+	case gzipdiff.IsDelta(data):
+		err = ic.inspectGzipDelta(w, data)
+	default:
+		err = ic.inspectFile(w, data)
+	}
+
+	if err != nil {
+		fmt.Println("Error", err)
+		ic.program.Exit(1)
+	}
+
+	w.Flush()
+	ic.program.Exit(0)
+}
+
+func (p *Program) createInspectCmd() *cobra.Command {
+
+	ic := &InspectCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "inspect <file>",
+		Short: "Print the content of a signature or delta",
+		Long:  `Print the content of a signature or delta. The kind of file is detected automatically.`,
+		Run:   ic.Run,
+	}
+
+	cmd.Flags().BoolVarP(
+		&ic.options.summary,
+		"summary",
+		"",
+		false,
+		"If enabled, only prints the header and summary, without listing every block or op",
+	)
+
+	return cmd
+}
+
+func (ic *InspectCommand) inspectFile(w io.Writer, data []byte) error {
+	switch deltadiff.DetectFileKind(data) {
+	case deltadiff.FileKindSignature:
+		return ic.inspectSignature(w, data)
+	case deltadiff.FileKindDelta:
+		return ic.inspectDelta(w, data)
+	}
+
+	return fmt.Errorf("Input is neither a signature nor a delta")
+}
+
+func (ic *InspectCommand) inspectSignature(w io.Writer, data []byte) error {
+	sig, err := deltadiff.ReadSignatureFile(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "kind\tsignature\n")
+	fmt.Fprintf(w, "hasher\t%s\n", sig.Hasher)
+	if sig.CDC {
+		fmt.Fprintf(w, "chunking\tcdc\n")
+		fmt.Fprintf(w, "block size\t%d-%d, %d on average\n", sig.MinBlockSize, sig.MaxBlockSize, sig.BlockSize)
+	} else {
+		fmt.Fprintf(w, "block size\t%d\n", sig.BlockSize)
+	}
+
+	fmt.Fprintf(w, "base size\t%d\n", sig.BaseSize)
+	fmt.Fprintf(w, "blocks\t%d\n", len(sig.Blocks))
+	fmt.Fprintf(w, "signature size\t%d\n", len(data))
+
+	if ic.options.summary {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\n#\tbase\tlength\thash\n")
+
+	for i, block := range sig.Blocks {
+		from, to := sig.BlockBounds(i)
+		fmt.Fprintf(w, "%d\t%d-%d\t%d\t%s\n", i, from, to, to-from, hex.EncodeToString(block))
+	}
+
+	return nil
+}
+
+func (ic *InspectCommand) inspectDelta(w io.Writer, data []byte) error {
+	decoder := deltadiff.NewDeltaDecoder(bytes.NewReader(data))
+
+	var (
+		counts     deltadiff.OpCounts
+		readBytes  int
+		writeBytes int
+		output     int
+	)
+
+	if !ic.options.summary {
+		fmt.Fprintf(w, "#\toffset\top\tbase\tlength\toutput\n")
+	}
+
+	for i := 0; ; i++ {
+		offset := decoder.Offset()
+
+		op, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		base := "-"
+
+		switch op := op.(type) {
+		case *deltadiff.ReadOp:
+			readBytes += op.Len()
+			base = fmt.Sprintf("%d-%d", op.From, op.To)
+		case *deltadiff.WriteOp:
+			writeBytes += op.Len()
+		}
+
+		counts.Add(op)
+
+		if !ic.options.summary {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%d-%d\n", i, offset, op.Kind(), base, op.Len(), output, output+op.Len())
+		}
+
+		output += op.Len()
+	}
+
+	if !ic.options.summary {
+		fmt.Fprintf(w, "\n")
+	}
+
+	fmt.Fprintf(w, "kind\tdelta\n")
+	fmt.Fprintf(w, "ops\t%d\n", counts.Total())
+	fmt.Fprintf(w, "read ops\t%d\n", counts.Reads)
+	fmt.Fprintf(w, "write ops\t%d\n", counts.Writes)
+	fmt.Fprintf(w, "checksum ops\t%d\n", counts.Checksums)
+	fmt.Fprintf(w, "bytes read from base\t%d\n", readBytes)
+	fmt.Fprintf(w, "bytes written from delta\t%d\n", writeBytes)
+	fmt.Fprintf(w, "output size\t%d\n", output)
+	fmt.Fprintf(w, "delta size\t%d\n", len(data))
+
+	return nil
+}
+
+func (ic *InspectCommand) inspectTreeSignature(w io.Writer, data []byte) error {
+	s, err := treediff.ReadSignature(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	var files, dirs int
+	var size int64
+
+	for _, e := range s.Entries {
+		if e.Mode.IsDir() {
+			dirs++
+		} else {
+			files++
+			size += e.Size
+		}
+	}
+
+	fmt.Fprintf(w, "kind\ttree signature\n")
+	fmt.Fprintf(w, "files\t%d\n", files)
+	fmt.Fprintf(w, "directories\t%d\n", dirs)
+	fmt.Fprintf(w, "base size\t%d\n", size)
+	fmt.Fprintf(w, "signature size\t%d\n", len(data))
+
+	if ic.options.summary {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\nmode\tsize\tsha256\tpath\n")
+
+	for _, e := range s.Entries {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", e.Mode, e.Size, hex.EncodeToString(e.Digest), e.Path)
+	}
+
+	return nil
+}
+
+func (ic *InspectCommand) inspectTreeDelta(w io.Writer, data []byte) error {
+	d, err := treediff.ReadDelta(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	names := []string{"dir", "copy", "patch", "remove"}
+	counts := make([]int, len(names))
+
+	if !ic.options.summary {
+		fmt.Fprintf(w, "entry\tmode\tdelta\tpath\tfrom\n")
+	}
+
+	for _, e := range d.Entries {
+		counts[e.Kind]++
+
+		if !ic.options.summary {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", names[e.Kind], e.Mode, len(e.Delta), e.Path, e.From)
+		}
+	}
+
+	if !ic.options.summary {
+		fmt.Fprintf(w, "\n")
+	}
+
+	fmt.Fprintf(w, "kind\ttree delta\n")
+
+	for i, name := range names {
+		fmt.Fprintf(w, "%s entries\t%d\n", name, counts[i])
+	}
+
+	fmt.Fprintf(w, "delta size\t%d\n", len(data))
+
+	return nil
+}
+
+func (ic *InspectCommand) inspectTarSignature(w io.Writer, data []byte) error {
+	s, err := tardiff.ReadSignature(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "kind\ttar signature\n")
+	fmt.Fprintf(w, "members\t%d\n", len(s.Members))
+	fmt.Fprintf(w, "base size\t%d\n", s.BaseSize)
+	fmt.Fprintf(w, "signature size\t%d\n", len(data))
+
+	if ic.options.summary {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\nheader\tdata\tsize\tdiffable\tname\n")
+
+	for _, m := range s.Members {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%t\t%s\n", m.HeaderOffset, m.DataOffset, m.Size, m.Signature != nil, m.Name)
+	}
+
+	return nil
+}
+
+func (ic *InspectCommand) inspectGzipSignature(w io.Writer, data []byte) error {
+	s, err := gzipdiff.ReadSignature(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "kind\tgzip signature\n")
+	fmt.Fprintf(w, "base is gzip\t%t\n", s.Content != nil)
+	fmt.Fprintf(w, "raw signature size\t%d\n", len(s.Raw))
+	fmt.Fprintf(w, "content signature size\t%d\n", len(s.Content))
+	fmt.Fprintf(w, "signature size\t%d\n", len(data))
+
+	return nil
+}
+
+func (ic *InspectCommand) inspectGzipDelta(w io.Writer, data []byte) error {
+	d, err := gzipdiff.ReadDelta(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "kind\tgzip delta\n")
+	fmt.Fprintf(w, "mode\t%s\n", d.Mode)
+	fmt.Fprintf(w, "members\t%d\n", len(d.Members))
+	fmt.Fprintf(w, "target sha256\t%s\n", hex.EncodeToString(d.Digest))
+	fmt.Fprintf(w, "delta size\t%d\n", len(data))
+
+	if ic.options.summary || len(d.Members) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\n#\tlevel\tsize\tmtime\tos\tname\n")
+
+	for i, m := range d.Members {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%s\n", i, m.Level, m.Size, m.ModTime, m.OS, m.Name)
+	}
+
+	return nil
+}
+
+func (ic *InspectCommand) decideInputReader(args []string) (io.Reader, error) {
+	if len(args) == 0 {
+		return os.Stdin, nil
+	}
+
+	if args[0] == "-" {
+		return os.Stdin, nil
+	}
+
+	filename := args[0]
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
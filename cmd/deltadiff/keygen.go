@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/deltasign"
+	"os"
+)
+
+type KeygenCommand struct {
+	program *Program
+}
+
+func (kc *KeygenCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("command keygen requires 1 arg")
+		kc.program.Exit(1)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Println("Error", err)
+		kc.program.Exit(1)
+	}
+
+	filename := args[0]
+
+	if err := kc.writeKeyFile(filename, deltasign.MarshalPrivateKey(private), 0600); err != nil {
+		fmt.Println(err)
+		kc.program.Exit(1)
+	}
+
+	if err := kc.writeKeyFile(filename+".pub", deltasign.MarshalPublicKey(public), 0644); err != nil {
+		fmt.Println(err)
+		kc.program.Exit(1)
+	}
+
+	fmt.Printf("Wrote the private key to %s and the public key to %s.pub\n", filename, filename)
+
+	kc.program.Exit(0)
+}
+
+func (p *Program) createKeygenCmd() *cobra.Command {
+
+	kc := &KeygenCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "keygen <key>",
+		Short: "Generate a key pair to sign deltas with",
+		Long:  `Generate an ed25519 key pair to sign deltas with. The private key is written to key, which must not exist, and the public key to key.pub.`,
+		Run:   kc.Run,
+	}
+
+	return cmd
+}
+
+// writeKeyFile never overwrites a file, so an existing key
+// can't be lost.
+func (kc *KeygenCommand) writeKeyFile(filename string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("Error creating key file %s: %v", filename, err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("Error writing key file %s: %v", filename, err)
+	}
+
+	return file.Close()
+}
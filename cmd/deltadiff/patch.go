@@ -1,15 +1,24 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/deltacrypt"
+	"github.com/xrash/deltadiff/gzipdiff"
+	"github.com/xrash/deltadiff/treediff"
 	"io"
 	"os"
 )
 
 type PatchCommand struct {
 	program *Program
+
+	options struct {
+		decryptKey  string
+		trustedKeys []string
+	}
 }
 
 func (pc *PatchCommand) Run(cmd *cobra.Command, args []string) {
@@ -24,13 +33,29 @@ func (pc *PatchCommand) Run(cmd *cobra.Command, args []string) {
 		pc.program.Exit(1)
 	}
 
-	baseReader, err := pc.decideBaseReader(args)
+	deltaReader, err := pc.decideDeltaReader(args)
 	if err != nil {
 		fmt.Println(err)
 		pc.program.Exit(1)
 	}
 
-	deltaReader, err := pc.decideDeltaReader(args)
+	deltaReader, err = pc.program.decideVerification(deltaReader, pc.options.trustedKeys)
+	if err != nil {
+		fmt.Println(err)
+		pc.program.Exit(1)
+	}
+
+	deltaReader, err = decideDecryption(deltaReader, pc.options.decryptKey)
+	if err != nil {
+		fmt.Println(err)
+		pc.program.Exit(1)
+	}
+
+	if info, err := os.Stat(args[0]); err == nil && info.IsDir() {
+		pc.patchTree(args, deltaReader)
+	}
+
+	baseReader, err := pc.decideBaseReader(args)
 	if err != nil {
 		fmt.Println(err)
 		pc.program.Exit(1)
@@ -42,7 +67,17 @@ func (pc *PatchCommand) Run(cmd *cobra.Command, args []string) {
 		pc.program.Exit(1)
 	}
 
-	if err := deltadiff.Patch(baseReader, deltaReader, resultWriter); err != nil {
+	if isGzipDelta(deltaReader) {
+		err = gzipdiff.Patch(baseReader, deltaReader, resultWriter)
+	} else {
+		c := &deltadiff.PatchConfig{
+			Progress: pc.program.progressFunc(),
+		}
+
+		err = deltadiff.PatchWithConfig(pc.program.context(), baseReader, deltaReader, resultWriter, c)
+	}
+
+	if err != nil {
 		fmt.Println("Error", err)
 		pc.program.Exit(1)
 	}
@@ -59,13 +94,43 @@ func (p *Program) createPatchCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "patch <base> <delta> <result>",
 		Short: "Apply delta to base",
-		Long:  `Apply delta to base`,
+		Long:  `Apply delta to base. If base is a directory, the delta must be a tree delta and result is the directory where the target tree is rebuilt.`,
 		Run:   pc.Run,
 	}
 
+	cmd.Flags().StringVarP(
+		&pc.options.decryptKey,
+		"decrypt-key",
+		"",
+		"",
+		"Decrypts the delta with the raw key in this file, or a passphrase with pass:<file> or env:<variable>",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&pc.options.trustedKeys,
+		"trusted-key",
+		"",
+		nil,
+		"File of public keys, one of which must have signed the delta, can be given more than once",
+	)
+
 	return cmd
 }
 
+func (pc *PatchCommand) patchTree(args []string, deltaReader io.Reader) {
+	if len(args) != 3 || args[2] == "-" {
+		fmt.Println("command patch requires a result directory when base is a directory")
+		pc.program.Exit(1)
+	}
+
+	if err := treediff.PatchContext(pc.program.context(), args[0], deltaReader, args[2]); err != nil {
+		fmt.Println("Error", err)
+		pc.program.Exit(1)
+	}
+
+	pc.program.Exit(0)
+}
+
 func (pc *PatchCommand) decideBaseReader(args []string) (io.Reader, error) {
 	filename := args[0]
 	file, err := os.Open(filename)
@@ -76,14 +141,50 @@ func (pc *PatchCommand) decideBaseReader(args []string) (io.Reader, error) {
 	return file, nil
 }
 
-func (pc *PatchCommand) decideDeltaReader(args []string) (io.Reader, error) {
+func (pc *PatchCommand) decideDeltaReader(args []string) (*bufio.Reader, error) {
 	filename := args[1]
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening base file %s: %v", filename, err)
 	}
 
-	return file, nil
+	return bufio.NewReader(file), nil
+}
+
+// decideDecryption decrypts delta as it's read, if it's
+// encrypted, whatever its kind.
+func decideDecryption(delta *bufio.Reader, spec string) (*bufio.Reader, error) {
+	magic, _ := delta.Peek(len(deltacrypt.MAGIC))
+	encrypted := deltacrypt.IsEncrypted(magic)
+
+	if spec == "" {
+		if encrypted {
+			return nil, fmt.Errorf("Delta is encrypted, use --decrypt-key")
+		}
+
+		return delta, nil
+	}
+
+	if !encrypted {
+		return nil, fmt.Errorf("Delta isn't encrypted, but --decrypt-key was given")
+	}
+
+	key, err := decideKey(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := deltacrypt.NewReader(delta, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return bufio.NewReader(decrypted), nil
+}
+
+func isGzipDelta(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(gzipdiff.DELTA_MAGIC))
+	return gzipdiff.IsDelta(magic)
 }
 
 func (pc *PatchCommand) decideResultWriter(args []string) (io.Writer, error) {
@@ -97,7 +198,7 @@ func (pc *PatchCommand) decideResultWriter(args []string) (io.Writer, error) {
 		return os.Stdout, nil
 	}
 
-	file, err := os.Create(filename)
+	file, err := pc.program.createOutput(filename)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening result file %s: %v", filename, err)
 	}
@@ -1,11 +1,47 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 )
 
 type Program struct {
+	// ctx is canceled on interrupt, see context.
+	ctx context.Context
+
+	// cancelable is set to 1 once the running command takes
+	// ctx, so it stops on its own on interrupt.
+	cancelable int32
+
+	// exiting makes Exit run once, since an interrupt can call
+	// it while the command is exiting.
+	exiting sync.Mutex
+
+	// progress is set by the --progress flag, which all
+	// commands have.
+	progress bool
+	bar      *ProgressBar
+
+	// cleanups run on Exit, which skips deferred calls.
+	cleanups []func()
+
+	// outputs are put in place by Exit(0) and removed by any
+	// other exit.
+	outputs []*output
+}
+
+// output is a file being written in place of filename.
+type output struct {
+	file     *os.File
+	filename string
 }
 
 func NewProgram() *Program {
@@ -13,14 +49,46 @@ func NewProgram() *Program {
 }
 
 func (p *Program) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.ctx = ctx
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go p.handleInterrupt(interrupts, cancel)
+
 	rootCmd := p.createRootCmd()
 	signatureCmd := p.createSignatureCmd()
 	deltaCmd := p.createDeltaCmd()
 	patchCmd := p.createPatchCmd()
+	inspectCmd := p.createInspectCmd()
+	dumpCmd := p.createDumpCmd()
+	assembleCmd := p.createAssembleCmd()
+	hashersCmd := p.createHashersCmd()
+	verifyCmd := p.createVerifyCmd()
+	serveCmd := p.createServeCmd()
+	syncCmd := p.createSyncCmd()
+	fetchCmd := p.createFetchCmd()
+	storeCmd := p.createStoreCmd()
+	chunkStoreCmd := p.createChunkStoreCmd()
+	keygenCmd := p.createKeygenCmd()
+	signCmd := p.createSignCmd()
 
 	rootCmd.AddCommand(signatureCmd)
 	rootCmd.AddCommand(deltaCmd)
 	rootCmd.AddCommand(patchCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(dumpCmd)
+	rootCmd.AddCommand(assembleCmd)
+	rootCmd.AddCommand(hashersCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(fetchCmd)
+	rootCmd.AddCommand(storeCmd)
+	rootCmd.AddCommand(chunkStoreCmd)
+	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(signCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -30,6 +98,157 @@ func (p *Program) Run() {
 	p.Exit(0)
 }
 
+// context returns a context that's canceled on interrupt, for
+// the running command to stop early, leaving output that can't
+// be mistaken for a complete one. Commands that don't take it
+// are stopped by the interrupt instead.
+func (p *Program) context() context.Context {
+	atomic.StoreInt32(&p.cancelable, 1)
+	return p.ctx
+}
+
+// handleInterrupt cancels ctx on the first interrupt, and exits
+// unless the running command took ctx to stop on its own. The
+// interrupts after that kill the process, in case it doesn't.
+func (p *Program) handleInterrupt(interrupts chan os.Signal, cancel func()) {
+	<-interrupts
+	signal.Stop(interrupts)
+	cancel()
+
+	if atomic.LoadInt32(&p.cancelable) == 0 {
+		fmt.Println("Interrupted")
+		p.Exit(130)
+	}
+}
+
+// progressFunc returns the callback that draws the progress
+// bar, or nil when --progress isn't set.
+func (p *Program) progressFunc() deltadiff.ProgressFunc {
+	if !p.progress {
+		return nil
+	}
+
+	if p.bar == nil {
+		p.bar = NewProgressBar(os.Stderr)
+	}
+
+	return p.bar.Update
+}
+
+// progressReader shows reading file on the progress bar, for
+// commands whose work goes as fast as their input is read.
+func (p *Program) progressReader(file *os.File) io.Reader {
+	f := p.progressFunc()
+	if f == nil {
+		return file
+	}
+
+	total := int64(-1)
+	if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+		total = info.Size()
+	}
+
+	return &progressReader{
+		r:        file,
+		total:    total,
+		progress: f,
+	}
+}
+
+// progressReader reports what's read through it as
+// PHASE_READING.
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress deltadiff.ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.done += int64(n)
+
+	r.progress(deltadiff.Progress{
+		Phase: deltadiff.PHASE_READING,
+		Done:  r.done,
+		Total: r.total,
+	})
+
+	return n, err
+}
+
+// atExit makes f run on Exit.
+func (p *Program) atExit(f func()) {
+	p.cleanups = append(p.cleanups, f)
+}
+
+// createOutput returns a temporary file next to filename for
+// a command to write its output to. It only replaces filename
+// when the command exits with 0, so an interrupted or failed
+// command never leaves output that looks complete.
+func (p *Program) createOutput(filename string) (io.Writer, error) {
+	file, err := ioutil.TempFile(filepath.Dir(filename), ".deltadiff-")
+	if err != nil {
+		return nil, err
+	}
+
+	p.outputs = append(p.outputs, &output{
+		file:     file,
+		filename: filename,
+	})
+
+	return file, nil
+}
+
+// commitOutputs renames every output to its filename, keeping
+// the permissions of the file it replaces.
+func (p *Program) commitOutputs() error {
+	for _, o := range p.outputs {
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(o.filename); err == nil {
+			mode = info.Mode().Perm()
+		}
+
+		if err := o.file.Chmod(mode); err != nil {
+			return fmt.Errorf("Error writing %s: %v", o.filename, err)
+		}
+
+		if err := o.file.Close(); err != nil {
+			return fmt.Errorf("Error writing %s: %v", o.filename, err)
+		}
+
+		if err := os.Rename(o.file.Name(), o.filename); err != nil {
+			return fmt.Errorf("Error writing %s: %v", o.filename, err)
+		}
+	}
+
+	return nil
+}
+
 func (p *Program) Exit(code int) {
+	// Never unlocked, the process ends here.
+	p.exiting.Lock()
+
+	if p.bar != nil {
+		p.bar.Finish()
+	}
+
+	if code == 0 {
+		if err := p.commitOutputs(); err != nil {
+			fmt.Println(err)
+			code = 1
+		}
+	}
+
+	for i := len(p.cleanups) - 1; i >= 0; i-- {
+		p.cleanups[i]()
+	}
+
+	// Outputs that were renamed are already gone.
+	for _, o := range p.outputs {
+		o.file.Close()
+		os.Remove(o.file.Name())
+	}
+
 	os.Exit(code)
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/deltasign"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutputs(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("outputs", func() {
+
+		dir, _ := ioutil.TempDir("", "deltadiff-cmd-test-")
+
+		g.After(func() {
+			os.RemoveAll(dir)
+		})
+
+		path := func(name string) string {
+			return filepath.Join(dir, name)
+		}
+
+		write := func(name string, data []byte) {
+			g.Assert(ioutil.WriteFile(path(name), data, 0644)).Equal(nil)
+		}
+
+		random := func(seed int64, size int) []byte {
+			data := make([]byte, size)
+			rand.New(rand.NewSource(seed)).Read(data)
+			return data
+		}
+
+		files := func() []string {
+			entries, _ := ioutil.ReadDir(dir)
+
+			names := make([]string, 0)
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+
+			return names
+		}
+
+		// Before rather than after, which a failed test skips.
+		g.BeforeEach(func() {
+			for _, name := range files() {
+				os.Remove(path(name))
+			}
+		})
+
+		command := func(args ...string) *exec.Cmd {
+			args = append([]string{"-test.run=^TestProgramProcess$", "--"}, args...)
+
+			cmd := exec.Command(os.Args[0], args...)
+			cmd.Env = append(os.Environ(), "DELTADIFF_PROGRAM_PROCESS=1")
+
+			return cmd
+		}
+
+		g.It("should leave no delta when interrupted", func() {
+			g.Timeout(time.Second * 60)
+
+			write("base", random(1, 4<<20))
+			write("target", random(2, 4<<20))
+
+			signature := bytes.NewBuffer(nil)
+			base, _ := ioutil.ReadFile(path("base"))
+			err := deltadiff.Signature(bytes.NewReader(base), signature, &deltadiff.SignatureConfig{
+				Hasher:    "polyroll",
+				BlockSize: 1024,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+			write("signature", signature.Bytes())
+
+			cmd := command("delta", path("signature"), path("target"), path("delta"))
+			g.Assert(cmd.Start()).Equal(nil)
+
+			// Random blocks match nowhere, so matching takes far
+			// longer than this.
+			for len(files()) < 4 {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			time.Sleep(200 * time.Millisecond)
+			g.Assert(cmd.Process.Signal(os.Interrupt)).Equal(nil)
+
+			err = cmd.Wait()
+			g.Assert(err == nil).IsFalse()
+			g.Assert(files()).Equal([]string{"base", "signature", "target"})
+		})
+
+		g.It("should stop commands that don't check for interrupts", func() {
+			g.Timeout(time.Second * 60)
+
+			_, key, _ := ed25519.GenerateKey(nil)
+			write("key", deltasign.MarshalPrivateKey(key))
+
+			// sign reads stdin until it's closed, which it never is.
+			cmd := command("sign", "--key", path("key"), "-", path("signed"))
+			stdin, err := cmd.StdinPipe()
+			g.Assert(err).Equal(nil)
+			g.Assert(cmd.Start()).Equal(nil)
+
+			defer stdin.Close()
+			stdin.Write([]byte("a delta that never ends"))
+
+			for len(files()) < 2 {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			g.Assert(cmd.Process.Signal(os.Interrupt)).Equal(nil)
+
+			err = cmd.Wait()
+			g.Assert(err == nil).IsFalse()
+			g.Assert(files()).Equal([]string{"key"})
+		})
+
+		g.It("should count what encryption and signing add in the stats", func() {
+			base := random(3, 10000)
+			write("base", base)
+			write("target", append(base, "and some more"...))
+			write("key", bytes.Repeat([]byte{7}, 32))
+
+			_, private, _ := ed25519.GenerateKey(nil)
+			write("private", deltasign.MarshalPrivateKey(private))
+
+			err := command("signature", path("base"), path("signature")).Run()
+			g.Assert(err).Equal(nil)
+
+			cmd := command("delta", "--stats", "--stats-format", "json", "--encrypt-key", path("key"), "--sign-key", path("private"), path("signature"), path("target"), path("delta"))
+			stderr := bytes.NewBuffer(nil)
+			cmd.Stderr = stderr
+			g.Assert(cmd.Run()).Equal(nil)
+
+			stats := &deltadiff.DeltaStats{}
+			g.Assert(json.Unmarshal(stderr.Bytes(), stats)).Equal(nil)
+
+			info, err := os.Stat(path("delta"))
+			g.Assert(err).Equal(nil)
+			g.Assert(stats.DeltaSize).Equal(info.Size())
+		})
+
+		g.It("should leave no result when patching fails", func() {
+			write("base", []byte("some base to patch"))
+
+			ops := []deltadiff.Op{
+				&deltadiff.ReadOp{From: 0, To: 4},
+				&deltadiff.ChecksumOp{Digest: make([]byte, 32)},
+			}
+
+			delta := bytes.NewBuffer(nil)
+			g.Assert(deltadiff.EncodeDelta(ops, delta)).Equal(nil)
+			write("delta", delta.Bytes())
+
+			err := command("patch", path("base"), path("delta"), path("result")).Run()
+			g.Assert(err == nil).IsFalse()
+			g.Assert(files()).Equal([]string{"base", "delta"})
+		})
+
+		g.It("should put the result in place when patching succeeds", func() {
+			write("base", []byte("some base to patch"))
+			write("result", []byte("an older result"))
+			g.Assert(os.Chmod(path("result"), 0600)).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			g.Assert(deltadiff.EncodeDelta([]deltadiff.Op{&deltadiff.ReadOp{From: 5, To: 9}}, delta)).Equal(nil)
+			write("delta", delta.Bytes())
+
+			err := command("patch", path("base"), path("delta"), path("result")).Run()
+			g.Assert(err).Equal(nil)
+			g.Assert(files()).Equal([]string{"base", "delta", "result"})
+
+			result, _ := ioutil.ReadFile(path("result"))
+			g.Assert(string(result)).Equal("base")
+
+			info, _ := os.Stat(path("result"))
+			g.Assert(info.Mode().Perm()).Equal(os.FileMode(0600))
+		})
+
+	})
+}
+
+// TestProgramProcess isn't a test, it's the program TestOutputs
+// runs as a subprocess, with the args after --.
+func TestProgramProcess(t *testing.T) {
+	if os.Getenv("DELTADIFF_PROGRAM_PROCESS") != "1" {
+		return
+	}
+
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{"deltadiff"}, os.Args[i+1:]...)
+			break
+		}
+	}
+
+	NewProgram().Run()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	PROGRESS_BAR_WIDTH = 30
+	PROGRESS_INTERVAL  = 100 * time.Millisecond
+)
+
+// ProgressBar draws progress on a single line of a terminal,
+// redrawing it at most every PROGRESS_INTERVAL.
+type ProgressBar struct {
+	out   io.Writer
+	phase string
+	last  deltadiff.Progress
+	drawn time.Time
+	width int
+}
+
+func NewProgressBar(out io.Writer) *ProgressBar {
+	return &ProgressBar{
+		out: out,
+	}
+}
+
+func (b *ProgressBar) Update(p deltadiff.Progress) {
+	// Each phase keeps its own line, showing where it ended.
+	if b.phase != "" && p.Phase != b.phase {
+		b.draw(b.last)
+		fmt.Fprintln(b.out)
+		b.width = 0
+	}
+
+	b.last = p
+	finished := p.Total >= 0 && p.Done >= p.Total
+
+	if p.Phase == b.phase && !finished && time.Since(b.drawn) < PROGRESS_INTERVAL {
+		return
+	}
+
+	b.draw(p)
+}
+
+func (b *ProgressBar) draw(p deltadiff.Progress) {
+	b.phase = p.Phase
+	b.drawn = time.Now()
+
+	var line string
+
+	if p.Total > 0 {
+		filled := int(p.Done * PROGRESS_BAR_WIDTH / p.Total)
+		if filled > PROGRESS_BAR_WIDTH {
+			filled = PROGRESS_BAR_WIDTH
+		}
+
+		line = fmt.Sprintf(
+			"%-9s [%s%s] %3d%% %s/%s",
+			p.Phase,
+			strings.Repeat("=", filled),
+			strings.Repeat(" ", PROGRESS_BAR_WIDTH-filled),
+			p.Done*100/p.Total,
+			formatBytes(p.Done),
+			formatBytes(p.Total),
+		)
+	} else {
+		line = fmt.Sprintf("%-9s %s", p.Phase, formatBytes(p.Done))
+	}
+
+	// Pad with spaces to erase what's left of a longer line.
+	padding := ""
+	if len(line) < b.width {
+		padding = strings.Repeat(" ", b.width-len(line))
+	}
+
+	b.width = len(line)
+	fmt.Fprintf(b.out, "\r%s%s", line, padding)
+}
+
+// Finish draws the last progress and ends the line, if
+// anything was drawn.
+func (b *ProgressBar) Finish() {
+	if b.phase != "" {
+		b.draw(b.last)
+		fmt.Fprintln(b.out)
+		b.phase = ""
+	}
+}
+
+func formatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(n)
+	unit := 0
+
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", n, units[unit])
+	}
+
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
@@ -1,21 +1,54 @@
 package main
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/netsync"
+	"io"
+	"log"
+	"os"
 )
 
 type RootCommand struct {
 	program *Program
+
+	options struct {
+		server bool
+	}
 }
 
 func (rc *RootCommand) Run(cmd *cobra.Command, args []string) {
+	if rc.options.server {
+		rc.serve()
+	}
+
 	cmd.Help()
 	rc.program.Exit(0)
 }
 
+// serve speaks the sync protocol over stdin and stdout, for
+// sync --rsh. Nothing else may be written to stdout.
+func (rc *RootCommand) serve() {
+	s := &netsync.Server{
+		ErrorLog: log.New(os.Stderr, "deltadiff server: ", 0),
+	}
+
+	stdio := struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+
+	if err := s.ServeConn(stdio); err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+		rc.program.Exit(1)
+	}
+
+	rc.program.Exit(0)
+}
+
 func (p *Program) createRootCmd() *cobra.Command {
 	rc := &RootCommand{
-		program:     p,
+		program: p,
 	}
 
 	cmd := &cobra.Command{
@@ -25,5 +58,21 @@ func (p *Program) createRootCmd() *cobra.Command {
 		Run:   rc.Run,
 	}
 
+	cmd.PersistentFlags().BoolVarP(
+		&p.progress,
+		"progress",
+		"",
+		false,
+		"If enabled, shows a progress bar on stderr",
+	)
+
+	cmd.Flags().BoolVarP(
+		&rc.options.server,
+		"server",
+		"",
+		false,
+		"Serve files over stdin and stdout, this is what sync --rsh runs on the other side",
+	)
+
 	return cmd
 }
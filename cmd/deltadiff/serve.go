@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/netsync"
+	"log"
+	"net"
+	"os"
+)
+
+type ServeCommand struct {
+	program *Program
+
+	options struct {
+		root        string
+		addr        string
+		memoryLimit string
+	}
+}
+
+func (sc *ServeCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) > 0 {
+		fmt.Println("command serve takes no args")
+		sc.program.Exit(1)
+	}
+
+	info, err := os.Stat(sc.options.root)
+	if err != nil || !info.IsDir() {
+		fmt.Printf("Root %s must be a directory\n", sc.options.root)
+		sc.program.Exit(1)
+	}
+
+	memoryLimit, err := decideMemoryLimit(sc.options.memoryLimit)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	l, err := net.Listen("tcp", sc.options.addr)
+	if err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	ctx := sc.program.context()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	s := &netsync.Server{
+		Root:        sc.options.root,
+		MemoryLimit: memoryLimit,
+		ErrorLog:    log.New(os.Stderr, "", log.LstdFlags),
+	}
+
+	fmt.Fprintf(os.Stderr, "Serving %s on %s\n", sc.options.root, l.Addr())
+
+	if err := s.Serve(l); err != nil && ctx.Err() == nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	sc.program.Exit(0)
+}
+
+func (p *Program) createServeCmd() *cobra.Command {
+
+	sc := &ServeCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "serve [--root <dir>] [--addr <addr>]",
+		Short: "Serve files to sync clients",
+		Long:  `Serve the files under root to clients of the sync command, which send the signature of their copy and receive a delta. Files outside of root can't be requested.`,
+		Run:   sc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&sc.options.root,
+		"root",
+		"",
+		".",
+		"Directory to serve files from",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.addr,
+		"addr",
+		"",
+		":"+netsync.DEFAULT_PORT,
+		"Address to listen on",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.memoryLimit,
+		"memory-limit",
+		"",
+		"",
+		"Roughly how much memory to use per file, such as 512M or 2G, see the delta command",
+	)
+
+	return cmd
+}
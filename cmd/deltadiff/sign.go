@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/deltasign"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+type SignCommand struct {
+	program *Program
+
+	options struct {
+		key string
+	}
+}
+
+func (sc *SignCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("command sign requires 1 or 2 args")
+		sc.program.Exit(1)
+	}
+
+	key, err := decideSignKey(sc.options.key)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	if key == nil {
+		fmt.Println("command sign requires --key")
+		sc.program.Exit(1)
+	}
+
+	inputReader, err := sc.decideInputReader(args)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	signedWriter, err := sc.decideSignedWriter(args)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	if err := deltasign.Sign(inputReader, signedWriter, key); err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	sc.program.Exit(0)
+}
+
+func (p *Program) createSignCmd() *cobra.Command {
+
+	sc := &SignCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "sign --key <key> <delta> <signed>",
+		Short: "Sign a delta",
+		Long:  `Sign a delta, or any other file, with a private key made with keygen. Patch checks the signature with --trusted-key before writing anything.`,
+		Run:   sc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&sc.options.key,
+		"key",
+		"",
+		"",
+		"File holding the private key to sign with",
+	)
+
+	return cmd
+}
+
+func (sc *SignCommand) decideInputReader(args []string) (io.Reader, error) {
+	filename := args[0]
+
+	if filename == "-" {
+		return sc.program.progressReader(os.Stdin), nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening file %s: %v", filename, err)
+	}
+
+	return sc.program.progressReader(file), nil
+}
+
+func (sc *SignCommand) decideSignedWriter(args []string) (io.Writer, error) {
+	if len(args) == 1 || args[1] == "-" {
+		return os.Stdout, nil
+	}
+
+	filename := args[1]
+
+	file, err := sc.program.createOutput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening signed file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
+
+func decideSignKey(filename string) (ed25519.PrivateKey, error) {
+	if filename == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading key file %s: %v", filename, err)
+	}
+
+	return deltasign.ParsePrivateKey(data)
+}
+
+func decideTrustedKeys(filenames []string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0)
+
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading key file %s: %v", filename, err)
+		}
+
+		parsed, err := deltasign.ParsePublicKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing key file %s: %w", filename, err)
+		}
+
+		keys = append(keys, parsed...)
+	}
+
+	return keys, nil
+}
+
+// decideVerification checks the signature of delta against the
+// keys in keyFiles before anything is read from it. Signed
+// deltas can't be used without checking them.
+func (p *Program) decideVerification(delta *bufio.Reader, keyFiles []string) (*bufio.Reader, error) {
+	magic, _ := delta.Peek(len(deltasign.MAGIC))
+	signed := deltasign.IsSigned(magic)
+
+	if len(keyFiles) == 0 {
+		if signed {
+			return nil, fmt.Errorf("Delta is signed, use --trusted-key to check it")
+		}
+
+		return delta, nil
+	}
+
+	if !signed {
+		return nil, fmt.Errorf("Delta isn't signed, but --trusted-key was given")
+	}
+
+	keys, err := decideTrustedKeys(keyFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := deltasign.Open(delta, keys, "")
+	if err != nil {
+		return nil, err
+	}
+
+	p.atExit(func() { content.Close() })
+
+	return bufio.NewReader(content), nil
+}
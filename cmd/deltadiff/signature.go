@@ -4,16 +4,26 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/gzipdiff"
+	"github.com/xrash/deltadiff/tardiff"
+	"github.com/xrash/deltadiff/treediff"
 	"io"
 	"os"
+	"strconv"
 )
 
 type SignatureCommand struct {
 	program *Program
 
 	options struct {
-		hasher    string
-		blockSize uint32
+		hasher       string
+		blockSize    string
+		cdc          bool
+		minBlockSize string
+		maxBlockSize string
+		recursive    bool
+		tar          bool
+		gzip         bool
 	}
 }
 
@@ -24,25 +34,62 @@ func (sc *SignatureCommand) Run(cmd *cobra.Command, args []string) {
 		sc.program.Exit(1)
 	}
 
-	baseReader, baseSize, err := sc.decideBaseReader(args)
+	signatureWriter, err := sc.decideSignatureWriter(args)
 	if err != nil {
 		fmt.Println(err)
 		sc.program.Exit(1)
 	}
 
-	signatureWriter, err := sc.decideSignatureWriter(args)
+	blockSize, err := decideBlockSize(sc.options.blockSize)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	minBlockSize, err := decideBlockSize(sc.options.minBlockSize)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	maxBlockSize, err := decideBlockSize(sc.options.maxBlockSize)
 	if err != nil {
 		fmt.Println(err)
 		sc.program.Exit(1)
 	}
 
 	config := &deltadiff.SignatureConfig{
-		Hasher:    sc.options.hasher,
-		BlockSize: int(sc.options.blockSize),
-		BaseSize:  baseSize,
+		Hasher:       sc.options.hasher,
+		BlockSize:    blockSize,
+		CDC:          sc.options.cdc,
+		MinBlockSize: minBlockSize,
+		MaxBlockSize: maxBlockSize,
+		Progress:     sc.program.progressFunc(),
+	}
+
+	modes := 0
+	for _, enabled := range []bool{sc.options.recursive, sc.options.tar, sc.options.gzip} {
+		if enabled {
+			modes++
+		}
+	}
+
+	if modes > 1 {
+		fmt.Println("only one of --recursive, --tar and --gzip can be used")
+		sc.program.Exit(1)
+	}
+
+	if sc.options.recursive {
+		err = sc.signTree(args, signatureWriter, config)
+	} else if sc.options.tar {
+		err = sc.signTar(args, signatureWriter, config)
+	} else if sc.options.gzip {
+		err = sc.signGzip(args, signatureWriter, config)
+	} else {
+		err = sc.signFile(args, signatureWriter, config)
 	}
 
-	if err := deltadiff.Signature(baseReader, signatureWriter, config); err != nil {
+	if err != nil {
 		fmt.Println("Error", err)
 		sc.program.Exit(1)
 	}
@@ -68,20 +115,118 @@ func (p *Program) createSignatureCmd() *cobra.Command {
 		"hasher",
 		"",
 		"polyroll",
-		"Hasher to be used, can be md5, crc32 or polyroll",
+		"Hasher to be used, see the hashers command for the available ones",
 	)
 
-	cmd.Flags().Uint32VarP(
+	cmd.Flags().StringVarP(
 		&sc.options.blockSize,
 		"block-size",
 		"",
-		1024,
-		"Size of the blocks used in the rolling hash algorithm",
+		"auto",
+		"Size of the blocks used in the rolling hash algorithm, or auto to pick it from the size of base",
+	)
+
+	cmd.Flags().BoolVarP(
+		&sc.options.cdc,
+		"cdc",
+		"",
+		false,
+		"If enabled, blocks are cut by content, so insertions in base only change the blocks around them, and --block-size is their average size, a power of 2",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.minBlockSize,
+		"min-block-size",
+		"",
+		"auto",
+		"Size of the shortest blocks with --cdc, or auto for a quarter of the average",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.maxBlockSize,
+		"max-block-size",
+		"",
+		"auto",
+		"Size of the longest blocks with --cdc, or auto for four times the average",
+	)
+
+	cmd.Flags().BoolVarP(
+		&sc.options.recursive,
+		"recursive",
+		"r",
+		false,
+		"If enabled, base must be a directory and the signature covers every file in it",
+	)
+
+	cmd.Flags().BoolVarP(
+		&sc.options.tar,
+		"tar",
+		"",
+		false,
+		"If enabled, base must be a tar archive and its members are diffed one by one",
+	)
+
+	cmd.Flags().BoolVarP(
+		&sc.options.gzip,
+		"gzip",
+		"",
+		false,
+		"If enabled and base is a gzip file, its decompressed content is diffed",
 	)
 
 	return cmd
 }
 
+func (sc *SignatureCommand) signFile(args []string, out io.Writer, config *deltadiff.SignatureConfig) error {
+	baseReader, baseSize, err := sc.decideBaseReader(args)
+	if err != nil {
+		return err
+	}
+
+	config.BaseSize = baseSize
+
+	return deltadiff.SignatureContext(sc.program.context(), baseReader, out, config)
+}
+
+func (sc *SignatureCommand) signTree(args []string, out io.Writer, config *deltadiff.SignatureConfig) error {
+	if len(args) == 0 || args[0] == "-" {
+		return fmt.Errorf("--recursive requires a base directory")
+	}
+
+	return treediff.Signature(args[0], out, config)
+}
+
+func (sc *SignatureCommand) signTar(args []string, out io.Writer, config *deltadiff.SignatureConfig) error {
+	baseReader, _, err := sc.decideBaseReader(args)
+	if err != nil {
+		return err
+	}
+
+	return tardiff.Signature(baseReader, out, config)
+}
+
+func (sc *SignatureCommand) signGzip(args []string, out io.Writer, config *deltadiff.SignatureConfig) error {
+	baseReader, _, err := sc.decideBaseReader(args)
+	if err != nil {
+		return err
+	}
+
+	return gzipdiff.Signature(baseReader, out, config)
+}
+
+func decideBlockSize(blockSize string) (int, error) {
+	if blockSize == "auto" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseUint(blockSize, 10, 32)
+	if err != nil || n == 0 {
+		return -1, fmt.Errorf("Invalid block size %s, must be a positive number or auto", blockSize)
+	}
+
+	return int(n), nil
+}
+
 func (sc *SignatureCommand) decideBaseReader(args []string) (io.Reader, int, error) {
 	if len(args) == 0 {
 		return os.Stdin, -1, nil
@@ -117,7 +262,7 @@ func (sc *SignatureCommand) decideSignatureWriter(args []string) (io.Writer, err
 		return os.Stdout, nil
 	}
 
-	file, err := os.Create(filename)
+	file, err := sc.program.createOutput(filename)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening signature file %s: %v", filename, err)
 	}
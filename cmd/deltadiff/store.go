@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/store"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+type StoreAddCommand struct {
+	program *Program
+
+	options struct {
+		message   string
+		maxChain  int
+		hasher    string
+		blockSize string
+	}
+}
+
+type StoreGetCommand struct {
+	program *Program
+}
+
+type StoreLogCommand struct {
+	program *Program
+}
+
+type StoreCompactCommand struct {
+	program *Program
+
+	options struct {
+		maxChain int
+	}
+}
+
+type StoreVerifyCommand struct {
+	program *Program
+}
+
+func (p *Program) createStoreCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "store",
+		Short: "Keep the history of a file as a chain of deltas",
+		Long:  `Keep the history of a file as a chain of deltas in a directory. Each version is stored as a delta of the one before it, except for periodic full snapshots, and is checked against its checksum when it's rebuilt.`,
+	}
+
+	cmd.AddCommand(p.createStoreAddCmd())
+	cmd.AddCommand(p.createStoreGetCmd())
+	cmd.AddCommand(p.createStoreLogCmd())
+	cmd.AddCommand(p.createStoreCompactCmd())
+	cmd.AddCommand(p.createStoreVerifyCmd())
+
+	return cmd
+}
+
+func (sc *StoreAddCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("command store add requires 1 or 2 args")
+		sc.program.Exit(1)
+	}
+
+	s, err := sc.decideStore(args[0])
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	s.Progress = sc.program.progressFunc()
+
+	content, err := sc.decideContentReader(args)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	v, err := s.Add(content, sc.options.message)
+	if err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	fmt.Printf("Added version %d, %d bytes, stored as a %s of %d bytes\n", v.Number, v.Size, kindName(v.Kind), v.StoredSize)
+
+	sc.program.Exit(0)
+}
+
+func (p *Program) createStoreAddCmd() *cobra.Command {
+
+	sc := &StoreAddCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "add <store> [file]",
+		Short: "Add a version to a store",
+		Long:  `Add the content of file, or of stdin, as a new version. The store is created if it doesn't exist, with --max-chain, --hasher and --block-size, which are ignored otherwise.`,
+		Run:   sc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&sc.options.message,
+		"message",
+		"m",
+		"",
+		"Message describing the version",
+	)
+
+	cmd.Flags().IntVarP(
+		&sc.options.maxChain,
+		"max-chain",
+		"",
+		store.DEFAULT_MAX_CHAIN,
+		"How many deltas may be chained after a snapshot, 0 for the default",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.hasher,
+		"hasher",
+		"",
+		"polyroll",
+		"Hasher to be used, see the hashers command for the available ones",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.blockSize,
+		"block-size",
+		"",
+		"auto",
+		"Size of the blocks used in the rolling hash algorithm, or auto to pick it from the size of each version",
+	)
+
+	return cmd
+}
+
+func (sc *StoreAddCommand) decideStore(dir string) (*store.Store, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		blockSize, err := decideBlockSize(sc.options.blockSize)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &store.Config{
+			MaxChain:  sc.options.maxChain,
+			Hasher:    sc.options.hasher,
+			BlockSize: blockSize,
+		}
+
+		s, err := store.Init(dir, c)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating store %s: %v", dir, err)
+		}
+
+		return s, nil
+	}
+
+	return openStore(dir)
+}
+
+func (sc *StoreAddCommand) decideContentReader(args []string) (io.Reader, error) {
+	if len(args) == 1 || args[1] == "-" {
+		return os.Stdin, nil
+	}
+
+	filename := args[1]
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
+
+func (sc *StoreGetCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) < 2 || len(args) > 3 {
+		fmt.Println("command store get requires 2 or 3 args")
+		sc.program.Exit(1)
+	}
+
+	s, err := openStore(args[0])
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	s.Progress = sc.program.progressFunc()
+
+	number, err := sc.decideVersion(s, args[1])
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	out, err := sc.decideOutputWriter(args)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	w := bufio.NewWriter(out)
+
+	if err := s.Get(number, w); err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	sc.program.Exit(0)
+}
+
+func (p *Program) createStoreGetCmd() *cobra.Command {
+
+	sc := &StoreGetCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "get <store> <version> [output]",
+		Short: "Get a version out of a store",
+		Long:  `Write a version, by number or latest, to output or to stdout. It fails without writing anything more if the version doesn't match its checksum.`,
+		Run:   sc.Run,
+	}
+
+	return cmd
+}
+
+func (sc *StoreGetCommand) decideVersion(s *store.Store, version string) (int, error) {
+	if version == "latest" {
+		return len(s.Versions()), nil
+	}
+
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Invalid version %s, must be a positive number or latest", version)
+	}
+
+	return n, nil
+}
+
+func (sc *StoreGetCommand) decideOutputWriter(args []string) (io.Writer, error) {
+	if len(args) == 2 || args[2] == "-" {
+		return os.Stdout, nil
+	}
+
+	filename := args[2]
+	file, err := sc.program.createOutput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening output file %s: %v", filename, err)
+	}
+
+	return file, nil
+}
+
+func (sc *StoreLogCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("command store log requires 1 arg")
+		sc.program.Exit(1)
+	}
+
+	s, err := openStore(args[0])
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "version\ttime\tsize\tstored as\tsha256\tmessage\n")
+
+	for _, v := range s.Versions() {
+		stored := fmt.Sprintf("%s, %d bytes", kindName(v.Kind), v.StoredSize)
+		if v.Kind == store.KIND_DELTA {
+			stored = fmt.Sprintf("delta of %d, %d bytes", v.Base, v.StoredSize)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", v.Number, v.Time.Format(time.RFC3339), v.Size, stored, hex.EncodeToString(v.Digest)[:16], v.Message)
+	}
+
+	w.Flush()
+	sc.program.Exit(0)
+}
+
+func (p *Program) createStoreLogCmd() *cobra.Command {
+
+	sc := &StoreLogCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "log <store>",
+		Short: "List the versions in a store",
+		Long:  `List the versions in a store, oldest first, with how each of them is stored.`,
+		Run:   sc.Run,
+	}
+
+	return cmd
+}
+
+func (sc *StoreCompactCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("command store compact requires 1 arg")
+		sc.program.Exit(1)
+	}
+
+	s, err := openStore(args[0])
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	s.Progress = sc.program.progressFunc()
+
+	maxChain := s.MaxChain()
+	if cmd.Flags().Changed("max-chain") {
+		maxChain = sc.options.maxChain
+	}
+
+	compacted, err := s.Compact(maxChain)
+	if err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	fmt.Printf("Turned %d versions into snapshots, chains are now at most %d deltas long\n", compacted, maxChain)
+
+	sc.program.Exit(0)
+}
+
+func (p *Program) createStoreCompactCmd() *cobra.Command {
+
+	sc := &StoreCompactCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "compact <store> [--max-chain <n>]",
+		Short: "Shorten the chains of deltas in a store",
+		Long:  `Turn versions into snapshots where needed so that no chain of deltas is longer than --max-chain, which is kept for the versions added later. Without --max-chain, the one the store has is enforced.`,
+		Run:   sc.Run,
+	}
+
+	cmd.Flags().IntVarP(
+		&sc.options.maxChain,
+		"max-chain",
+		"",
+		store.DEFAULT_MAX_CHAIN,
+		"How many deltas may be chained after a snapshot, 0 for the default",
+	)
+
+	return cmd
+}
+
+func (sc *StoreVerifyCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("command store verify requires 1 arg")
+		sc.program.Exit(1)
+	}
+
+	s, err := openStore(args[0])
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	s.Progress = sc.program.progressFunc()
+
+	if err := s.Verify(); err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	fmt.Printf("All %d versions are intact\n", len(s.Versions()))
+
+	sc.program.Exit(0)
+}
+
+func (p *Program) createStoreVerifyCmd() *cobra.Command {
+
+	sc := &StoreVerifyCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "verify <store>",
+		Short: "Check every version in a store",
+		Long:  `Rebuild every version in a store and check it against its checksum.`,
+		Run:   sc.Run,
+	}
+
+	return cmd
+}
+
+func openStore(dir string) (*store.Store, error) {
+	s, err := store.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening store %s: %v", dir, err)
+	}
+
+	return s, nil
+}
+
+func kindName(kind uint8) string {
+	if kind == store.KIND_DELTA {
+		return "delta"
+	}
+
+	return "snapshot"
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff/netsync"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type SyncCommand struct {
+	program *Program
+
+	options struct {
+		hasher        string
+		blockSize     string
+		rsh           string
+		remoteCommand string
+	}
+}
+
+func (sc *SyncCommand) Run(cmd *cobra.Command, args []string) {
+
+	if sc.options.rsh == "" && len(args) != 3 {
+		fmt.Println("command sync requires 3 args")
+		sc.program.Exit(1)
+	}
+
+	if sc.options.rsh != "" && len(args) != 2 {
+		fmt.Println("command sync requires 2 args with --rsh")
+		sc.program.Exit(1)
+	}
+
+	blockSize, err := decideBlockSize(sc.options.blockSize)
+	if err != nil {
+		fmt.Println(err)
+		sc.program.Exit(1)
+	}
+
+	conn, remote, local, err := sc.decideConn(args)
+	if err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	c := &netsync.ClientConfig{
+		Hasher:    sc.options.hasher,
+		BlockSize: blockSize,
+		Progress:  sc.program.progressFunc(),
+	}
+
+	client, err := netsync.NewClient(conn, c)
+	if err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	result, err := client.Sync(remote, local)
+	if err != nil {
+		fmt.Println("Error", err)
+		sc.program.Exit(1)
+	}
+
+	fmt.Printf("Synced %s, %d bytes, received %d bytes of delta\n", local, result.Size, result.DeltaSize)
+
+	// With --rsh, this waits for the server to exit.
+	conn.Close()
+
+	sc.program.Exit(0)
+}
+
+func (p *Program) createSyncCmd() *cobra.Command {
+
+	sc := &SyncCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "sync <host[:port]> <remote-path> <local-path> | sync --rsh <command> <[host:]remote-path> <local-path>",
+		Short: "Sync a local file with a file on a server",
+		Long:  `Sync a local file with a file on a server started with the serve command. The signature of the local file is sent to the server, which answers with a delta, and the local file is only replaced once it's patched and its checksum matches. If the local file doesn't exist, it's created. With --rsh, the server is started through a remote shell such as ssh instead, and speaks over its stdin and stdout.`,
+		Run:   sc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&sc.options.hasher,
+		"hasher",
+		"",
+		"polyroll",
+		"Hasher to use if the server knows it, see the hashers command for the available ones",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.blockSize,
+		"block-size",
+		"",
+		"auto",
+		"Size of the blocks used in the rolling hash algorithm, or auto to pick it from the size of the local file",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.rsh,
+		"rsh",
+		"",
+		"",
+		"Remote shell to start the server with, such as ssh, followed by the host if there's one before the remote path",
+	)
+
+	cmd.Flags().StringVarP(
+		&sc.options.remoteCommand,
+		"remote-command",
+		"",
+		"deltadiff --server",
+		"Command the remote shell runs to start the server",
+	)
+
+	return cmd
+}
+
+// decideConn connects to the server, either over TCP or through
+// the remote shell, and returns the remote and local paths.
+func (sc *SyncCommand) decideConn(args []string) (io.ReadWriteCloser, string, string, error) {
+	if sc.options.rsh == "" {
+		conn, err := net.Dial("tcp", sc.decideAddr(args[0]))
+		return conn, args[1], args[2], err
+	}
+
+	words := strings.Fields(sc.options.rsh)
+	if len(words) == 0 {
+		return nil, "", "", fmt.Errorf("Invalid remote shell %q", sc.options.rsh)
+	}
+
+	remote := args[0]
+
+	if i := strings.Index(remote, ":"); i >= 0 {
+		if host := remote[:i]; host != "" {
+			words = append(words, host)
+		}
+
+		remote = remote[i+1:]
+	}
+
+	cmd := exec.Command(words[0], append(words[1:], sc.options.remoteCommand)...)
+	cmd.Stderr = os.Stderr
+
+	conn, err := netsync.Command(cmd)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return conn, remote, args[1], nil
+}
+
+// decideAddr adds the default port to addresses without one.
+func (sc *SyncCommand) decideAddr(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+
+	return net.JoinHostPort(addr, netsync.DEFAULT_PORT)
+}
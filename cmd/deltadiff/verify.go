@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/tardiff"
+	"github.com/xrash/deltadiff/treediff"
+	"os"
+)
+
+type VerifyCommand struct {
+	program *Program
+
+	options struct {
+		signature   string
+		base        string
+		decryptKey  string
+		trustedKeys []string
+	}
+}
+
+func (vc *VerifyCommand) Run(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("command verify requires 1 arg")
+		vc.program.Exit(1)
+	}
+
+	if vc.options.signature != "" && vc.options.base != "" {
+		fmt.Println("--signature and --base can't be used together")
+		vc.program.Exit(1)
+	}
+
+	deltaReader, err := vc.decideDeltaReader(args)
+	if err != nil {
+		fmt.Println(err)
+		vc.program.Exit(1)
+	}
+
+	deltaReader, err = vc.program.decideVerification(deltaReader, vc.options.trustedKeys)
+	if err != nil {
+		fmt.Println(err)
+		vc.program.Exit(1)
+	}
+
+	deltaReader, err = decideDecryption(deltaReader, vc.options.decryptKey)
+	if err != nil {
+		fmt.Println(err)
+		vc.program.Exit(1)
+	}
+
+	if isGzipDelta(deltaReader) || isTreeDelta(deltaReader) {
+		fmt.Println("command verify only works with file and tar deltas")
+		vc.program.Exit(1)
+	}
+
+	c, err := vc.decideConfig()
+	if err != nil {
+		fmt.Println(err)
+		vc.program.Exit(1)
+	}
+
+	result, err := deltadiff.Verify(deltaReader, c)
+	if err != nil {
+		fmt.Println("Error", err)
+		vc.program.Exit(1)
+	}
+
+	fmt.Printf("Delta is valid, %d ops, %d bytes of output", result.Ops, result.OutputSize)
+
+	switch {
+	case result.Checksums == 0:
+		fmt.Printf(", no checksum\n")
+	case result.ChecksumsChecked:
+		fmt.Printf(", checksum verified\n")
+	default:
+		fmt.Printf(", checksum not verified, it takes --base\n")
+	}
+
+	vc.program.Exit(0)
+}
+
+func (p *Program) createVerifyCmd() *cobra.Command {
+
+	vc := &VerifyCommand{
+		program: p,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "verify <delta> [--signature <signature> | --base <base>]",
+		Short: "Check that a delta is valid without applying it",
+		Long:  `Check that a delta is valid without applying it. Every op is decoded and, with --signature or --base, checked to read within base. With --base the checksum of the output is verified too, if the delta has one, without writing the output anywhere.`,
+		Run:   vc.Run,
+	}
+
+	cmd.Flags().StringVarP(
+		&vc.options.signature,
+		"signature",
+		"",
+		"",
+		"Signature of the base the delta is meant for",
+	)
+
+	cmd.Flags().StringVarP(
+		&vc.options.base,
+		"base",
+		"",
+		"",
+		"Base the delta is meant for",
+	)
+
+	cmd.Flags().StringVarP(
+		&vc.options.decryptKey,
+		"decrypt-key",
+		"",
+		"",
+		"Decrypts the delta with the raw key in this file, or a passphrase with pass:<file> or env:<variable>",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&vc.options.trustedKeys,
+		"trusted-key",
+		"",
+		nil,
+		"File of public keys, one of which must have signed the delta, can be given more than once",
+	)
+
+	return cmd
+}
+
+func (vc *VerifyCommand) decideConfig() (*deltadiff.VerifyConfig, error) {
+	c := &deltadiff.VerifyConfig{
+		BaseSize: -1,
+	}
+
+	if vc.options.base != "" {
+		file, err := os.Open(vc.options.base)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening base file %s: %v", vc.options.base, err)
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading base file %s: %v", vc.options.base, err)
+		}
+
+		c.Base = file
+		c.BaseSize = info.Size()
+	}
+
+	if vc.options.signature != "" {
+		baseSize, err := vc.readBaseSize(vc.options.signature)
+		if err != nil {
+			return nil, err
+		}
+
+		c.BaseSize = baseSize
+	}
+
+	return c, nil
+}
+
+func (vc *VerifyCommand) readBaseSize(filename string) (int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, fmt.Errorf("Error opening signature file %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+
+	switch {
+	case isTarSignature(r):
+		s, err := tardiff.ReadSignature(r)
+		if err != nil {
+			return 0, fmt.Errorf("Error reading signature file %s: %v", filename, err)
+		}
+
+		return s.BaseSize, nil
+
+	case isTreeSignature(r) || isGzipSignature(r):
+		return 0, fmt.Errorf("Signature %s must be of a file or a tar archive", filename)
+	}
+
+	s, err := deltadiff.ReadSignatureFile(r)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading signature file %s: %v", filename, err)
+	}
+
+	return int64(s.BaseSize), nil
+}
+
+func (vc *VerifyCommand) decideDeltaReader(args []string) (*bufio.Reader, error) {
+	filename := args[0]
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening delta file %s: %v", filename, err)
+	}
+
+	return bufio.NewReader(vc.program.progressReader(file)), nil
+}
+
+func isTreeDelta(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(treediff.DELTA_MAGIC))
+	return treediff.IsDelta(magic)
+}
@@ -0,0 +1,135 @@
+package deltadiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/franela/goblin"
+	"io"
+	"strings"
+	"testing"
+)
+
+// cancelingWriter cancels its context on the first write.
+type cancelingWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+// cancelingReader cancels its context once after bytes
+// were read.
+type cancelingReader struct {
+	r      io.Reader
+	after  int
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.after -= n
+	if r.after <= 0 {
+		r.cancel()
+	}
+
+	return n, err
+}
+
+func TestContext(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("context", func() {
+
+		base := strings.Repeat("0123456789abcdef", 64)
+		target := "xx" + base[:500] + "yy" + base[500:] + "zz"
+
+		sign := func() []byte {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 16,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			return signature.Bytes()
+		}
+
+		g.It("should leave an incomplete signature that can't be read", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r := &cancelingReader{r: strings.NewReader(base), after: 100, cancel: cancel}
+			signature := bytes.NewBuffer(nil)
+
+			err := SignatureContext(ctx, r, signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 16,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(context.Canceled)
+
+			_, err = ReadSignatureFile(signature)
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("should mark a delta canceled before any op as aborted", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// Without ops, it would be a valid delta of an empty
+			// target.
+			for _, base := range []string{base, ""} {
+				signature := bytes.NewBuffer(nil)
+				err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+					Hasher:    "md5",
+					BlockSize: 16,
+					BaseSize:  len(base),
+				})
+				g.Assert(err).Equal(nil)
+
+				delta := bytes.NewBuffer(nil)
+				err = DeltaContext(ctx, signature, strings.NewReader(target), delta, &DeltaConfig{})
+				g.Assert(err).Equal(context.Canceled)
+
+				_, err = DecodeDelta(bytes.NewReader(delta.Bytes()))
+				g.Assert(errors.Is(err, ErrAborted)).Equal(true)
+			}
+		})
+
+		g.It("should mark a partially written delta as aborted", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			delta := &cancelingWriter{cancel: cancel}
+			err := DeltaContext(ctx, bytes.NewReader(sign()), strings.NewReader(target), delta, &DeltaConfig{})
+			g.Assert(err).Equal(context.Canceled)
+
+			ops, err := DecodeDelta(bytes.NewReader(delta.Bytes()))
+			g.Assert(ops == nil).Equal(true)
+			g.Assert(errors.Is(err, ErrAborted)).Equal(true)
+
+			err = Patch(strings.NewReader(base), bytes.NewReader(delta.Bytes()), bytes.NewBuffer(nil))
+			g.Assert(errors.Is(err, ErrAborted)).Equal(true)
+		})
+
+		g.It("should stop patching", func() {
+			delta := bytes.NewBuffer(nil)
+			err := Delta(bytes.NewReader(sign()), strings.NewReader(target), delta, &DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			out := &cancelingWriter{cancel: cancel}
+			err = PatchContext(ctx, strings.NewReader(base), delta, out)
+			g.Assert(err).Equal(context.Canceled)
+			g.Assert(out.Len() < len(target)).Equal(true)
+		})
+	})
+}
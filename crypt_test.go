@@ -0,0 +1,186 @@
+package deltadiff
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff/deltacrypt"
+	"github.com/xrash/deltadiff/deltasign"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedDeltas(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("encrypted deltas", func() {
+
+		base := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 100)
+		target := base[:1000] + "a secret change" + base[1000:]
+
+		key, _ := deltacrypt.NewKey(bytes.Repeat([]byte{1}, deltacrypt.KEY_SIZE))
+
+		delta := func() []byte {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 64,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, strings.NewReader(target), delta, &DeltaConfig{
+				Checksum:   true,
+				EncryptKey: key,
+			})
+			g.Assert(err).Equal(nil)
+
+			return delta.Bytes()
+		}
+
+		patch := func(delta []byte) (string, error) {
+			out := bytes.NewBuffer(nil)
+			err := PatchWithConfig(context.Background(), strings.NewReader(base), bytes.NewReader(delta), out, &PatchConfig{
+				DecryptKey: key,
+			})
+
+			return out.String(), err
+		}
+
+		g.It("should patch with the key it was encrypted with", func() {
+			encrypted := delta()
+			g.Assert(deltacrypt.IsEncrypted(encrypted)).IsTrue()
+			g.Assert(bytes.Contains(encrypted, []byte("a secret change"))).IsFalse()
+
+			out, err := patch(encrypted)
+			g.Assert(err).Equal(nil)
+			g.Assert(out).Equal(target)
+		})
+
+		g.It("should count what encryption adds in the stats", func() {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 64,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			stats := &DeltaStats{}
+			encrypted := bytes.NewBuffer(nil)
+			err = Delta(signature, strings.NewReader(target), encrypted, &DeltaConfig{
+				EncryptKey: key,
+				Stats:      stats,
+			})
+			g.Assert(err).Equal(nil)
+
+			g.Assert(stats.DeltaSize).Equal(int64(encrypted.Len()))
+			g.Assert(stats.CompressionRatio).Equal(float64(encrypted.Len()) / float64(len(target)))
+		})
+
+		g.It("should refuse tampered deltas", func() {
+			tampered := delta()
+			tampered[len(tampered)-20] ^= 1
+
+			_, err := patch(tampered)
+			g.Assert(errors.Is(err, deltacrypt.ErrAuthentication)).IsTrue()
+		})
+
+		g.It("should refuse deltas that aren't encrypted", func() {
+			_, err := patch([]byte{0, 0, 0, 0, 4, 't', 'e', 's', 't'})
+			g.Assert(errors.Is(err, deltacrypt.ErrNotEncrypted)).IsTrue()
+		})
+	})
+}
+
+func TestSignedDeltas(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("signed deltas", func() {
+
+		base := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 100)
+		target := base[:1000] + "an update" + base[1000:]
+
+		public, private, _ := ed25519.GenerateKey(nil)
+		key, _ := deltacrypt.NewKey(bytes.Repeat([]byte{1}, deltacrypt.KEY_SIZE))
+
+		delta := func() []byte {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 64,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, strings.NewReader(target), delta, &DeltaConfig{
+				EncryptKey: key,
+				SignKey:    private,
+			})
+			g.Assert(err).Equal(nil)
+
+			return delta.Bytes()
+		}
+
+		patch := func(delta []byte, trusted []ed25519.PublicKey) (string, error) {
+			out := bytes.NewBuffer(nil)
+			err := PatchWithConfig(context.Background(), strings.NewReader(base), bytes.NewReader(delta), out, &PatchConfig{
+				DecryptKey:  key,
+				TrustedKeys: trusted,
+			})
+
+			return out.String(), err
+		}
+
+		g.It("should patch deltas signed by a trusted key", func() {
+			signed := delta()
+			g.Assert(deltasign.IsSigned(signed)).IsTrue()
+
+			out, err := patch(signed, []ed25519.PublicKey{public})
+			g.Assert(err).Equal(nil)
+			g.Assert(out).Equal(target)
+		})
+
+		g.It("should count the signature in the stats", func() {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 64,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			stats := &DeltaStats{}
+			signed := bytes.NewBuffer(nil)
+			err = Delta(signature, strings.NewReader(target), signed, &DeltaConfig{
+				EncryptKey: key,
+				SignKey:    private,
+				Stats:      stats,
+			})
+			g.Assert(err).Equal(nil)
+
+			g.Assert(stats.DeltaSize).Equal(int64(signed.Len()))
+		})
+
+		g.It("should write nothing for deltas that fail the check", func() {
+			other, _, _ := ed25519.GenerateKey(nil)
+
+			out, err := patch(delta(), []ed25519.PublicKey{other})
+			g.Assert(errors.Is(err, deltasign.ErrUntrusted)).IsTrue()
+			g.Assert(out).Equal("")
+
+			tampered := delta()
+			tampered[len(tampered)/2] ^= 1
+
+			out, err = patch(tampered, []ed25519.PublicKey{public})
+			g.Assert(errors.Is(err, deltasign.ErrBadSignature)).IsTrue()
+			g.Assert(out).Equal("")
+		})
+	})
+}
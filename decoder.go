@@ -0,0 +1,231 @@
+package deltadiff
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// DeltaDecoder reads ops one by one from a delta stream.
+type DeltaDecoder struct {
+	r      io.Reader
+	offset int64
+	index  int
+}
+
+func NewDeltaDecoder(r io.Reader) *DeltaDecoder {
+	return &DeltaDecoder{
+		r: r,
+	}
+}
+
+// Offset returns the position in the delta stream where
+// the next op begins.
+func (d *DeltaDecoder) Offset() int64 {
+	return d.offset
+}
+
+// Index returns the position of the next op in the stream.
+func (d *DeltaDecoder) Index() int {
+	return d.index
+}
+
+// Next returns the next op in the stream, or io.EOF when
+// the stream ends cleanly at an op boundary. Other errors are
+// an *OpError.
+func (d *DeltaDecoder) Next() (Op, error) {
+	op, err := d.nextHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if lit, ok := op.(*literal); ok {
+		return d.readLiteral(lit)
+	}
+
+	return op, nil
+}
+
+// nextHeader is like Next, but leaves the data of write ops in
+// the stream and returns a *literal for them, which must be
+// consumed with readLiteral or copyLiteral before moving on.
+func (d *DeltaDecoder) nextHeader() (Op, error) {
+	op, err := d.next()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	if err != nil {
+		return nil, d.fail(err)
+	}
+
+	if _, ok := op.(*literal); !ok {
+		d.index++
+	}
+
+	return op, nil
+}
+
+// readLiteral reads the data of lit into a write op. Memory
+// grows with the data actually read, not with the length the
+// delta claims.
+func (d *DeltaDecoder) readLiteral(lit *literal) (Op, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(d.r, lit.size))
+	if err != nil {
+		return nil, d.fail(err)
+	}
+
+	if int64(len(data)) < lit.size {
+		return nil, d.fail(lit.truncated())
+	}
+
+	d.offset += 6 + lit.size
+	d.index++
+
+	return &WriteOp{
+		Data: data,
+	}, nil
+}
+
+// copyLiteral copies the data of lit to w in chunks. Unlike
+// Next, its errors aren't an *OpError.
+func (d *DeltaDecoder) copyLiteral(lit *literal, w io.Writer) error {
+	if _, err := io.CopyN(w, d.r, lit.size); err != nil {
+		if err == io.EOF {
+			return lit.truncated()
+		}
+
+		return err
+	}
+
+	d.offset += 6 + lit.size
+	d.index++
+
+	return nil
+}
+
+func (d *DeltaDecoder) fail(err error) error {
+	return &OpError{
+		Index:  d.index,
+		Offset: d.offset,
+		Err:    err,
+	}
+}
+
+func (d *DeltaDecoder) next() (Op, error) {
+	opcodeBytes := make([]byte, 2)
+	if err := d.readFull(opcodeBytes); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+
+		return nil, truncated(err, ErrCorruptDelta, "it ends in the middle of an opcode")
+	}
+
+	opcode := binary.BigEndian.Uint16(opcodeBytes)
+
+	switch opcode {
+	case OP_WRITE:
+		return d.nextWrite()
+	case OP_READ:
+		return d.nextRead()
+	case OP_CHECKSUM:
+		return d.nextChecksum()
+	case OP_ABORT:
+		return nil, ErrAborted
+	}
+
+	return nil, fmt.Errorf("%w: unknown opcode %d", ErrCorruptDelta, opcode)
+}
+
+func (d *DeltaDecoder) nextRead() (Op, error) {
+	buffer := make([]byte, 8)
+	if err := d.readFull(buffer); err != nil {
+		return nil, truncated(err, ErrCorruptDelta, "it ends in the middle of a read op")
+	}
+
+	from := binary.BigEndian.Uint32(buffer[0:4])
+	to := binary.BigEndian.Uint32(buffer[4:8])
+
+	if to < from {
+		return nil, fmt.Errorf("%w: invalid read op %d-%d", ErrCorruptDelta, from, to)
+	}
+
+	d.offset += 10
+
+	return &ReadOp{
+		From: int(from),
+		To:   int(to),
+	}, nil
+}
+
+func (d *DeltaDecoder) nextWrite() (Op, error) {
+	datalenBytes := make([]byte, 4)
+	if err := d.readFull(datalenBytes); err != nil {
+		return nil, truncated(err, ErrCorruptDelta, "it ends in the middle of a write op")
+	}
+
+	return &literal{
+		size: int64(binary.BigEndian.Uint32(datalenBytes)),
+	}, nil
+}
+
+func (d *DeltaDecoder) nextChecksum() (Op, error) {
+	digest := make([]byte, sha256.Size)
+	if err := d.readFull(digest); err != nil {
+		return nil, truncated(err, ErrCorruptDelta, "it ends in the middle of a checksum op")
+	}
+
+	d.offset += 2 + sha256.Size
+
+	return &ChecksumOp{
+		Digest: digest,
+	}, nil
+}
+
+// literal is a write op whose data is still in the stream.
+type literal struct {
+	size int64
+}
+
+func (l *literal) Kind() string {
+	return "write"
+}
+
+func (l *literal) Len() int {
+	return int(l.size)
+}
+
+func (l *literal) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("Data of write op wasn't read")
+}
+
+func (l *literal) truncated() error {
+	return fmt.Errorf("%w: it ends in the middle of the %d bytes of a write op", ErrCorruptDelta, l.size)
+}
+
+func (d *DeltaDecoder) readFull(buffer []byte) error {
+	_, err := io.ReadFull(d.r, buffer)
+	return err
+}
+
+// DecodeDelta reads every op of a delta.
+func DecodeDelta(delta io.Reader) ([]Op, error) {
+	decoder := NewDeltaDecoder(delta)
+	ops := make([]Op, 0)
+
+	for {
+		op, err := decoder.Next()
+		if err == io.EOF {
+			return ops, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		ops = append(ops, op)
+	}
+}
@@ -1,12 +1,18 @@
 package deltadiff
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"github.com/xrash/deltadiff/deltacrypt"
+	"github.com/xrash/deltadiff/deltasign"
 	"github.com/xrash/deltadiff/hasher"
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 type match struct {
@@ -16,70 +22,119 @@ type match struct {
 }
 
 type operation struct {
-	// `kind` can be either "read" or "write"
+	// `kind` can be either "read" or "write". Both are ranges,
+	// of base for reads and of target for writes.
 	kind string
 	from int
 	to   int
-	data []byte
 }
 
 type DeltaConfig struct {
 	Debug       bool
 	DebugWriter io.Writer
+
+	// If Stats is not nil, Delta fills it in.
+	Stats *DeltaStats
+
+	// If Progress is not nil, it's called as target is read,
+	// as base blocks are looked for in it, and as the delta is
+	// written.
+	Progress ProgressFunc
+
+	// If Checksum is true, the delta ends with a checksum op
+	// holding the SHA-256 of target, so patching it onto the
+	// wrong base fails instead of giving a wrong result.
+	// Versions of Patch without checksum ops can't read it.
+	Checksum bool
+
+	// If MemoryLimit is positive, Delta keeps roughly under
+	// that many bytes. Targets that don't fit are read from
+	// disk as needed, in place if they're a regular file and
+	// spilled to a temporary file in TempDir otherwise. Delta
+	// fails with ErrMemoryLimit when the signature alone
+	// doesn't fit.
+	MemoryLimit int64
+
+	// TempDir is where targets are spilled, os.TempDir() if
+	// it's empty.
+	TempDir string
+
+	// If EncryptKey is not nil, the delta is encrypted with
+	// it, see the deltacrypt package, and patching it takes the
+	// same key in PatchConfig.DecryptKey.
+	EncryptKey *deltacrypt.Key
+
+	// If SignKey is not nil, the delta is signed with it, see
+	// the deltasign package, after it's encrypted if it is.
+	SignKey ed25519.PrivateKey
 }
 
+// How many target positions are tried between checks for
+// cancellation while looking for a block.
+const CANCEL_CHECK_INTERVAL = 1 << 16
+
 func Delta(signature, target io.Reader, result io.Writer, c *DeltaConfig) error {
+	return DeltaContext(context.Background(), signature, target, result, c)
+}
+
+// DeltaContext is like Delta, but stops once ctx is done and
+// returns ctx.Err(). Cancellation is checked while matching
+// blocks and between ops. Either way, the delta is ended with
+// OP_ABORT, so patching it fails, even when no op was written
+// yet, since an empty delta is a valid one for an empty target.
+func DeltaContext(ctx context.Context, signature, target io.Reader, result io.Writer, c *DeltaConfig) error {
+
+	start := time.Now()
 
 	if c.Debug && c.DebugWriter == nil {
 		c.DebugWriter = os.Stderr
 	}
 
-	hashcode, err := readHashCode(signature)
+	sig, h, err := readSignatureHeader(signature)
 	if err != nil {
 		return err
 	}
 
-	blockSize, err := readBlockSize(signature)
-	if err != nil {
-		return err
+	if sig.BlockSize <= 0 {
+		return fmt.Errorf("%w: invalid block size %d", ErrCorruptSignature, sig.BlockSize)
 	}
 
-	baseSize, err := readBaseSize(signature)
+	budget, window, err := targetBudget(sig, h, c.MemoryLimit)
 	if err != nil {
 		return err
 	}
 
-	h, err := hasher.GetHasherByCode(hashcode)
-	if err != nil {
+	if err := sig.readBlocks(signature, h); err != nil {
 		return err
 	}
 
-	blocks, err := readBlocks(signature, h)
+	src, err := readTarget(target, budget, window, c.TempDir, c.Progress)
 	if err != nil {
 		return err
 	}
 
-	buffer, err := readTarget(target)
-	if err != nil {
-		return err
-	}
+	defer src.Close()
 
 	matches, err := collectMatches(
-		blocks,
-		buffer,
+		ctx,
+		sig,
+		src,
 		h,
-		blockSize,
+		c.Progress,
 	)
 
 	if err != nil {
+		if ctx.Err() != nil {
+			NewDeltaEncoder(result).Abort()
+		}
+
 		return err
 	}
 
 	operations := calculateOperations(
 		matches,
-		buffer,
-		blockSize,
-		baseSize,
+		src.Len(),
+		sig,
 	)
 
 	operations = mergeConsecutiveReads(
@@ -88,46 +143,141 @@ func Delta(signature, target io.Reader, result io.Writer, c *DeltaConfig) error
 
 	if c.Debug {
 		for _, m := range matches {
-			fmt.Printf("match\t%d:%d-%d\n", m.block, m.segmentBegin, m.segmentEnd)
+			fmt.Fprintf(c.DebugWriter, "match\t%d:%d-%d\n", m.block, m.segmentBegin, m.segmentEnd)
 		}
 
 		for _, o := range operations {
-			fmt.Printf("op\t%s:%d-%d\n", o.kind, o.from, o.to)
+			fmt.Fprintf(c.DebugWriter, "op\t%s:%d-%d\n", o.kind, o.from, o.to)
 		}
 	}
 
-	if err := writeDelta(operations, result); err != nil {
-		return fmt.Errorf("Error writing delta: %v", err)
+	var checksum []byte
+	if c.Checksum {
+		digest := sha256.New()
+		if _, err := io.Copy(digest, io.NewSectionReader(src, 0, int64(src.Len()))); err != nil {
+			return err
+		}
+
+		checksum = digest.Sum(nil)
+	}
+
+	written, err := writeWrappedDelta(ctx, operations, src, checksum, result, c)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fmt.Errorf("Error writing delta: %w", err)
+	}
+
+	if c.Stats != nil {
+		c.Stats.collect(matches, operations, src.Len(), len(sig.Blocks))
+		c.Stats.finish(written, start)
 	}
 
 	return nil
 }
 
-func writeDelta(operations []*operation, out io.Writer) error {
+// writeWrappedDelta is writeDelta, through encryption if
+// c.EncryptKey is set and signing if c.SignKey is. A delta that
+// failed is left without its last chunk and its signature, so
+// decrypting and checking it fail.
+func writeWrappedDelta(ctx context.Context, operations []*operation, target source, checksum []byte, out io.Writer, c *DeltaConfig) (int64, error) {
+	// What's written is counted as it leaves, after the
+	// wrappers add their framing, tags and signature.
+	counted := &countingWriter{w: out}
+	out = counted
+
+	// Outermost first, closed in reverse.
+	wrappers := make([]io.WriteCloser, 0, 2)
+
+	if c.SignKey != nil {
+		signed, err := deltasign.NewWriter(out, c.SignKey)
+		if err != nil {
+			return 0, err
+		}
+
+		wrappers = append(wrappers, signed)
+		out = signed
+	}
+
+	if c.EncryptKey != nil {
+		encrypted, err := deltacrypt.NewWriter(out, c.EncryptKey)
+		if err != nil {
+			return 0, err
+		}
+
+		wrappers = append(wrappers, encrypted)
+		out = encrypted
+	}
+
+	if _, err := writeDelta(ctx, operations, target, checksum, out, c.Progress); err != nil {
+		return counted.n, err
+	}
+
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		if err := wrappers[i].Close(); err != nil {
+			return counted.n, err
+		}
+	}
+
+	return counted.n, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// writeDelta encodes operations, with the data of writes
+// taken from target, and, if checksum is not nil, a checksum
+// op after them.
+func writeDelta(ctx context.Context, operations []*operation, target source, checksum []byte, out io.Writer, progress ProgressFunc) (int64, error) {
+	encoder := NewDeltaEncoder(out)
+	done := int64(0)
+
 	for i := 0; i < len(operations); i++ {
-		op := operations[i]
+		if err := ctx.Err(); err != nil {
+			encoder.Abort()
+			return encoder.Offset(), err
+		}
 
-		var opbytes []byte
-		switch op.kind {
+		o := operations[i]
+
+		var err error
+
+		switch o.kind {
 		case "write":
-			opbytes = opWrite(op.data)
+			data := io.NewSectionReader(target, int64(o.from), int64(o.to-o.from))
+			err = encoder.encodeWrite(o.to-o.from, data)
 		case "read":
-			opbytes = opRead(op.from, op.to)
+			err = encoder.Encode(&ReadOp{From: o.from, To: o.to})
 		default:
-			return fmt.Errorf("Unexpected op.kind %s", op.kind)
+			err = fmt.Errorf("Unexpected op.kind %s", o.kind)
 		}
 
-		written, err := out.Write(opbytes)
 		if err != nil {
-			return err
+			return encoder.Offset(), err
 		}
 
-		if written != len(opbytes) {
-			return fmt.Errorf("Couldn't write everything, wrote only %d", written)
+		done += int64(o.to - o.from)
+		progress.report(PHASE_WRITING, done, int64(target.Len()))
+	}
+
+	if checksum != nil {
+		if err := encoder.Encode(&ChecksumOp{Digest: checksum}); err != nil {
+			return encoder.Offset(), err
 		}
 	}
 
-	return nil
+	return encoder.Offset(), nil
 }
 
 func mergeConsecutiveReads(operations []*operation) []*operation {
@@ -155,17 +305,16 @@ func mergeConsecutiveReads(operations []*operation) []*operation {
 	return ops
 }
 
-func calculateOperations(matches []*match, target []byte, blockSize, baseSize int) []*operation {
+func calculateOperations(matches []*match, targetSize int, sig *SignatureFile) []*operation {
 	ops := make([]*operation, 0)
 
 	if len(matches) == 0 {
 		from := 0
-		to := len(target)
+		to := targetSize
 		op := &operation{
 			kind: "write",
 			from: from,
 			to:   to,
-			data: target[from:to],
 		}
 		ops = append(ops, op)
 		return ops
@@ -174,14 +323,13 @@ func calculateOperations(matches []*match, target []byte, blockSize, baseSize in
 	for i := 0; i < len(matches); i++ {
 		match := matches[i]
 
-		if i == 0 && match.block > 0 {
+		if i == 0 && match.segmentBegin > 0 {
 			from := 0
 			to := match.segmentBegin
 			op := &operation{
 				kind: "write",
 				from: from,
 				to:   to,
-				data: target[from:to],
 			}
 			ops = append(ops, op)
 		}
@@ -193,17 +341,11 @@ func calculateOperations(matches []*match, target []byte, blockSize, baseSize in
 				kind: "write",
 				from: from,
 				to:   to,
-				data: target[from:to],
 			}
 			ops = append(ops, op)
 		}
 
-		from := match.block * blockSize
-		to := match.block*blockSize + blockSize
-
-		if to > baseSize {
-			to = baseSize
-		}
+		from, to := sig.BlockBounds(match.block)
 
 		op := &operation{
 			kind: "read",
@@ -214,14 +356,13 @@ func calculateOperations(matches []*match, target []byte, blockSize, baseSize in
 		ops = append(ops, op)
 	}
 
-	if matches[len(matches)-1].segmentEnd != len(target) {
+	if matches[len(matches)-1].segmentEnd != targetSize {
 		from := matches[len(matches)-1].segmentEnd
-		to := len(target)
+		to := targetSize
 		op := &operation{
 			kind: "write",
 			from: from,
 			to:   to,
-			data: target[from:to],
 		}
 		ops = append(ops, op)
 	}
@@ -229,7 +370,15 @@ func calculateOperations(matches []*match, target []byte, blockSize, baseSize in
 	return ops
 }
 
-func collectMatches(signature [][]byte, target []byte, h hasher.Hasher, blockSize int) ([]*match, error) {
+func collectMatches(
+	ctx context.Context,
+	sig *SignatureFile,
+	target source,
+	h hasher.Hasher,
+	progress ProgressFunc,
+) ([]*match, error) {
+
+	signature := sig.Blocks
 
 	matches := make([]*match, 0)
 
@@ -240,21 +389,41 @@ func collectMatches(signature [][]byte, target []byte, h hasher.Hasher, blockSiz
 			return matches, nil
 		}
 
-		segmentBegin := anchor
-		segmentEnd := segmentBegin + blockSize
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// The last block of base may be shorter than the others,
+		// and CDC blocks vary in length, and so does the window
+		// each is looked for with.
+		from, to := sig.BlockBounds(block)
+		size := to - from
 
-		if segmentEnd > len(target) {
-			segmentEnd = len(target)
+		if size <= 0 {
+			return nil, fmt.Errorf("%w: block %d is empty", ErrCorruptSignature, block)
 		}
 
+		segmentBegin := anchor
+		segmentEnd := segmentBegin + size
+
 		h.Reset()
 
-		for {
-			if (segmentEnd) > len(target) {
+		for tries := 1; ; tries++ {
+			if segmentEnd > target.Len() {
 				break
 			}
 
-			segment := target[segmentBegin:segmentEnd]
+			if tries%CANCEL_CHECK_INTERVAL == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+
+			segment, err := target.Slice(segmentBegin, segmentEnd)
+			if err != nil {
+				return nil, err
+			}
+
 			hashedSegment, err := h.Hash(segment)
 			if err != nil {
 				return nil, err
@@ -274,6 +443,8 @@ func collectMatches(signature [][]byte, target []byte, h hasher.Hasher, blockSiz
 			segmentBegin++
 			segmentEnd++
 		}
+
+		progress.report(PHASE_MATCHING, int64(to), int64(sig.BaseSize))
 	}
 
 	return matches, nil
@@ -281,13 +452,8 @@ func collectMatches(signature [][]byte, target []byte, h hasher.Hasher, blockSiz
 
 func readHashCode(signature io.Reader) ([]byte, error) {
 	buffer := make([]byte, 2)
-	read, err := signature.Read(buffer)
-	if err != nil {
-		return nil, err
-	}
-
-	if read != len(buffer) {
-		return nil, fmt.Errorf("Read %d instead of expected hash code len %d", read, len(buffer))
+	if _, err := io.ReadFull(signature, buffer); err != nil {
+		return nil, truncated(err, ErrCorruptSignature, "it ends in the hasher code")
 	}
 
 	return buffer, nil
@@ -295,13 +461,8 @@ func readHashCode(signature io.Reader) ([]byte, error) {
 
 func readBlockSize(signature io.Reader) (int, error) {
 	buffer := make([]byte, 4)
-	read, err := signature.Read(buffer)
-	if err != nil {
-		return -1, err
-	}
-
-	if read != len(buffer) {
-		return -1, fmt.Errorf("Read %d instead of expected block size len %d", read, len(buffer))
+	if _, err := io.ReadFull(signature, buffer); err != nil {
+		return -1, truncated(err, ErrCorruptSignature, "it ends in the block size")
 	}
 
 	blockSize := binary.BigEndian.Uint32(buffer)
@@ -311,13 +472,8 @@ func readBlockSize(signature io.Reader) (int, error) {
 
 func readBaseSize(signature io.Reader) (int, error) {
 	buffer := make([]byte, 4)
-	read, err := signature.Read(buffer)
-	if err != nil {
-		return -1, err
-	}
-
-	if read != len(buffer) {
-		return -1, fmt.Errorf("Read %d instead of expected base size len %d", read, len(buffer))
+	if _, err := io.ReadFull(signature, buffer); err != nil {
+		return -1, truncated(err, ErrCorruptSignature, "it ends in the base size")
 	}
 
 	baseSize := binary.BigEndian.Uint32(buffer)
@@ -325,35 +481,47 @@ func readBaseSize(signature io.Reader) (int, error) {
 	return int(baseSize), nil
 }
 
+// readBlocks reads block hashes until the end of signature,
+// into a single allocation. The header takes the first 10
+// bytes, which offsets count.
 func readBlocks(signature io.Reader, h hasher.Hasher) ([][]byte, error) {
-	blocks := make([][]byte, 0)
+	data, err := ioutil.ReadAll(signature)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		buffer := make([]byte, h.HashSize())
-		read, err := signature.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
+	hashSize := h.HashSize()
 
-		if read > 0 {
-			blocks = append(blocks, buffer)
-		}
+	if len(data)%hashSize != 0 {
+		n := len(data) / hashSize
+		return nil, fmt.Errorf("%w: it ends in the middle of the hash of block %d, at offset %d", ErrCorruptSignature, n, 10+n*hashSize)
+	}
 
-		if err == io.EOF {
-			break
-		}
+	blocks := make([][]byte, 0, len(data)/hashSize)
+
+	for i := 0; i < len(data); i += hashSize {
+		blocks = append(blocks, data[i:i+hashSize:i+hashSize])
 	}
 
 	return blocks, nil
 }
 
-func readTarget(in io.Reader) ([]byte, error) {
-	content, err := ioutil.ReadAll(in)
-	if err != nil {
-		return nil, err
+// progressReader reports how many bytes were read through it.
+type progressReader struct {
+	r        io.Reader
+	phase    string
+	done     int64
+	progress ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.done += int64(n)
+		r.progress.report(r.phase, r.done, -1)
 	}
 
-	return content, nil
+	return n, err
 }
 
 func hashesAreEqual(a, b []byte) bool {
@@ -369,3 +537,21 @@ func hashesAreEqual(a, b []byte) bool {
 
 	return true
 }
+
+// targetBudget returns how much of MemoryLimit is left for the
+// target once the signature is accounted for, 0 meaning there's
+// no limit, and the window to read it through if it's larger.
+func targetBudget(sig *SignatureFile, h hasher.Hasher, limit int64) (int64, int, error) {
+	if limit <= 0 {
+		return 0, 0, nil
+	}
+
+	needed := deltaMemory(sig.blockCount(), h.HashSize(), sig.maxBlockSize())
+	window := spillWindow(sig.maxBlockSize())
+
+	if needed+int64(window) > limit {
+		return 0, 0, fmt.Errorf("%w: the signature alone takes about %d bytes, more than %d", ErrMemoryLimit, needed+int64(window), limit)
+	}
+
+	return limit - needed, window, nil
+}
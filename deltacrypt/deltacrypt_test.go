@@ -0,0 +1,194 @@
+package deltacrypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/franela/goblin"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDeltacrypt(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("deltacrypt", func() {
+
+		key, _ := NewKey(bytes.Repeat([]byte{7}, KEY_SIZE))
+
+		data := make([]byte, 3*CHUNK_SIZE+100)
+		rand.New(rand.NewSource(1)).Read(data)
+
+		encrypt := func(key *Key, data []byte) []byte {
+			out := bytes.NewBuffer(nil)
+
+			w, err := NewWriter(out, key)
+			g.Assert(err).Equal(nil)
+
+			// Odd writes, so chunks don't follow them.
+			for len(data) > 0 {
+				n := 1000
+				if n > len(data) {
+					n = len(data)
+				}
+
+				_, err := w.Write(data[:n])
+				g.Assert(err).Equal(nil)
+				data = data[n:]
+			}
+
+			g.Assert(w.Close()).Equal(nil)
+
+			return out.Bytes()
+		}
+
+		decrypt := func(key *Key, encrypted []byte) ([]byte, error) {
+			r, err := NewReader(bytes.NewReader(encrypted), key)
+			if err != nil {
+				return nil, err
+			}
+
+			return ioutil.ReadAll(r)
+		}
+
+		g.It("should derive keys like PBKDF2 with HMAC-SHA256", func() {
+			g.Assert(hex.EncodeToString(pbkdf2([]byte("passwd"), []byte("salt"), 1, 64))).Equal(
+				"55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+					"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+			)
+		})
+
+		g.It("should decrypt what it encrypts", func() {
+			for _, size := range []int{0, 1, CHUNK_SIZE, CHUNK_SIZE + 1, len(data)} {
+				encrypted := encrypt(key, data[:size])
+				g.Assert(size > 16 && bytes.Contains(encrypted, data[:16])).IsFalse()
+
+				decrypted, err := decrypt(key, encrypted)
+				g.Assert(err).Equal(nil)
+				g.Assert(bytes.Equal(decrypted, data[:size])).IsTrue()
+			}
+		})
+
+		g.It("should decrypt from readers returning short reads", func() {
+			r, err := NewReader(iotest.OneByteReader(bytes.NewReader(encrypt(key, data))), key)
+			g.Assert(err).Equal(nil)
+
+			decrypted, err := ioutil.ReadAll(iotest.HalfReader(r))
+			g.Assert(err).Equal(nil)
+			g.Assert(bytes.Equal(decrypted, data)).IsTrue()
+		})
+
+		g.It("should encrypt the same data differently every time", func() {
+			g.Assert(bytes.Equal(encrypt(key, data[:100]), encrypt(key, data[:100]))).IsFalse()
+		})
+
+		g.It("should work with passphrases", func() {
+			passphrase, err := NewPassphrase([]byte("correct horse battery staple"))
+			g.Assert(err).Equal(nil)
+			passphrase.iterations = 1000
+
+			encrypted := encrypt(passphrase, data[:100])
+
+			decrypted, err := decrypt(passphrase, encrypted)
+			g.Assert(err).Equal(nil)
+			g.Assert(decrypted).Equal(data[:100])
+
+			wrong, _ := NewPassphrase([]byte("incorrect horse battery staple"))
+			_, err = decrypt(wrong, encrypted)
+			g.Assert(errors.Is(err, ErrAuthentication)).IsTrue()
+
+			_, err = decrypt(key, encrypted)
+			g.Assert(errors.Is(err, ErrInvalidKey)).IsTrue()
+		})
+
+		g.It("should refuse keys of the wrong size", func() {
+			_, err := NewKey(make([]byte, 16))
+			g.Assert(errors.Is(err, ErrInvalidKey)).IsTrue()
+
+			_, err = NewPassphrase(nil)
+			g.Assert(errors.Is(err, ErrInvalidKey)).IsTrue()
+		})
+
+		g.It("should refuse the wrong key", func() {
+			other, _ := NewKey(bytes.Repeat([]byte{8}, KEY_SIZE))
+
+			_, err := decrypt(other, encrypt(key, data))
+			g.Assert(errors.Is(err, ErrAuthentication)).IsTrue()
+		})
+
+		g.It("should refuse tampered chunks before returning them", func() {
+			encrypted := encrypt(key, data)
+
+			for _, offset := range []int{HEADER_SIZE - 1, HEADER_SIZE + 100, len(encrypted) - 1} {
+				tampered := append([]byte{}, encrypted...)
+				tampered[offset] ^= 1
+
+				r, err := NewReader(bytes.NewReader(tampered), key)
+				g.Assert(err).Equal(nil)
+
+				read, err := ioutil.ReadAll(r)
+				g.Assert(errors.Is(err, ErrAuthentication)).IsTrue()
+				g.Assert(bytes.Equal(read, data[:len(read)])).IsTrue()
+			}
+		})
+
+		g.It("should refuse streams cut short, even between chunks", func() {
+			encrypted := encrypt(key, data)
+
+			// Without the last chunk, which has the last 100
+			// bytes.
+			last := len(encrypted) - (5 + 100 + 16)
+			g.Assert(encrypted[last]).Equal(FLAG_LAST)
+
+			for _, size := range []int{last, last + 3, len(encrypted) - 1} {
+				_, err := decrypt(key, encrypted[:size])
+				g.Assert(errors.Is(err, ErrAuthentication)).IsTrue()
+			}
+		})
+
+		g.It("should refuse reordered chunks and trailing data", func() {
+			encrypted := encrypt(key, data)
+
+			chunk := 5 + CHUNK_SIZE + 16
+			first := encrypted[HEADER_SIZE : HEADER_SIZE+chunk]
+			second := encrypted[HEADER_SIZE+chunk : HEADER_SIZE+2*chunk]
+
+			reordered := append([]byte{}, encrypted[:HEADER_SIZE]...)
+			reordered = append(reordered, second...)
+			reordered = append(reordered, first...)
+			reordered = append(reordered, encrypted[HEADER_SIZE+2*chunk:]...)
+
+			_, err := decrypt(key, reordered)
+			g.Assert(errors.Is(err, ErrAuthentication)).IsTrue()
+
+			_, err = decrypt(key, append(append([]byte{}, encrypted...), 0))
+			g.Assert(errors.Is(err, ErrAuthentication)).IsTrue()
+		})
+
+		g.It("should refuse headers asking for too much", func() {
+			encrypted := encrypt(key, data[:100])
+
+			huge := append([]byte{}, encrypted...)
+			binary.BigEndian.PutUint32(huge[HEADER_SIZE-4:], MAX_CHUNK_SIZE+1)
+
+			_, err := NewReader(bytes.NewReader(huge), key)
+			g.Assert(errors.Is(err, ErrAuthentication)).IsTrue()
+		})
+
+		g.It("should refuse streams that aren't encrypted", func() {
+			_, err := NewReader(bytes.NewReader([]byte("plain delta, long enough for a header")), key)
+			g.Assert(errors.Is(err, ErrNotEncrypted)).IsTrue()
+
+			_, err = NewReader(bytes.NewReader(nil), key)
+			g.Assert(errors.Is(err, ErrNotEncrypted)).IsTrue()
+
+			_, err = NewReader(iotest.ErrReader(io.ErrClosedPipe), key)
+			g.Assert(err).Equal(io.ErrClosedPipe)
+		})
+	})
+}
@@ -0,0 +1,70 @@
+// Package deltacrypt encrypts deltas, or any other stream, with
+// AES-256-GCM, so they can travel over untrusted channels.
+//
+// A stream begins with a header: MAGIC, the key derivation
+// used, the PBKDF2 iterations, 0 for raw keys, a random salt
+// and the chunk size. The data follows in chunks of that size,
+// but for the last one, each sealed on its own and made of a
+// flag telling whether it's the last, the length of the sealed
+// chunk and the sealed chunk itself. Nonces count chunks and
+// hold the flag, and the header is authenticated along with
+// every chunk, so chunks can't be changed, reordered, dropped
+// or added, and streams can't be cut short, without Reader
+// failing with ErrAuthentication.
+package deltacrypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+const MAGIC = "DDCRYP01"
+
+// Key derivations, see Key.
+const (
+	KDF_RAW    uint8 = 0
+	KDF_PBKDF2 uint8 = 1
+)
+
+const (
+	SALT_SIZE = 16
+
+	// Data is sealed in chunks of CHUNK_SIZE. Readers refuse
+	// streams with chunks larger than MAX_CHUNK_SIZE.
+	CHUNK_SIZE     = 64 << 10
+	MAX_CHUNK_SIZE = 16 << 20
+
+	HEADER_SIZE = len(MAGIC) + 1 + 4 + SALT_SIZE + 4
+)
+
+const (
+	FLAG_MORE uint8 = 0
+	FLAG_LAST uint8 = 1
+)
+
+var (
+	// ErrAuthentication means a stream was tampered with or
+	// cut short, or the key is wrong.
+	ErrAuthentication = errors.New("Authentication failed")
+
+	// ErrInvalidKey means a key can't be used, or is of the
+	// wrong kind for a stream.
+	ErrInvalidKey = errors.New("Invalid key")
+
+	// ErrNotEncrypted means a stream doesn't begin with MAGIC.
+	ErrNotEncrypted = errors.New("Not an encrypted stream")
+)
+
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(MAGIC))
+}
+
+// nonce returns the nonce of the given chunk.
+func nonce(chunk uint64, flag uint8) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[3:11], chunk)
+	n[11] = flag
+
+	return n
+}
@@ -0,0 +1,127 @@
+package deltacrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// KEY_SIZE is the size of raw keys, AES-256 ones.
+const KEY_SIZE = 32
+
+// PBKDF2_ITERATIONS is how many iterations of PBKDF2 with
+// HMAC-SHA256 passphrases go through. Readers refuse more than
+// MAX_PBKDF2_ITERATIONS, so a forged header can't keep them
+// busy for long.
+const (
+	PBKDF2_ITERATIONS     = 600000
+	MAX_PBKDF2_ITERATIONS = 10 * PBKDF2_ITERATIONS
+)
+
+// Key is what streams are encrypted with, either a raw key or
+// a passphrase. Either way, each stream is encrypted with a key
+// of its own, derived from it and a random salt.
+type Key struct {
+	raw        []byte
+	passphrase []byte
+	iterations int
+}
+
+// NewKey returns a raw key, which must be KEY_SIZE bytes of
+// random data.
+func NewKey(raw []byte) (*Key, error) {
+	if len(raw) != KEY_SIZE {
+		return nil, fmt.Errorf("%w: it has %d bytes instead of %d", ErrInvalidKey, len(raw), KEY_SIZE)
+	}
+
+	return &Key{
+		raw: append([]byte{}, raw...),
+	}, nil
+}
+
+// NewPassphrase returns a key derived from passphrase with
+// PBKDF2, which makes guessing it slow, but not impossible, so
+// it should be a long one.
+func NewPassphrase(passphrase []byte) (*Key, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("%w: empty passphrase", ErrInvalidKey)
+	}
+
+	return &Key{
+		passphrase: append([]byte{}, passphrase...),
+		iterations: PBKDF2_ITERATIONS,
+	}, nil
+}
+
+func (k *Key) kdf() uint8 {
+	if k.passphrase != nil {
+		return KDF_PBKDF2
+	}
+
+	return KDF_RAW
+}
+
+// derive returns the key of the stream with the given header
+// fields.
+func (k *Key) derive(kdf uint8, iterations int, salt []byte) ([]byte, error) {
+	if kdf != k.kdf() {
+		if kdf == KDF_PBKDF2 {
+			return nil, fmt.Errorf("%w: it was encrypted with a passphrase, not a raw key", ErrInvalidKey)
+		}
+
+		return nil, fmt.Errorf("%w: it was encrypted with a raw key, not a passphrase", ErrInvalidKey)
+	}
+
+	if kdf == KDF_PBKDF2 {
+		return pbkdf2(k.passphrase, salt, iterations, KEY_SIZE), nil
+	}
+
+	return hkdf(k.raw, salt, []byte("deltadiff stream key"))[:KEY_SIZE], nil
+}
+
+// hkdf is HKDF-SHA256, RFC 5869, for a single block of output.
+func hkdf(secret, salt, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+
+	return expand.Sum(nil)
+}
+
+// pbkdf2 is PBKDF2 with HMAC-SHA256, RFC 8018.
+func pbkdf2(password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	key := make([]byte, 0, size+prf.Size())
+
+	index := make([]byte, 4)
+	u := make([]byte, 0, prf.Size())
+
+	for block := uint32(1); len(key) < size; block++ {
+		binary.BigEndian.PutUint32(index, block)
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(index)
+		u = prf.Sum(u[:0])
+
+		t := append([]byte{}, u...)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:size]
+}
@@ -0,0 +1,151 @@
+package deltacrypt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type reader struct {
+	in        io.Reader
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+	chunk     uint64
+	pending   []byte
+	buffer    []byte
+	done      bool
+	err       error
+}
+
+// NewReader reads the header of a stream encrypted with key
+// from in, and returns a reader that decrypts the rest of it.
+// Chunks are opened one at a time, so nothing the reader
+// returns was tampered with, but a stream that was cut short
+// only fails at its end, so whatever was read from it must be
+// discarded unless the reader got to io.EOF.
+func NewReader(in io.Reader, key *Key) (io.Reader, error) {
+	header := make([]byte, HEADER_SIZE)
+	if _, err := io.ReadFull(in, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: it ends in the header", ErrNotEncrypted)
+		}
+
+		return nil, err
+	}
+
+	if !IsEncrypted(header) {
+		return nil, fmt.Errorf("%w: bad magic %q", ErrNotEncrypted, header[:len(MAGIC)])
+	}
+
+	fields := header[len(MAGIC):]
+	kdf := fields[0]
+	iterations := int(binary.BigEndian.Uint32(fields[1:5]))
+	salt := fields[5 : 5+SALT_SIZE]
+	chunkSize := int(binary.BigEndian.Uint32(fields[5+SALT_SIZE:]))
+
+	if kdf != KDF_RAW && kdf != KDF_PBKDF2 {
+		return nil, fmt.Errorf("%w: unknown key derivation %d", ErrAuthentication, kdf)
+	}
+
+	if kdf == KDF_PBKDF2 && (iterations < 1 || iterations > MAX_PBKDF2_ITERATIONS) {
+		return nil, fmt.Errorf("%w: %d iterations, must be between 1 and %d", ErrAuthentication, iterations, MAX_PBKDF2_ITERATIONS)
+	}
+
+	if chunkSize < 1 || chunkSize > MAX_CHUNK_SIZE {
+		return nil, fmt.Errorf("%w: chunks of %d bytes, must be between 1 and %d", ErrAuthentication, chunkSize, MAX_CHUNK_SIZE)
+	}
+
+	aead, err := newAEAD(key, kdf, iterations, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{
+		in:        in,
+		aead:      aead,
+		header:    header,
+		chunkSize: chunkSize,
+	}, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		if r.done {
+			return 0, io.EOF
+		}
+
+		r.err = r.open()
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+// open reads and opens the next chunk. After the last one,
+// there must be nothing left.
+func (r *reader) open() error {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r.in, prefix); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: it ends before its last chunk", ErrAuthentication)
+		}
+
+		return err
+	}
+
+	flag := prefix[0]
+	size := int(binary.BigEndian.Uint32(prefix[1:]))
+
+	if flag != FLAG_MORE && flag != FLAG_LAST {
+		return fmt.Errorf("%w: chunk %d has unknown flag %d", ErrAuthentication, r.chunk, flag)
+	}
+
+	if size < r.aead.Overhead() || size > r.chunkSize+r.aead.Overhead() {
+		return fmt.Errorf("%w: chunk %d has %d bytes", ErrAuthentication, r.chunk, size)
+	}
+
+	if cap(r.buffer) < size {
+		r.buffer = make([]byte, r.chunkSize+r.aead.Overhead())
+	}
+
+	sealed := r.buffer[:size]
+	if _, err := io.ReadFull(r.in, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: it ends in chunk %d", ErrAuthentication, r.chunk)
+		}
+
+		return err
+	}
+
+	opened, err := r.aead.Open(sealed[:0], nonce(r.chunk, flag), sealed, r.header)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d was tampered with, or the key is wrong", ErrAuthentication, r.chunk)
+	}
+
+	r.chunk++
+	r.pending = opened
+
+	if flag == FLAG_LAST {
+		r.done = true
+
+		trailing, err := io.ReadFull(r.in, make([]byte, 1))
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if trailing > 0 {
+			r.pending = nil
+			return fmt.Errorf("%w: there's data after its last chunk", ErrAuthentication)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package deltacrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+)
+
+var errClosed = errors.New("Writer is closed")
+
+type writer struct {
+	out    io.Writer
+	aead   cipher.AEAD
+	header []byte
+	chunk  uint64
+	buffer []byte
+	sealed []byte
+	err    error
+}
+
+// NewWriter writes the header of a stream encrypted with key
+// to out, and returns a writer that encrypts what's written to
+// it into out. Close must be called once everything was
+// written, or readers take the stream as cut short. It doesn't
+// close out.
+func NewWriter(out io.Writer, key *Key) (io.WriteCloser, error) {
+	salt := make([]byte, SALT_SIZE)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	w := binfmt.NewWriter(buffer)
+	w.Magic(MAGIC)
+	w.Uint8(key.kdf())
+	w.Uint32(uint32(key.iterations))
+	w.Raw(salt)
+	w.Uint32(CHUNK_SIZE)
+	w.Flush()
+
+	header := buffer.Bytes()
+
+	aead, err := newAEAD(key, key.kdf(), key.iterations, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := out.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &writer{
+		out:    out,
+		aead:   aead,
+		header: header,
+		buffer: make([]byte, 0, CHUNK_SIZE),
+		sealed: make([]byte, 0, 5+CHUNK_SIZE+aead.Overhead()),
+	}, nil
+}
+
+func newAEAD(key *Key, kdf uint8, iterations int, salt []byte) (cipher.AEAD, error) {
+	derived, err := key.derive(kdf, iterations, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		if w.err != nil {
+			return written, w.err
+		}
+
+		// A full chunk is only sealed once more data comes,
+		// since until then it may be the last one.
+		if len(w.buffer) == cap(w.buffer) {
+			w.seal(FLAG_MORE)
+			continue
+		}
+
+		n := copy(w.buffer[len(w.buffer):cap(w.buffer)], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals the last chunk, which may be empty.
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	w.seal(FLAG_LAST)
+
+	if w.err == nil {
+		w.err = errClosed
+		return nil
+	}
+
+	return w.err
+}
+
+func (w *writer) seal(flag uint8) {
+	sealed := w.sealed[:5]
+	sealed[0] = flag
+	sealed = w.aead.Seal(sealed, nonce(w.chunk, flag), w.buffer, w.header)
+	binary.BigEndian.PutUint32(sealed[1:5], uint32(len(sealed)-5))
+
+	_, w.err = w.out.Write(sealed)
+
+	w.chunk++
+	w.buffer = w.buffer[:0]
+}
@@ -0,0 +1,160 @@
+package deltahttp
+
+import (
+	"context"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/internal/localfile"
+	"io"
+	"net/http"
+)
+
+type ClientConfig struct {
+	// Client makes the request, http.DefaultClient if it's nil.
+	Client *http.Client
+
+	// Hasher and BlockSize are passed to Signature, see
+	// SignatureConfig.
+	Hasher    string
+	BlockSize int
+
+	// If MaxSize is positive, fetching a resource larger than
+	// it fails, see PatchConfig.MaxOutputSize.
+	MaxSize int64
+
+	// If ETag is not empty, it's sent in If-None-Match, and
+	// nothing is fetched if the resource is still that version.
+	ETag string
+
+	// If Progress is not nil, it's called as the local file is
+	// hashed and patched.
+	Progress deltadiff.ProgressFunc
+}
+
+// FetchResult describes a resource that was fetched.
+type FetchResult struct {
+	// NotModified is set if the resource was still the version
+	// of ClientConfig.ETag, in which case nothing else is.
+	NotModified bool
+
+	// Size is the size of the resource, DeltaSize how many
+	// bytes of delta were received to fetch it.
+	Size      int64
+	DeltaSize int64
+
+	// ETag is the version of the resource local now is, to be
+	// passed in ClientConfig.ETag next time.
+	ETag string
+}
+
+// StatusError is a response with a status other than 200 and
+// 304, such as a resource that doesn't exist.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Server responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Fetch makes the file at local a copy of the resource at url,
+// served by a Handler, receiving only a delta. If local doesn't
+// exist, it's created, and the whole resource is received.
+// local is only replaced once the copy is complete and its
+// checksum matches.
+func Fetch(ctx context.Context, url, local string, c *ClientConfig) (*FetchResult, error) {
+	base, baseSize, err := localfile.OpenBase(local)
+	if err != nil {
+		return nil, err
+	}
+	defer base.Close()
+
+	// The signature is streamed as it's computed.
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := deltadiff.Signature(base, pw, &deltadiff.SignatureConfig{
+			Hasher:    c.Hasher,
+			BlockSize: c.BlockSize,
+			BaseSize:  int(baseSize),
+			Progress:  c.Progress,
+		})
+
+		pw.CloseWithError(err)
+	}()
+
+	response, err := doRequest(ctx, url, pr, c)
+
+	// base can't be used for patching while the signature is
+	// still being computed from it, which stops once the pipe
+	// is closed.
+	pr.Close()
+	<-done
+
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &FetchResult{
+		ETag: response.Header.Get("ETag"),
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		result.NotModified = true
+		return result, nil
+	default:
+		return nil, statusError(response)
+	}
+
+	if _, err := base.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	delta := &localfile.CountingReader{R: response.Body}
+
+	pc := &deltadiff.PatchConfig{
+		MaxOutputSize: c.MaxSize,
+		Progress:      c.Progress,
+	}
+
+	size, err := localfile.Replace(local, func(w io.Writer) error {
+		return deltadiff.PatchWithConfig(ctx, base, delta, w, pc)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Size = size
+	result.DeltaSize = delta.N
+
+	return result, nil
+}
+
+func doRequest(ctx context.Context, url string, signature io.Reader, c *ClientConfig) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", SIGNATURE_CONTENT_TYPE)
+	request.Header.Set("Accept", DELTA_CONTENT_TYPE)
+
+	if c.ETag != "" {
+		request.Header.Set("If-None-Match", c.ETag)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return client.Do(request)
+}
@@ -0,0 +1,151 @@
+package deltahttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/franela/goblin"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeltaHTTP(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("deltahttp", func() {
+
+		random := rand.New(rand.NewSource(44))
+
+		content := make([]byte, 100000)
+		random.Read(content)
+
+		root := t.TempDir()
+		local := t.TempDir()
+
+		err := ioutil.WriteFile(filepath.Join(root, "file"), content, 0644)
+		g.Assert(err).Equal(nil)
+
+		handler := &Handler{
+			FS: http.Dir(root),
+		}
+
+		server := httptest.NewServer(handler)
+
+		g.After(func() {
+			server.Close()
+		})
+
+		config := func() *ClientConfig {
+			return &ClientConfig{
+				Client:    server.Client(),
+				Hasher:    "polyroll",
+				BlockSize: 1024,
+			}
+		}
+
+		g.It("should create files that don't exist locally", func() {
+			filename := filepath.Join(local, "new")
+
+			result, err := Fetch(context.Background(), server.URL+"/file", filename, config())
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Size).Equal(int64(len(content)))
+			g.Assert(result.ETag != "").IsTrue()
+
+			fetched, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(fetched).Equal(content)
+		})
+
+		g.It("should only receive what changed", func() {
+			filename := filepath.Join(local, "changed")
+
+			changed := append([]byte(nil), content...)
+			copy(changed[50000:], "something changed here")
+
+			err := ioutil.WriteFile(filename, changed, 0644)
+			g.Assert(err).Equal(nil)
+
+			result, err := Fetch(context.Background(), server.URL+"/file", filename, config())
+			g.Assert(err).Equal(nil)
+			g.Assert(result.DeltaSize < 4096).IsTrue()
+
+			fetched, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(fetched).Equal(content)
+		})
+
+		g.It("should not fetch what's still the same version", func() {
+			filename := filepath.Join(local, "same")
+
+			result, err := Fetch(context.Background(), server.URL+"/file", filename, config())
+			g.Assert(err).Equal(nil)
+
+			c := config()
+			c.ETag = result.ETag
+
+			result, err = Fetch(context.Background(), server.URL+"/file", filename, c)
+			g.Assert(err).Equal(nil)
+			g.Assert(result.NotModified).IsTrue()
+			g.Assert(result.DeltaSize).Equal(int64(0))
+		})
+
+		g.It("should report missing resources", func() {
+			_, err := Fetch(context.Background(), server.URL+"/missing", filepath.Join(local, "missing"), config())
+
+			var status *StatusError
+			g.Assert(errors.As(err, &status)).IsTrue()
+			g.Assert(status.StatusCode).Equal(http.StatusNotFound)
+		})
+
+		g.It("should only allow POST", func() {
+			response, err := server.Client().Get(server.URL + "/file")
+			g.Assert(err).Equal(nil)
+			response.Body.Close()
+
+			g.Assert(response.StatusCode).Equal(http.StatusMethodNotAllowed)
+			g.Assert(response.Header.Get("Allow")).Equal(http.MethodPost)
+		})
+
+		g.It("should reject corrupt signatures", func() {
+			response, err := server.Client().Post(server.URL+"/file", SIGNATURE_CONTENT_TYPE, bytes.NewReader([]byte{0, 1}))
+			g.Assert(err).Equal(nil)
+			response.Body.Close()
+
+			g.Assert(response.StatusCode).Equal(http.StatusBadRequest)
+		})
+
+		g.It("should reject other content types", func() {
+			response, err := server.Client().Post(server.URL+"/file", "text/plain", bytes.NewReader(nil))
+			g.Assert(err).Equal(nil)
+			response.Body.Close()
+
+			g.Assert(response.StatusCode).Equal(http.StatusUnsupportedMediaType)
+		})
+
+		g.It("should reject signatures larger than the limit", func() {
+			small := httptest.NewServer(&Handler{
+				FS:               http.Dir(root),
+				MaxSignatureSize: 100,
+			})
+			defer small.Close()
+
+			filename := filepath.Join(local, "large")
+			err := ioutil.WriteFile(filename, content, 0644)
+			g.Assert(err).Equal(nil)
+
+			c := config()
+			c.Client = small.Client()
+
+			_, err = Fetch(context.Background(), small.URL+"/file", filename, c)
+
+			var status *StatusError
+			g.Assert(errors.As(err, &status)).IsTrue()
+			g.Assert(status.StatusCode).Equal(http.StatusRequestEntityTooLarge)
+		})
+	})
+}
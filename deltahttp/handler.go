@@ -0,0 +1,232 @@
+// Package deltahttp serves deltas over HTTP: clients POST the
+// signature of their copy of a resource to its URL, and get
+// back the delta that turns it into the server's copy.
+//
+// Responses carry an ETag and Last-Modified describing the
+// version of the resource, and a client that sends the ETag it
+// got last time in If-None-Match gets a 304 if it hasn't
+// changed, without sending a signature at all.
+package deltahttp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	SIGNATURE_CONTENT_TYPE = "application/x-deltadiff-signature"
+	DELTA_CONTENT_TYPE     = "application/x-deltadiff-delta"
+)
+
+// Signatures larger than this are rejected, unless
+// Handler.MaxSignatureSize says otherwise.
+const DEFAULT_MAX_SIGNATURE_SIZE = 64 << 20
+
+// Handler serves deltas of the files in FS.
+type Handler struct {
+	// FS holds the resources, named by the path of the URL, as
+	// with http.FileServer. Directories aren't served.
+	FS http.FileSystem
+
+	// Signatures larger than MaxSignatureSize are rejected with
+	// a 413. If it's 0, DEFAULT_MAX_SIGNATURE_SIZE is used, and
+	// if it's negative, there's no limit.
+	MaxSignatureSize int64
+
+	// MemoryLimit is passed to Delta, see DeltaConfig.
+	MemoryLimit int64
+
+	// If ErrorLog is not nil, errors computing deltas are
+	// logged to it.
+	ErrorLog *log.Logger
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Signatures must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != SIGNATURE_CONTENT_TYPE {
+			http.Error(w, fmt.Sprintf("Content type must be %s", SIGNATURE_CONTENT_TYPE), http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	name := r.URL.Path
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+
+	file, err := h.FS.Open(path.Clean(name))
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	etag := entityTag(info)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+
+	if matchesEntityTag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Every delta depends on the signature it was made from.
+	w.Header().Set("Cache-Control", "no-store")
+
+	signature := &limitedReader{
+		r:         r.Body,
+		remaining: h.maxSignatureSize(),
+	}
+
+	out := &deltaWriter{w: w}
+
+	c := &deltadiff.DeltaConfig{
+		Checksum:    true,
+		MemoryLimit: h.MemoryLimit,
+	}
+
+	err = deltadiff.DeltaContext(r.Context(), signature, file, out, c)
+	if err == nil {
+		out.start()
+		return
+	}
+
+	h.logf("Error serving %s: %v", name, err)
+
+	// Once the delta has begun, all that can be done is cutting
+	// it short, which the client notices.
+	if out.started {
+		panic(http.ErrAbortHandler)
+	}
+
+	switch {
+	case signature.exceeded || errors.Is(err, deltadiff.ErrMemoryLimit):
+		http.Error(w, "Signature too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, deltadiff.ErrCorruptSignature) || errors.Is(err, deltadiff.ErrUnknownHasher):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Error computing delta", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) maxSignatureSize() int64 {
+	if h.MaxSignatureSize == 0 {
+		return DEFAULT_MAX_SIGNATURE_SIZE
+	}
+
+	return h.MaxSignatureSize
+}
+
+// error answers with the status an error opening a file calls
+// for, without telling more about it.
+func (h *Handler) error(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case os.IsPermission(err):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		h.logf("Error opening file: %v", err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	}
+}
+
+// entityTag identifies a version of a file by its size and
+// modification time, like most servers do. It's weak, since two
+// versions could have both in common.
+func entityTag(info os.FileInfo) string {
+	return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+func matchesEntityTag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deltaWriter only sends the headers once the delta begins, so
+// that errors before that get a proper status.
+type deltaWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (dw *deltaWriter) start() {
+	if dw.started {
+		return
+	}
+
+	dw.w.Header().Set("Content-Type", DELTA_CONTENT_TYPE)
+	dw.w.WriteHeader(http.StatusOK)
+	dw.started = true
+}
+
+func (dw *deltaWriter) Write(p []byte) (int, error) {
+	dw.start()
+	return dw.w.Write(p)
+}
+
+// limitedReader fails once more than remaining bytes are read,
+// unless remaining is negative.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.remaining < 0 {
+		return lr.r.Read(p)
+	}
+
+	if int64(len(p)) > lr.remaining+1 {
+		p = p[:lr.remaining+1]
+	}
+
+	n, err := lr.r.Read(p)
+	if int64(n) > lr.remaining {
+		lr.exceeded = true
+		return 0, errors.New("Signature too large")
+	}
+
+	lr.remaining -= int64(n)
+
+	return n, err
+}
@@ -0,0 +1,294 @@
+package deltahttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/internal/localfile"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// SIGNATURE_SUFFIX is appended to the URL of a resource to get
+// the URL of its signature, unless RangeConfig says otherwise.
+const SIGNATURE_SUFFIX = ".sig"
+
+type RangeConfig struct {
+	// Client makes the requests, http.DefaultClient if it's nil.
+	Client *http.Client
+
+	// SignatureURL is where the signature of the resource is,
+	// its URL followed by SIGNATURE_SUFFIX if it's empty.
+	SignatureURL string
+
+	// If Checksum is not nil, it's the SHA-256 of the resource,
+	// and local is only replaced if the copy matches it.
+	Checksum []byte
+
+	// If MaxSize is positive, fetching a resource larger than
+	// it fails with ErrLimitExceeded.
+	MaxSize int64
+
+	// MemoryLimit and TempDir are passed to MatchBlocks, see
+	// MatchConfig.
+	MemoryLimit int64
+	TempDir     string
+
+	// If Progress is not nil, it's called as the local file is
+	// matched and the copy is written.
+	Progress deltadiff.ProgressFunc
+}
+
+// RangeResult describes a resource that was fetched.
+type RangeResult struct {
+	Size int64
+
+	// ReusedBytes is how much of the resource was found in the
+	// local file, DownloadedBytes how much was downloaded, in
+	// Requests range requests.
+	ReusedBytes     int64
+	DownloadedBytes int64
+	Requests        int
+}
+
+// FetchRanges makes the file at local a copy of the resource at
+// url, hosted by any HTTP server that supports range requests,
+// next to its signature. The signature is matched against local
+// to find the blocks that can be reused, and the others are
+// downloaded with range requests, contiguous ones together.
+//
+// Blocks are only matched by hash, so the copy is only as
+// reliable as the hasher of the signature, unless c.Checksum is
+// given.
+func FetchRanges(ctx context.Context, url, local string, c *RangeConfig) (*RangeResult, error) {
+	f := &rangeFetcher{
+		ctx: ctx,
+		url: url,
+		c:   c,
+	}
+
+	s, err := f.signature()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MaxSize > 0 && int64(s.BaseSize) > c.MaxSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes, more than %d", deltadiff.ErrLimitExceeded, url, s.BaseSize, c.MaxSize)
+	}
+
+	base, _, err := localfile.OpenBase(local)
+	if err != nil {
+		return nil, err
+	}
+	defer base.Close()
+
+	matches, err := deltadiff.MatchBlocks(ctx, s, base, &deltadiff.MatchConfig{
+		Progress:    c.Progress,
+		MemoryLimit: c.MemoryLimit,
+		TempDir:     c.TempDir,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[int]int64, len(matches))
+	for _, m := range matches {
+		found[m.Block] = m.Offset
+	}
+
+	result := &RangeResult{}
+	digest := sha256.New()
+
+	size, err := localfile.Replace(local, func(w io.Writer) error {
+		out := &progressWriter{
+			w:        io.MultiWriter(w, digest),
+			total:    int64(s.BaseSize),
+			progress: c.Progress,
+		}
+
+		blocks := len(s.Blocks)
+
+		for block := 0; block < blocks; {
+			from, to := blockRange(s, block)
+
+			if offset, ok := found[block]; ok {
+				if _, err := io.Copy(out, io.NewSectionReader(base, offset, to-from)); err != nil {
+					return err
+				}
+
+				result.ReusedBytes += to - from
+				block++
+				continue
+			}
+
+			// Blocks that weren't found are downloaded with the
+			// ones that follow, up to the next found one.
+			for block++; block < blocks; block++ {
+				if _, ok := found[block]; ok {
+					break
+				}
+
+				_, to = blockRange(s, block)
+			}
+
+			if err := f.fetchRange(from, to, int64(s.BaseSize), out); err != nil {
+				return err
+			}
+
+			result.DownloadedBytes += to - from
+			result.Requests++
+		}
+
+		if c.Checksum != nil && !bytes.Equal(digest.Sum(nil), c.Checksum) {
+			return fmt.Errorf("%w: copy of %s is %x, expected %x", deltadiff.ErrChecksumMismatch, url, digest.Sum(nil), c.Checksum)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Size = size
+
+	return result, nil
+}
+
+func blockRange(s *deltadiff.SignatureFile, block int) (int64, int64) {
+	from, to := s.BlockBounds(block)
+	return int64(from), int64(to)
+}
+
+type rangeFetcher struct {
+	ctx context.Context
+	url string
+	c   *RangeConfig
+
+	// version is the ETag and Last-Modified of the first
+	// response, which the others must have too.
+	version string
+}
+
+func (f *rangeFetcher) get(url string, header http.Header) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(f.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	client := f.c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return client.Do(request)
+}
+
+func (f *rangeFetcher) signature() (*deltadiff.SignatureFile, error) {
+	url := f.c.SignatureURL
+	if url == "" {
+		url = f.url + SIGNATURE_SUFFIX
+	}
+
+	response, err := f.get(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(response)
+	}
+
+	s, err := deltadiff.ReadSignatureFile(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading signature %s: %w", url, err)
+	}
+
+	return s, nil
+}
+
+// fetchRange writes bytes from to to of the resource to w.
+func (f *rangeFetcher) fetchRange(from, to, size int64, w io.Writer) error {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to-1))
+
+	response, err := f.get(f.url, header)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		expected := fmt.Sprintf("bytes %d-%d/%d", from, to-1, size)
+		if got := response.Header.Get("Content-Range"); got != expected {
+			return fmt.Errorf("%s doesn't match its signature, got range %q, expected %q", f.url, got, expected)
+		}
+
+	case http.StatusOK:
+		// A server without range requests is fine, as long as
+		// the whole resource is what's needed.
+		if from != 0 || to != size || response.ContentLength != size {
+			return fmt.Errorf("%s can't be fetched by ranges, the server doesn't support them", f.url)
+		}
+
+	default:
+		return statusError(response)
+	}
+
+	version := response.Header.Get("ETag") + " " + response.Header.Get("Last-Modified")
+	if f.version == "" {
+		f.version = version
+	}
+
+	if version != f.version {
+		return fmt.Errorf("%s changed while it was being fetched", f.url)
+	}
+
+	if _, err := io.CopyN(w, response.Body, to-from); err != nil {
+		return fmt.Errorf("Error fetching %s: %w", f.url, err)
+	}
+
+	return nil
+}
+
+func statusError(response *http.Response) error {
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+
+	return &StatusError{
+		StatusCode: response.StatusCode,
+		Message:    strings.TrimSpace(string(message)),
+	}
+}
+
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress deltadiff.ProgressFunc
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+
+	if pw.progress != nil {
+		pw.progress(deltadiff.Progress{
+			Phase: deltadiff.PHASE_PATCHING,
+			Done:  pw.done,
+			Total: pw.total,
+		})
+	}
+
+	return n, err
+}
@@ -0,0 +1,128 @@
+package deltahttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchRanges(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("FetchRanges", func() {
+
+		random := rand.New(rand.NewSource(45))
+
+		content := make([]byte, 100000)
+		random.Read(content)
+
+		root := t.TempDir()
+		local := t.TempDir()
+
+		signature := bytes.NewBuffer(nil)
+		err := deltadiff.Signature(bytes.NewReader(content), signature, &deltadiff.SignatureConfig{
+			Hasher:    "polyroll",
+			BlockSize: 1024,
+			BaseSize:  len(content),
+		})
+		g.Assert(err).Equal(nil)
+
+		g.Assert(ioutil.WriteFile(filepath.Join(root, "file"), content, 0644)).Equal(nil)
+		g.Assert(ioutil.WriteFile(filepath.Join(root, "file.sig"), signature.Bytes(), 0644)).Equal(nil)
+
+		// A signature of something else, as if it were stale.
+		g.Assert(ioutil.WriteFile(filepath.Join(root, "stale"), content[:50000], 0644)).Equal(nil)
+		g.Assert(ioutil.WriteFile(filepath.Join(root, "stale.sig"), signature.Bytes(), 0644)).Equal(nil)
+
+		server := httptest.NewServer(http.FileServer(http.Dir(root)))
+
+		g.After(func() {
+			server.Close()
+		})
+
+		digest := sha256.Sum256(content)
+
+		config := func() *RangeConfig {
+			return &RangeConfig{
+				Client:   server.Client(),
+				Checksum: digest[:],
+			}
+		}
+
+		g.It("should download everything when there's no local file", func() {
+			filename := filepath.Join(local, "new")
+
+			result, err := FetchRanges(context.Background(), server.URL+"/file", filename, config())
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Size).Equal(int64(len(content)))
+			g.Assert(result.DownloadedBytes).Equal(int64(len(content)))
+			g.Assert(result.Requests).Equal(1)
+
+			fetched, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(fetched).Equal(content)
+		})
+
+		g.It("should only download the blocks that changed", func() {
+			filename := filepath.Join(local, "changed")
+
+			// Shifted by a new beginning, and changed across two
+			// blocks, the ones at 60416 and 61440.
+			changed := append([]byte("a new beginning"), content...)
+			copy(changed[15+61430:], "something changed here")
+
+			g.Assert(ioutil.WriteFile(filename, changed, 0644)).Equal(nil)
+
+			result, err := FetchRanges(context.Background(), server.URL+"/file", filename, config())
+			g.Assert(err).Equal(nil)
+			g.Assert(result.DownloadedBytes).Equal(int64(2048))
+			g.Assert(result.ReusedBytes).Equal(int64(len(content) - 2048))
+			g.Assert(result.Requests).Equal(1)
+
+			fetched, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(fetched).Equal(content)
+		})
+
+		g.It("should leave local alone if the checksum doesn't match", func() {
+			filename := filepath.Join(local, "mismatch")
+			g.Assert(ioutil.WriteFile(filename, []byte("local"), 0644)).Equal(nil)
+
+			c := config()
+			c.Checksum = make([]byte, 32)
+
+			_, err := FetchRanges(context.Background(), server.URL+"/file", filename, c)
+			g.Assert(errors.Is(err, deltadiff.ErrChecksumMismatch)).IsTrue()
+
+			kept, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(kept).Equal([]byte("local"))
+		})
+
+		g.It("should notice signatures that don't match the resource", func() {
+			c := config()
+			c.Checksum = nil
+
+			_, err := FetchRanges(context.Background(), server.URL+"/stale", filepath.Join(local, "stale"), c)
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("should report missing signatures", func() {
+			_, err := FetchRanges(context.Background(), server.URL+"/missing", filepath.Join(local, "missing"), config())
+
+			var status *StatusError
+			g.Assert(errors.As(err, &status)).IsTrue()
+			g.Assert(status.StatusCode).Equal(http.StatusNotFound)
+		})
+	})
+}
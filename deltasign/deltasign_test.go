@@ -0,0 +1,127 @@
+package deltasign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"github.com/franela/goblin"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDeltasign(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("deltasign", func() {
+
+		public, private, _ := ed25519.GenerateKey(nil)
+		otherPublic, otherPrivate, _ := ed25519.GenerateKey(nil)
+
+		content := bytes.Repeat([]byte("a delta from the release server. "), 1000)
+
+		dir, _ := ioutil.TempDir("", "deltasign-test-")
+
+		g.After(func() {
+			os.RemoveAll(dir)
+		})
+
+		sign := func(key ed25519.PrivateKey, content []byte) []byte {
+			signed := bytes.NewBuffer(nil)
+			g.Assert(Sign(bytes.NewReader(content), signed, key)).Equal(nil)
+
+			return signed.Bytes()
+		}
+
+		open := func(signed []byte, keys ...ed25519.PublicKey) ([]byte, error) {
+			c, err := Open(bytes.NewReader(signed), keys, dir)
+			if err != nil {
+				return nil, err
+			}
+			defer c.Close()
+
+			g.Assert(c.Signer).Equal(keys[0])
+
+			return ioutil.ReadAll(c)
+		}
+
+		tempFiles := func() int {
+			entries, _ := ioutil.ReadDir(dir)
+			return len(entries)
+		}
+
+		g.It("should open what it signs", func() {
+			signed := sign(private, content)
+			g.Assert(IsSigned(signed)).IsTrue()
+			g.Assert(len(signed)).Equal(HEADER_SIZE + len(content) + ed25519.SignatureSize)
+
+			opened, err := open(signed, public, otherPublic)
+			g.Assert(err).Equal(nil)
+			g.Assert(opened).Equal(content)
+
+			opened, err = open(sign(private, nil), public)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(opened)).Equal(0)
+
+			g.Assert(tempFiles()).Equal(0)
+		})
+
+		g.It("should refuse untrusted keys", func() {
+			_, err := open(sign(otherPrivate, content), public)
+			g.Assert(errors.Is(err, ErrUntrusted)).IsTrue()
+
+			_, err = Open(bytes.NewReader(sign(private, content)), nil, dir)
+			g.Assert(errors.Is(err, ErrUntrusted)).IsTrue()
+
+			g.Assert(tempFiles()).Equal(0)
+		})
+
+		g.It("should refuse anything tampered with", func() {
+			signed := sign(private, content)
+
+			for _, offset := range []int{len(MAGIC), HEADER_SIZE, HEADER_SIZE + 1000, len(signed) - 1} {
+				tampered := append([]byte{}, signed...)
+				tampered[offset] ^= 1
+
+				_, err := open(tampered, public)
+				g.Assert(errors.Is(err, ErrBadSignature) || errors.Is(err, ErrUntrusted)).IsTrue()
+			}
+
+			_, err := open(signed[:len(signed)-1], public)
+			g.Assert(errors.Is(err, ErrBadSignature)).IsTrue()
+
+			_, err = open(append(append([]byte{}, signed...), 0), public)
+			g.Assert(errors.Is(err, ErrBadSignature)).IsTrue()
+
+			g.Assert(tempFiles()).Equal(0)
+		})
+
+		g.It("should refuse streams that aren't signed", func() {
+			_, err := open(content, public)
+			g.Assert(errors.Is(err, ErrNotSigned)).IsTrue()
+
+			_, err = open([]byte(MAGIC), public)
+			g.Assert(errors.Is(err, ErrNotSigned)).IsTrue()
+		})
+
+		g.It("should parse the key files it writes", func() {
+			parsed, err := ParsePrivateKey(MarshalPrivateKey(private))
+			g.Assert(err).Equal(nil)
+			g.Assert(parsed).Equal(private)
+
+			keys := append([]byte("# release keys\n\n"), MarshalPublicKey(public)...)
+			keys = append(keys, MarshalPublicKey(otherPublic)...)
+
+			trusted, err := ParsePublicKeys(keys)
+			g.Assert(err).Equal(nil)
+			g.Assert(trusted).Equal([]ed25519.PublicKey{public, otherPublic})
+
+			_, err = ParsePublicKeys([]byte("# nothing\n"))
+			g.Assert(errors.Is(err, ErrInvalidKey)).IsTrue()
+
+			_, err = ParsePrivateKey([]byte("abcd\n"))
+			g.Assert(errors.Is(err, ErrInvalidKey)).IsTrue()
+		})
+	})
+}
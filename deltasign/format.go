@@ -0,0 +1,69 @@
+// Package deltasign signs deltas, or any other stream, with
+// ed25519, so they can be checked to come from whoever holds
+// the private key before they're used.
+//
+// A signed stream begins with a header, MAGIC and the ID of the
+// key it was signed with, followed by the content as is, and
+// ends with the signature. What's signed is SIGNING_CONTEXT
+// followed by the SHA-512 of the header and the content, so
+// signing and checking can be streamed.
+package deltasign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+)
+
+const MAGIC = "DDSGND01"
+
+// SIGNING_CONTEXT keeps signatures of streams from being
+// taken for signatures of anything else made with the same key.
+const SIGNING_CONTEXT = "deltadiff signed stream v1\x00"
+
+const (
+	KEY_ID_SIZE = 8
+	HEADER_SIZE = len(MAGIC) + KEY_ID_SIZE
+)
+
+var (
+	// ErrNotSigned means a stream doesn't begin with MAGIC.
+	ErrNotSigned = errors.New("Not a signed stream")
+
+	// ErrUntrusted means a stream was signed with a key that
+	// isn't among the trusted ones.
+	ErrUntrusted = errors.New("Signed with an untrusted key")
+
+	// ErrBadSignature means a stream was tampered with after
+	// it was signed, or its signature was forged.
+	ErrBadSignature = errors.New("Bad signature")
+
+	// ErrInvalidKey means a key file can't be parsed.
+	ErrInvalidKey = errors.New("Invalid key")
+)
+
+func IsSigned(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(MAGIC))
+}
+
+// KeyID returns the ID signed streams name key by.
+func KeyID(key ed25519.PublicKey) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:KEY_ID_SIZE]
+}
+
+func header(key ed25519.PublicKey) []byte {
+	return append([]byte(MAGIC), KeyID(key)...)
+}
+
+// message returns what's signed for a stream hashed by digest.
+func message(digest hash.Hash) []byte {
+	return digest.Sum([]byte(SIGNING_CONTEXT))
+}
+
+func newDigest() hash.Hash {
+	return sha512.New()
+}
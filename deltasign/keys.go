@@ -0,0 +1,79 @@
+package deltasign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+)
+
+// MarshalPrivateKey returns key the way it's kept in files, its
+// seed in hex.
+func MarshalPrivateKey(key ed25519.PrivateKey) []byte {
+	return []byte(hex.EncodeToString(key.Seed()) + "\n")
+}
+
+// MarshalPublicKey returns key in hex, a line of a public key
+// file.
+func MarshalPublicKey(key ed25519.PublicKey) []byte {
+	return []byte(hex.EncodeToString(key) + "\n")
+}
+
+// ParsePrivateKey parses what MarshalPrivateKey returns.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	lines := keyLines(data)
+	if len(lines) != 1 {
+		return nil, fmt.Errorf("%w: private key files must hold one key, not %d", ErrInvalidKey, len(lines))
+	}
+
+	seed, err := decodeKey(lines[0], ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParsePublicKeys parses a file of public keys, one per line,
+// so a file can hold a set of trusted keys. Blank lines and
+// lines beginning with # are skipped.
+func ParsePublicKeys(data []byte) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0)
+
+	for _, line := range keyLines(data) {
+		key, err := decodeKey(line, ed25519.PublicKeySize)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no public keys", ErrInvalidKey)
+	}
+
+	return keys, nil
+}
+
+func keyLines(data []byte) [][]byte {
+	lines := make([][]byte, 0)
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] != '#' {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func decodeKey(line []byte, size int) ([]byte, error) {
+	key, err := hex.DecodeString(string(line))
+	if err != nil || len(key) != size {
+		return nil, fmt.Errorf("%w: keys must be %d hex digits", ErrInvalidKey, 2*size)
+	}
+
+	return key, nil
+}
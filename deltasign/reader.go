@@ -0,0 +1,107 @@
+package deltasign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Content is the content of a signed stream whose signature
+// was checked.
+type Content struct {
+	*io.SectionReader
+
+	// Signer is the trusted key the stream was signed with.
+	Signer ed25519.PublicKey
+
+	file *os.File
+}
+
+// Close removes the temporary file the stream was kept in.
+func (c *Content) Close() error {
+	err := c.file.Close()
+	os.Remove(c.file.Name())
+
+	return err
+}
+
+// Open reads the signed stream in whole into a temporary file
+// in dir, os.TempDir() if it's empty, and checks that it was
+// signed by one of keys. Only then it returns its content, so
+// nothing that wasn't signed can be read. The content must be
+// closed once done with.
+func Open(in io.Reader, keys []ed25519.PublicKey, dir string) (*Content, error) {
+	file, err := ioutil.TempFile(dir, "deltadiff-signed-")
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := open(in, keys, file)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return content, nil
+}
+
+func open(in io.Reader, keys []ed25519.PublicKey, file *os.File) (*Content, error) {
+	size, err := io.Copy(file, in)
+	if err != nil {
+		return nil, err
+	}
+
+	if size < int64(HEADER_SIZE+ed25519.SignatureSize) {
+		return nil, fmt.Errorf("%w: it has %d bytes, too few for a header and a signature", ErrNotSigned, size)
+	}
+
+	head := make([]byte, HEADER_SIZE)
+	if _, err := file.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+
+	if !IsSigned(head) {
+		return nil, fmt.Errorf("%w: bad magic %q", ErrNotSigned, head[:len(MAGIC)])
+	}
+
+	signer := trustedKey(head[len(MAGIC):], keys)
+	if signer == nil {
+		return nil, fmt.Errorf("%w: key ID %x", ErrUntrusted, head[len(MAGIC):])
+	}
+
+	signed := size - ed25519.SignatureSize
+
+	signature := make([]byte, ed25519.SignatureSize)
+	if _, err := file.ReadAt(signature, signed); err != nil {
+		return nil, err
+	}
+
+	digest := newDigest()
+	if _, err := io.Copy(digest, io.NewSectionReader(file, 0, signed)); err != nil {
+		return nil, err
+	}
+
+	if !ed25519.Verify(signer, message(digest), signature) {
+		return nil, fmt.Errorf("%w: it doesn't match the content, which may have been tampered with", ErrBadSignature)
+	}
+
+	return &Content{
+		SectionReader: io.NewSectionReader(file, int64(HEADER_SIZE), signed-int64(HEADER_SIZE)),
+		Signer:        signer,
+		file:          file,
+	}, nil
+}
+
+func trustedKey(id []byte, keys []ed25519.PublicKey) ed25519.PublicKey {
+	for _, key := range keys {
+		if len(key) == ed25519.PublicKeySize && bytes.Equal(KeyID(key), id) {
+			return key
+		}
+	}
+
+	return nil
+}
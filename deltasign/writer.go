@@ -0,0 +1,82 @@
+package deltasign
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"hash"
+	"io"
+)
+
+var errClosed = errors.New("Writer is closed")
+
+type writer struct {
+	out    io.Writer
+	key    ed25519.PrivateKey
+	digest hash.Hash
+	err    error
+}
+
+// NewWriter writes the header of a stream signed with key to
+// out, and returns a writer that copies what's written to it to
+// out. Close writes the signature, and must be called once
+// everything was written. It doesn't close out.
+func NewWriter(out io.Writer, key ed25519.PrivateKey) (io.WriteCloser, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidKey
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+
+	w := &writer{
+		out:    out,
+		key:    key,
+		digest: newDigest(),
+	}
+
+	if _, err := w.Write(header(public)); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.out.Write(p)
+	w.digest.Write(p[:n])
+	w.err = err
+
+	return n, err
+}
+
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	_, w.err = w.out.Write(ed25519.Sign(w.key, message(w.digest)))
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = errClosed
+
+	return nil
+}
+
+// Sign copies content to out, signed with key.
+func Sign(content io.Reader, out io.Writer, key ed25519.PrivateKey) error {
+	w, err := NewWriter(out, key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, content); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
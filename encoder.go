@@ -0,0 +1,91 @@
+package deltadiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// DeltaEncoder writes ops one by one to a delta stream.
+type DeltaEncoder struct {
+	w      io.Writer
+	offset int64
+}
+
+func NewDeltaEncoder(w io.Writer) *DeltaEncoder {
+	return &DeltaEncoder{
+		w: w,
+	}
+}
+
+// Offset returns how many bytes were written so far.
+func (e *DeltaEncoder) Offset() int64 {
+	return e.offset
+}
+
+func (e *DeltaEncoder) Encode(op Op) error {
+	opbytes, err := op.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	written, err := e.w.Write(opbytes)
+	e.offset += int64(written)
+	if err != nil {
+		return err
+	}
+
+	if written != len(opbytes) {
+		return fmt.Errorf("Couldn't write everything, wrote only %d", written)
+	}
+
+	return nil
+}
+
+// encodeWrite writes a write op of size bytes, copying its
+// data from data in chunks.
+func (e *DeltaEncoder) encodeWrite(size int, data io.Reader) error {
+	if uint64(size) > 0xffffffff {
+		return fmt.Errorf("Write op of %d bytes is too large", size)
+	}
+
+	header := make([]byte, 6)
+	binary.BigEndian.PutUint16(header[0:2], OP_WRITE)
+	binary.BigEndian.PutUint32(header[2:6], uint32(size))
+
+	written, err := e.w.Write(header)
+	e.offset += int64(written)
+	if err != nil {
+		return err
+	}
+
+	copied, err := io.CopyN(e.w, data, int64(size))
+	e.offset += copied
+
+	return err
+}
+
+// Abort marks the delta as incomplete. Decoding it fails with
+// ErrAborted once the mark is reached.
+func (e *DeltaEncoder) Abort() error {
+	opcodeBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(opcodeBytes, OP_ABORT)
+
+	written, err := e.w.Write(opcodeBytes)
+	e.offset += int64(written)
+
+	return err
+}
+
+// EncodeDelta writes ops as a delta.
+func EncodeDelta(ops []Op, out io.Writer) error {
+	encoder := NewDeltaEncoder(out)
+
+	for _, op := range ops {
+		if err := encoder.Encode(op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package deltadiff
+
+import (
+	"bytes"
+	"github.com/franela/goblin"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("object model", func() {
+
+		g.It("should build a delta by hand and patch it", func() {
+			ops := []Op{
+				&ReadOp{From: 4, To: 8},
+				&WriteOp{Data: []byte("--")},
+				&ReadOp{From: 0, To: 4},
+			}
+
+			delta := bytes.NewBuffer(nil)
+			err := EncodeDelta(ops, delta)
+			g.Assert(err).Equal(nil)
+
+			decoded, err := DecodeDelta(bytes.NewBuffer(delta.Bytes()))
+			g.Assert(err).Equal(nil)
+			g.Assert(decoded).Equal(ops)
+
+			// Patch only seeks forward in base, so leave the
+			// last read out.
+			out := bytes.NewBuffer(nil)
+			err = Patch(bytes.NewBufferString("aaaabbbb"), bytes.NewBuffer(delta.Bytes()[:18]), out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.String()).Equal("bbbb--")
+		})
+
+		g.It("should track offsets", func() {
+			encoder := NewDeltaEncoder(bytes.NewBuffer(nil))
+
+			err := encoder.Encode(&ReadOp{From: 0, To: 1})
+			g.Assert(err).Equal(nil)
+			g.Assert(encoder.Offset()).Equal(int64(10))
+
+			err = encoder.Encode(&WriteOp{Data: []byte("abc")})
+			g.Assert(err).Equal(nil)
+			g.Assert(encoder.Offset()).Equal(int64(19))
+		})
+
+		g.It("should refuse invalid ops", func() {
+			err := NewDeltaEncoder(bytes.NewBuffer(nil)).Encode(&ReadOp{From: 5, To: 1})
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("should round trip signature files", func() {
+			base := "aaaabbbbccccddeeeeee"
+
+			sc := &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 8,
+				BaseSize:  len(base),
+			}
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewBufferString(base), signature, sc)
+			g.Assert(err).Equal(nil)
+
+			sig, err := ReadSignatureFile(bytes.NewBuffer(signature.Bytes()))
+			g.Assert(err).Equal(nil)
+			g.Assert(sig.Hasher).Equal("md5")
+			g.Assert(len(sig.Blocks)).Equal(3)
+
+			rewritten := bytes.NewBuffer(nil)
+			n, err := sig.WriteTo(rewritten)
+			g.Assert(err).Equal(nil)
+			g.Assert(n).Equal(int64(signature.Len()))
+			g.Assert(rewritten.Bytes()).Equal(signature.Bytes())
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package deltadiff
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xrash/deltadiff/hasher"
+	"io"
+)
+
+// Errors returned by Signature, Delta and Patch wrap these, so
+// they can be told apart with errors.Is. Errors that don't wrap
+// any of them come from the readers and writers given.
+var (
+	// ErrCorruptDelta means a delta is malformed or cut short.
+	ErrCorruptDelta = errors.New("Corrupt delta")
+
+	// ErrCorruptSignature means a signature is malformed or
+	// cut short.
+	ErrCorruptSignature = errors.New("Corrupt signature")
+
+	// ErrUnknownHasher means a hasher name or code isn't
+	// registered.
+	ErrUnknownHasher = hasher.ErrUnknownHasher
+
+	// ErrBaseTooShort means a delta reads past the end of
+	// base, so base isn't the one the delta was made for.
+	ErrBaseTooShort = errors.New("Base is too short for the delta")
+
+	// ErrInvalidConfig means a config has invalid values.
+	ErrInvalidConfig = errors.New("Invalid config")
+
+	// ErrChecksumMismatch means the output of a delta doesn't
+	// match a checksum op in it, so base isn't the one the
+	// delta was made for.
+	ErrChecksumMismatch = errors.New("Checksum mismatch")
+
+	// ErrLimitExceeded means a delta outputs more than the
+	// limits in PatchConfig allow.
+	ErrLimitExceeded = errors.New("Limit exceeded")
+
+	// ErrMemoryLimit means Delta can't keep under
+	// DeltaConfig.MemoryLimit.
+	ErrMemoryLimit = errors.New("Memory limit is too low")
+
+	// ErrAborted means a delta ends with OP_ABORT.
+	ErrAborted = errors.New("Delta was aborted before it was complete")
+)
+
+// OpError is returned when an op of a delta can't be decoded
+// or applied. Index is the position of the op in the delta,
+// and Offset is where it begins, in bytes.
+type OpError struct {
+	Index  int
+	Offset int64
+	Err    error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("Op %d at offset %d: %v", e.Index, e.Offset, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// truncated tells input that was cut short, which wraps
+// sentinel, from other read errors, which are returned as is.
+func truncated(err error, sentinel error, format string, args ...interface{}) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %s", sentinel, fmt.Sprintf(format, args...))
+	}
+
+	return err
+}
@@ -0,0 +1,147 @@
+package deltadiff
+
+import (
+	"bytes"
+	"errors"
+	"github.com/franela/goblin"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestErrors(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("errors", func() {
+
+		base := strings.Repeat("0123456789abcdef", 8)
+
+		sign := func() []byte {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 16,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			return signature.Bytes()
+		}
+
+		delta := func(ops ...Op) []byte {
+			buffer := bytes.NewBuffer(nil)
+			err := EncodeDelta(ops, buffer)
+			g.Assert(err).Equal(nil)
+
+			return buffer.Bytes()
+		}
+
+		patch := func(base string, delta []byte) error {
+			return Patch(strings.NewReader(base), bytes.NewReader(delta), bytes.NewBuffer(nil))
+		}
+
+		g.It("should tell where a corrupt delta fails", func() {
+			ops := []Op{
+				&WriteOp{Data: []byte("abc")},
+				&ReadOp{From: 0, To: 16},
+				&ReadOp{From: 16, To: 32},
+			}
+
+			valid := delta(ops...)
+
+			cases := []struct {
+				delta  []byte
+				index  int
+				offset int64
+			}{
+				{valid[:len(valid)-3], 2, 19},
+				{valid[:1], 0, 0},
+				{append(delta(ops[0]), 0, 9), 1, 9},
+				{append(delta(ops[0]), delta(&ReadOp{From: 5, To: 5})[:2]...), 1, 9},
+			}
+
+			// A read op going backwards.
+			backwards := delta(&ReadOp{From: 5, To: 5})
+			backwards[9] = 4
+			cases = append(cases, struct {
+				delta  []byte
+				index  int
+				offset int64
+			}{backwards, 0, 0})
+
+			for _, c := range cases {
+				err := patch(base, c.delta)
+
+				g.Assert(errors.Is(err, ErrCorruptDelta)).Equal(true)
+
+				var opErr *OpError
+				g.Assert(errors.As(err, &opErr)).Equal(true)
+				g.Assert(opErr.Index).Equal(c.index)
+				g.Assert(opErr.Offset).Equal(c.offset)
+			}
+		})
+
+		g.It("should tell a short base", func() {
+			d := delta(&ReadOp{From: 0, To: 16}, &ReadOp{From: 120, To: 140})
+
+			err := patch(base, d)
+			g.Assert(errors.Is(err, ErrBaseTooShort)).Equal(true)
+			g.Assert(errors.Is(err, ErrCorruptDelta)).Equal(false)
+
+			var opErr *OpError
+			g.Assert(errors.As(err, &opErr)).Equal(true)
+			g.Assert(opErr.Index).Equal(1)
+			g.Assert(opErr.Offset).Equal(int64(10))
+
+			// Seeking past the end of a base that can't seek.
+			err = Patch(iotest.HalfReader(strings.NewReader(base)), bytes.NewReader(d), bytes.NewBuffer(nil))
+			g.Assert(errors.Is(err, ErrBaseTooShort)).Equal(true)
+		})
+
+		g.It("should tell I/O failures from corruption", func() {
+			failure := errors.New("disk on fire")
+			d := delta(&ReadOp{From: 0, To: 16})
+
+			err := Patch(iotest.ErrReader(failure), bytes.NewReader(d), bytes.NewBuffer(nil))
+			g.Assert(errors.Is(err, failure)).Equal(true)
+			g.Assert(errors.Is(err, ErrCorruptDelta)).Equal(false)
+			g.Assert(errors.Is(err, ErrBaseTooShort)).Equal(false)
+
+			err = Patch(strings.NewReader(base), iotest.ErrReader(failure), bytes.NewBuffer(nil))
+			g.Assert(errors.Is(err, failure)).Equal(true)
+			g.Assert(errors.Is(err, ErrCorruptDelta)).Equal(false)
+		})
+
+		g.It("should tell corrupt signatures and unknown hashers", func() {
+			signature := sign()
+
+			// More hashes than base has blocks.
+			extra := append(append([]byte{}, signature...), signature[len(signature)-16:]...)
+
+			for _, corrupt := range [][]byte{signature[:1], signature[:7], signature[:len(signature)-3], signature[:len(signature)-16], extra} {
+				err := Delta(bytes.NewReader(corrupt), strings.NewReader(base), bytes.NewBuffer(nil), &DeltaConfig{})
+				g.Assert(errors.Is(err, ErrCorruptSignature)).Equal(true)
+			}
+
+			unknown := append([]byte{0x7f, 0xff}, signature[2:]...)
+			err := Delta(bytes.NewReader(unknown), strings.NewReader(base), bytes.NewBuffer(nil), &DeltaConfig{})
+			g.Assert(errors.Is(err, ErrUnknownHasher)).Equal(true)
+
+			err = Signature(strings.NewReader(base), bytes.NewBuffer(nil), &SignatureConfig{Hasher: "nope"})
+			g.Assert(errors.Is(err, ErrUnknownHasher)).Equal(true)
+		})
+
+		g.It("should tell invalid configs", func() {
+			configs := []*SignatureConfig{
+				&SignatureConfig{Hasher: "md5", BaseSize: -1},
+				&SignatureConfig{Hasher: "md5", BlockSize: -1},
+			}
+
+			for _, c := range configs {
+				err := Signature(strings.NewReader(base), bytes.NewBuffer(nil), c)
+				g.Assert(errors.Is(err, ErrInvalidConfig)).Equal(true)
+			}
+		})
+	})
+}
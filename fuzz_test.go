@@ -0,0 +1,121 @@
+package deltadiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The fuzz targets check that malformed input only ever fails
+// with the documented errors, without panicking or allocating
+// by what the input claims. Run them with go test -fuzz.
+
+func FuzzPatch(f *testing.F) {
+	base := strings.Repeat("0123456789abcdef", 16)
+
+	seeds := [][]Op{
+		{&ReadOp{From: 0, To: 16}, &WriteOp{Data: []byte("abc")}},
+		{&WriteOp{Data: []byte("abc")}, &ReadOp{From: 100, To: 256}},
+		{&ReadOp{From: 0, To: 256}, &ChecksumOp{Digest: make([]byte, 32)}},
+	}
+
+	for _, ops := range seeds {
+		delta := bytes.NewBuffer(nil)
+		if err := EncodeDelta(ops, delta); err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(delta.Bytes())
+	}
+
+	f.Add([]byte{0, 0, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0, 2})
+
+	f.Fuzz(func(t *testing.T, delta []byte) {
+		c := &PatchConfig{
+			MaxOutputSize: 1 << 20,
+		}
+
+		err := PatchWithConfig(context.Background(), strings.NewReader(base), bytes.NewReader(delta), discard{}, c)
+		if err == nil {
+			return
+		}
+
+		for _, sentinel := range []error{ErrCorruptDelta, ErrBaseTooShort, ErrLimitExceeded, ErrChecksumMismatch, ErrAborted} {
+			if errors.Is(err, sentinel) {
+				return
+			}
+		}
+
+		t.Fatalf("Unexpected error %v", err)
+	})
+}
+
+func FuzzReadSignatureFile(f *testing.F) {
+	for _, h := range []string{"md5", "crc32", "polyroll"} {
+		signature := bytes.NewBuffer(nil)
+		err := Signature(strings.NewReader("some base to sign"), signature, &SignatureConfig{
+			Hasher:    h,
+			BlockSize: 4,
+			BaseSize:  17,
+		})
+
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(signature.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, signature []byte) {
+		s, err := ReadSignatureFile(bytes.NewReader(signature))
+		if err != nil {
+			if !errors.Is(err, ErrCorruptSignature) && !errors.Is(err, ErrUnknownHasher) {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			return
+		}
+
+		written := bytes.NewBuffer(nil)
+		if _, err := s.WriteTo(written); err != nil {
+			t.Fatalf("Couldn't write back signature: %v", err)
+		}
+
+		if !bytes.Equal(written.Bytes(), signature) {
+			t.Fatalf("Signature changed after writing it back")
+		}
+	})
+}
+
+func FuzzDelta(f *testing.F) {
+	target := "some target to diff, some base to sign"
+
+	for _, h := range []string{"md5", "crc32", "polyroll"} {
+		signature := bytes.NewBuffer(nil)
+		err := Signature(strings.NewReader("some base to sign"), signature, &SignatureConfig{
+			Hasher:    h,
+			BlockSize: 4,
+			BaseSize:  17,
+		})
+
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(signature.Bytes())
+	}
+
+	// Polyroll signatures with more hashes than base has blocks.
+	f.Add([]byte{0, 0, 0, 0, 0, 4, 0, 0, 0, 4, 1, 2, 3, 4, 5, 6, 7, 8})
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 16, 1, 2, 3, 4})
+
+	f.Fuzz(func(t *testing.T, signature []byte) {
+		err := Delta(bytes.NewReader(signature), strings.NewReader(target), discard{}, &DeltaConfig{})
+		if err != nil && !errors.Is(err, ErrCorruptSignature) && !errors.Is(err, ErrUnknownHasher) {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	})
+}
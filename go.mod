@@ -1,6 +1,6 @@
 module github.com/xrash/deltadiff
 
-go 1.17
+go 1.18
 
 require (
 	github.com/franela/goblin v0.0.0-20211003143422-0a4f594942bf
@@ -0,0 +1,122 @@
+package gzipdiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Delta reads target and writes a gzip delta that turns the
+// base described by signature into target, byte for byte.
+//
+// When both base and target are gzip files, and every member
+// of target compresses back to the exact same bytes with
+// compress/gzip, the decompressed contents are diffed and the
+// delta is in MODE_GZIP. Otherwise the files are diffed as is
+// and the delta is in MODE_RAW, which is what a gzip file made
+// by another compressor usually ends up with. The mode used is
+// returned, and the reason for falling back to MODE_RAW is
+// written to the debug output.
+func Delta(signature, target io.Reader, out io.Writer, c *deltadiff.DeltaConfig) (Mode, error) {
+	start := time.Now()
+
+	if c.Debug && c.DebugWriter == nil {
+		c.DebugWriter = os.Stderr
+	}
+
+	s, err := ReadSignature(signature)
+	if err != nil {
+		return MODE_RAW, err
+	}
+
+	data, err := ioutil.ReadAll(target)
+	if err != nil {
+		return MODE_RAW, err
+	}
+
+	digest := sha256.Sum256(data)
+
+	d := &GzipDelta{
+		Mode:    MODE_RAW,
+		Members: make([]*Member, 0),
+		Digest:  digest[:],
+	}
+
+	baseSignature, content := s.Raw, data
+
+	members, decompressed, err := recompressible(s, data)
+	if err == nil {
+		d.Mode = MODE_GZIP
+		d.Members = members
+		baseSignature, content = s.Content, decompressed
+	} else if c.Debug {
+		fmt.Fprintf(c.DebugWriter, "raw\t%v\n", err)
+	}
+
+	dc := &deltadiff.DeltaConfig{
+		Debug:       c.Debug,
+		DebugWriter: c.DebugWriter,
+		Progress:    c.Progress,
+		MemoryLimit: c.MemoryLimit,
+		TempDir:     c.TempDir,
+	}
+
+	if c.Stats != nil {
+		dc.Stats = &deltadiff.DeltaStats{}
+	}
+
+	delta := bytes.NewBuffer(nil)
+
+	err = deltadiff.Delta(bytes.NewReader(baseSignature), bytes.NewReader(content), delta, dc)
+	if err != nil {
+		return d.Mode, err
+	}
+
+	d.Delta = delta.Bytes()
+
+	written, err := d.WriteTo(out)
+	if err != nil {
+		return d.Mode, fmt.Errorf("Error writing gzip delta: %v", err)
+	}
+
+	if c.Stats != nil {
+		dc.Stats.DeltaSize = written
+		dc.Stats.Duration = time.Since(start)
+		c.Stats.Add(dc.Stats)
+	}
+
+	return d.Mode, nil
+}
+
+// recompressible tells whether the decompressed content of
+// target can be diffed, that is, if base is a gzip file and
+// every member of target can be compressed back exactly. If
+// so, it returns the members and the decompressed content.
+func recompressible(s *GzipSignature, data []byte) ([]*Member, []byte, error) {
+	if s.Content == nil {
+		return nil, nil, fmt.Errorf("Base isn't a gzip file")
+	}
+
+	members, err := decompress(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Target isn't a gzip file: %v", err)
+	}
+
+	result := make([]*Member, 0, len(members))
+
+	for i, m := range members {
+		level, ok := findLevel(m)
+		if !ok {
+			return nil, nil, fmt.Errorf("Member %d of target can't be compressed back to the same bytes", i)
+		}
+
+		result = append(result, toMember(m, level))
+	}
+
+	return result, join(members), nil
+}
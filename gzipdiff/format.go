@@ -0,0 +1,180 @@
+package gzipdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+)
+
+// Gzip signatures and deltas begin with a magic string, so
+// they can't be mistaken for regular signatures and deltas.
+const (
+	SIGNATURE_MAGIC = "DDGZSG01"
+	DELTA_MAGIC     = "DDGZDL01"
+)
+
+// Mode tells what a gzip delta was computed on.
+type Mode uint8
+
+const (
+	// The compressed files were diffed as is.
+	MODE_RAW Mode = 0
+
+	// The decompressed contents were diffed, and the target
+	// is compressed back when patching.
+	MODE_GZIP Mode = 1
+)
+
+func (m Mode) String() string {
+	switch m {
+	case MODE_RAW:
+		return "raw"
+	case MODE_GZIP:
+		return "gzip"
+	}
+
+	return "unknown"
+}
+
+type GzipSignature struct {
+	// Raw is the regular signature of base as is.
+	Raw []byte
+
+	// Content is the regular signature of the decompressed
+	// content of base. It's nil when base isn't a gzip file.
+	Content []byte
+}
+
+// Member holds what's needed to compress one gzip member of
+// the target back to the exact same bytes.
+type Member struct {
+	Level   int
+	Name    string
+	Comment string
+	ModTime int64
+	OS      byte
+	Extra   []byte
+
+	// Size is the size of the decompressed content.
+	Size int64
+}
+
+type GzipDelta struct {
+	Mode    Mode
+	Members []*Member
+
+	// Digest is the SHA-256 of the target file.
+	Digest []byte
+
+	// Delta is the regular delta of either the files or their
+	// decompressed contents, depending on Mode.
+	Delta []byte
+}
+
+func IsSignature(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(SIGNATURE_MAGIC))
+}
+
+func IsDelta(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(DELTA_MAGIC))
+}
+
+func (s *GzipSignature) WriteTo(out io.Writer) (int64, error) {
+	w := binfmt.NewWriter(out)
+	w.Magic(SIGNATURE_MAGIC)
+	w.Bytes(s.Raw)
+	w.Bytes(s.Content)
+
+	return w.Flush()
+}
+
+func ReadSignature(in io.Reader) (*GzipSignature, error) {
+	r := binfmt.NewReader(in)
+	r.Magic(SIGNATURE_MAGIC)
+
+	s := &GzipSignature{
+		Raw:     r.Bytes(),
+		Content: r.Bytes(),
+	}
+
+	if r.Err != nil {
+		return nil, fmt.Errorf("Error reading gzip signature: %v", r.Err)
+	}
+
+	if len(s.Content) == 0 {
+		s.Content = nil
+	}
+
+	return s, nil
+}
+
+func (d *GzipDelta) WriteTo(out io.Writer) (int64, error) {
+	w := binfmt.NewWriter(out)
+	w.Magic(DELTA_MAGIC)
+	w.Uint8(uint8(d.Mode))
+	w.Bytes(d.Digest)
+	w.Uint32(uint32(len(d.Members)))
+
+	for _, m := range d.Members {
+		w.Uint8(uint8(int8(m.Level)))
+		w.String(m.Name)
+		w.String(m.Comment)
+		w.Uint64(uint64(m.ModTime))
+		w.Uint8(m.OS)
+		w.Bytes(m.Extra)
+		w.Uint64(uint64(m.Size))
+	}
+
+	w.Bytes(d.Delta)
+
+	return w.Flush()
+}
+
+func ReadDelta(in io.Reader) (*GzipDelta, error) {
+	r := binfmt.NewReader(in)
+	r.Magic(DELTA_MAGIC)
+
+	d := &GzipDelta{
+		Mode:    Mode(r.Uint8()),
+		Digest:  r.Bytes(),
+		Members: make([]*Member, 0),
+	}
+
+	if r.Err == nil && d.Mode != MODE_RAW && d.Mode != MODE_GZIP {
+		r.Err = fmt.Errorf("Unknown mode %d", d.Mode)
+	}
+
+	count := r.Uint32()
+
+	for i := uint32(0); i < count && r.Err == nil; i++ {
+		m := &Member{
+			Level:   int(int8(r.Uint8())),
+			Name:    string(r.Bytes()),
+			Comment: string(r.Bytes()),
+			ModTime: int64(r.Uint64()),
+			OS:      r.Uint8(),
+			Extra:   r.Bytes(),
+			Size:    int64(r.Uint64()),
+		}
+
+		if r.Err == nil && (m.Level < gzip.HuffmanOnly || m.Level > gzip.BestCompression) {
+			r.Err = fmt.Errorf("Invalid compression level %d", m.Level)
+		}
+
+		if r.Err == nil && m.Size < 0 {
+			r.Err = fmt.Errorf("Invalid member size %d", m.Size)
+		}
+
+		d.Members = append(d.Members, m)
+	}
+
+	d.Delta = r.Bytes()
+
+	if r.Err != nil {
+		return nil, fmt.Errorf("Error reading gzip delta: %v", r.Err)
+	}
+
+	return d, nil
+}
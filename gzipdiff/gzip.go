@@ -0,0 +1,164 @@
+package gzipdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Levels are tried in this order when looking for the one a
+// member was compressed with, most common first.
+var levels = []int{
+	gzip.DefaultCompression,
+	gzip.BestCompression,
+	gzip.BestSpeed,
+	2, 3, 4, 5, 7, 8,
+	gzip.NoCompression,
+	gzip.HuffmanOnly,
+}
+
+// member is one gzip member of a file: its raw bytes, its
+// header and its decompressed content.
+type member struct {
+	header  gzip.Header
+	raw     []byte
+	content []byte
+}
+
+// decompress splits data into its gzip members. It fails
+// unless data is made of gzip members only.
+func decompress(data []byte) ([]*member, error) {
+	br := bytes.NewReader(data)
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*member, 0)
+	start := 0
+
+	for {
+		// Reading member by member keeps the reader right at
+		// the end of each one, so its raw bytes are known.
+		zr.Multistream(false)
+
+		content, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+
+		end := len(data) - br.Len()
+
+		members = append(members, &member{
+			header:  zr.Header,
+			raw:     data[start:end],
+			content: content,
+		})
+
+		start = end
+
+		err = zr.Reset(br)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return members, nil
+}
+
+func join(members []*member) []byte {
+	buffer := bytes.NewBuffer(nil)
+	for _, m := range members {
+		buffer.Write(m.content)
+	}
+
+	return buffer.Bytes()
+}
+
+// findLevel looks for the level at which the content of m
+// compresses back to its raw bytes.
+func findLevel(m *member) (int, bool) {
+	for _, level := range levels {
+		c := &comparer{
+			expected: m.raw,
+		}
+
+		if err := compress(c, toMember(m, level), m.content); err == nil && c.offset == len(c.expected) {
+			return level, true
+		}
+	}
+
+	return 0, false
+}
+
+func toMember(m *member, level int) *Member {
+	mtime := int64(0)
+	if !m.header.ModTime.IsZero() {
+		mtime = m.header.ModTime.Unix()
+	}
+
+	return &Member{
+		Level:   level,
+		Name:    m.header.Name,
+		Comment: m.header.Comment,
+		ModTime: mtime,
+		OS:      m.header.OS,
+		Extra:   m.header.Extra,
+		Size:    int64(len(m.content)),
+	}
+}
+
+// compress writes content to out as one gzip member, with the
+// level and header of m.
+func compress(out io.Writer, m *Member, content []byte) error {
+	zw, err := gzip.NewWriterLevel(out, m.Level)
+	if err != nil {
+		return err
+	}
+
+	zw.Name = m.Name
+	zw.Comment = m.Comment
+	zw.OS = m.OS
+
+	// compress/gzip writes an extra field whenever Extra isn't
+	// nil, even if it's empty.
+	if len(m.Extra) > 0 {
+		zw.Extra = m.Extra
+	}
+
+	if m.ModTime > 0 {
+		zw.ModTime = time.Unix(m.ModTime, 0)
+	}
+
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// comparer is a writer that fails as soon as what's written to
+// it differs from expected, so a wrong level is given up on
+// early.
+type comparer struct {
+	expected []byte
+	offset   int
+}
+
+func (c *comparer) Write(p []byte) (int, error) {
+	if len(p) > len(c.expected)-c.offset || !bytes.Equal(p, c.expected[c.offset:c.offset+len(p)]) {
+		return 0, fmt.Errorf("Output differs")
+	}
+
+	c.offset += len(p)
+
+	return len(p), nil
+}
@@ -0,0 +1,158 @@
+package gzipdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+func TestGzipDiff(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("gzip diff", func() {
+
+		gz := func(level int, name string, contents ...[]byte) []byte {
+			buffer := bytes.NewBuffer(nil)
+
+			for _, content := range contents {
+				zw, err := gzip.NewWriterLevel(buffer, level)
+				g.Assert(err).Equal(nil)
+				zw.Name = name
+				zw.ModTime = time.Unix(1600000000, 0)
+				_, err = zw.Write(content)
+				g.Assert(err).Equal(nil)
+				err = zw.Close()
+				g.Assert(err).Equal(nil)
+			}
+
+			return buffer.Bytes()
+		}
+
+		text := func(n int, changed int) []byte {
+			buffer := bytes.NewBuffer(nil)
+			for i := 0; i < n; i++ {
+				if i == changed {
+					fmt.Fprintf(buffer, "line %d was changed\n", i)
+					continue
+				}
+
+				fmt.Fprintf(buffer, "line %d of some text that compresses well\n", i)
+			}
+
+			return buffer.Bytes()
+		}
+
+		stored := func(content []byte, size int) []byte {
+			buffer := bytes.NewBuffer([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255})
+
+			for i := 0; i < len(content); i += size {
+				block := content[i:]
+				if len(block) > size {
+					block = block[:size]
+				}
+
+				final := byte(0)
+				if i+size >= len(content) {
+					final = 1
+				}
+
+				buffer.WriteByte(final)
+				binary.Write(buffer, binary.LittleEndian, uint16(len(block)))
+				binary.Write(buffer, binary.LittleEndian, ^uint16(len(block)))
+				buffer.Write(block)
+			}
+
+			binary.Write(buffer, binary.LittleEndian, crc32.ChecksumIEEE(content))
+			binary.Write(buffer, binary.LittleEndian, uint32(len(content)))
+
+			return buffer.Bytes()
+		}
+
+		diff := func(base, target []byte) (Mode, []byte) {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewReader(base), signature, &deltadiff.SignatureConfig{Hasher: "md5"})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			mode, err := Delta(signature, bytes.NewReader(target), delta, &deltadiff.DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			result := bytes.NewBuffer(nil)
+			err = Patch(bytes.NewReader(base), bytes.NewReader(delta.Bytes()), result)
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Bytes()).Equal(target)
+
+			return mode, delta.Bytes()
+		}
+
+		g.It("should diff the decompressed content", func() {
+			for _, level := range []int{gzip.DefaultCompression, gzip.BestSpeed, gzip.BestCompression, gzip.NoCompression} {
+				base := gz(level, "file.txt", text(5000, -1))
+				target := gz(level, "file.txt", text(5000, 2500))
+
+				mode, delta := diff(base, target)
+
+				g.Assert(mode).Equal(MODE_GZIP)
+				g.Assert(len(delta) < len(target)/10).Equal(true)
+			}
+		})
+
+		g.It("should rebuild every member of a multi-member file", func() {
+			g.Timeout(time.Second * 60)
+
+			base := gz(gzip.BestSpeed, "", text(1000, -1), text(2000, -1))
+			target := gz(gzip.BestSpeed, "", text(1000, 10), text(2000, -1), text(10, -1))
+
+			mode, _ := diff(base, target)
+
+			g.Assert(mode).Equal(MODE_GZIP)
+		})
+
+		g.It("should fall back to raw diffing", func() {
+			content := text(1000, -1)
+
+			// A truncated member can't be decompressed.
+			target := gz(gzip.DefaultCompression, "", content)
+			target = target[:len(target)-4]
+
+			mode, _ := diff(gz(gzip.DefaultCompression, "", content), target)
+			g.Assert(mode).Equal(MODE_RAW)
+
+			mode, _ = diff(content, gz(gzip.DefaultCompression, "", content))
+			g.Assert(mode).Equal(MODE_RAW)
+
+			// Stored blocks far smaller than the ones
+			// compress/gzip writes.
+			target = stored(content, 100)
+
+			mode, _ = diff(gz(gzip.DefaultCompression, "", content), target)
+			g.Assert(mode).Equal(MODE_RAW)
+		})
+
+		g.It("should fail when the result doesn't match", func() {
+			base := gz(gzip.DefaultCompression, "", text(1000, -1))
+			target := gz(gzip.DefaultCompression, "", text(1000, 5))
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewReader(base), signature, &deltadiff.SignatureConfig{Hasher: "md5"})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			_, err = Delta(signature, bytes.NewReader(target), delta, &deltadiff.DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			// Same length as base, so only the checksum can tell.
+			other := gz(gzip.DefaultCompression, "", bytes.ToUpper(text(1000, -1)))
+			err = Patch(bytes.NewReader(other), delta, bytes.NewBuffer(nil))
+			g.Assert(errors.Is(err, deltadiff.ErrChecksumMismatch)).IsTrue()
+		})
+	})
+}
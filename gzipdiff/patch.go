@@ -0,0 +1,84 @@
+package gzipdiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/ioutil"
+)
+
+// Patch applies a gzip delta to base and writes the target to
+// out. In MODE_GZIP, base is decompressed in memory, patched,
+// and compressed back member by member.
+//
+// The result is checked against the digest of the target,
+// since a different version of compress/gzip could compress
+// it differently than the one that computed the delta.
+func Patch(base, delta io.Reader, out io.Writer) error {
+	d, err := ReadDelta(delta)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.New()
+	w := io.MultiWriter(out, digest)
+
+	switch d.Mode {
+	case MODE_RAW:
+		err = deltadiff.Patch(base, bytes.NewReader(d.Delta), w)
+	case MODE_GZIP:
+		err = patchContent(base, d, w)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(digest.Sum(nil), d.Digest) {
+		return fmt.Errorf("%w, base differs from the one in the signature or the target couldn't be compressed back", deltadiff.ErrChecksumMismatch)
+	}
+
+	return nil
+}
+
+func patchContent(base io.Reader, d *GzipDelta, out io.Writer) error {
+	data, err := ioutil.ReadAll(base)
+	if err != nil {
+		return err
+	}
+
+	members, err := decompress(data)
+	if err != nil {
+		return fmt.Errorf("Base isn't a gzip file: %v", err)
+	}
+
+	content := bytes.NewBuffer(nil)
+
+	err = deltadiff.Patch(bytes.NewReader(join(members)), bytes.NewReader(d.Delta), content)
+	if err != nil {
+		return err
+	}
+
+	patched := content.Bytes()
+	offset := int64(0)
+
+	for _, m := range d.Members {
+		if m.Size > int64(len(patched))-offset {
+			return fmt.Errorf("Patched content is shorter than the target members")
+		}
+
+		if err := compress(out, m, patched[offset:offset+m.Size]); err != nil {
+			return err
+		}
+
+		offset += m.Size
+	}
+
+	if offset != int64(len(patched)) {
+		return fmt.Errorf("Patched content is longer than the target members")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package gzipdiff
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/ioutil"
+)
+
+// Signature reads base and writes a gzip signature, with the
+// regular signature of base as is and, when base is a gzip
+// file, the regular signature of its decompressed content,
+// both built with c. c.BaseSize is ignored in favour of the
+// actual sizes.
+func Signature(base io.Reader, out io.Writer, c *deltadiff.SignatureConfig) error {
+	data, err := ioutil.ReadAll(base)
+	if err != nil {
+		return err
+	}
+
+	s := &GzipSignature{}
+
+	s.Raw, err = sign(data, c)
+	if err != nil {
+		return err
+	}
+
+	if members, err := decompress(data); err == nil {
+		s.Content, err = sign(join(members), c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.WriteTo(out); err != nil {
+		return fmt.Errorf("Error writing gzip signature: %v", err)
+	}
+
+	return nil
+}
+
+func sign(data []byte, c *deltadiff.SignatureConfig) ([]byte, error) {
+	signature := bytes.NewBuffer(nil)
+
+	sc := &deltadiff.SignatureConfig{
+		Hasher:       c.Hasher,
+		BlockSize:    c.BlockSize,
+		CDC:          c.CDC,
+		MinBlockSize: c.MinBlockSize,
+		MaxBlockSize: c.MaxBlockSize,
+		BaseSize:     len(data),
+		Progress:     c.Progress,
+	}
+
+	if err := deltadiff.Signature(bytes.NewReader(data), signature, sc); err != nil {
+		return nil, err
+	}
+
+	return signature.Bytes(), nil
+}
@@ -2,14 +2,23 @@ package hasher
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 )
 
+// ErrUnknownHasher is wrapped by the errors about hasher names
+// and codes that aren't registered.
+var ErrUnknownHasher = errors.New("Unknown hasher")
+
 const (
 	HASHER_CODE_POLYROLL uint16 = 0
 	HASHER_CODE_MD5      uint16 = 1
 	HASHER_CODE_CRC32    uint16 = 2
 
+	// Codes from HASHER_CODE_USER_MIN up are reserved for
+	// hashers registered from outside this package.
+	HASHER_CODE_USER_MIN uint16 = 0x8000
+
 	POLYROLL_BASE = 257
 	//POLYROLL_MOD = 8509909
 	POLYROLL_MOD = 15485863
@@ -25,35 +34,32 @@ type Hasher interface {
 }
 
 func GetHasherByName(name string) (Hasher, error) {
-	switch name {
-	case "polyroll":
-		return &PolyrollHasher{
-			Base: POLYROLL_BASE,
-			Mod:  POLYROLL_MOD,
-		}, nil
-	case "md5":
-		return &MD5Hasher{}, nil
-	case "crc32":
-		return &CRC32Hasher{}, nil
+	r, ok := lookupName(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownHasher, name)
 	}
 
-	return nil, fmt.Errorf("Unknown hasher %s", name)
+	return r.factory(), nil
 }
 
 func GetHasherByCode(codebytes []byte) (Hasher, error) {
 	code := binary.BigEndian.Uint16(codebytes)
 
-	switch code {
-	case HASHER_CODE_POLYROLL:
-		return &PolyrollHasher{
-			Base: POLYROLL_BASE,
-			Mod:  POLYROLL_MOD,
-		}, nil
-	case HASHER_CODE_MD5:
-		return &MD5Hasher{}, nil
-	case HASHER_CODE_CRC32:
-		return &CRC32Hasher{}, nil
+	r, ok := lookupCode(code)
+	if !ok {
+		return nil, fmt.Errorf("%w [%v] %v", ErrUnknownHasher, codebytes, code)
+	}
+
+	return r.factory(), nil
+}
+
+func GetHasherNameByCode(codebytes []byte) (string, error) {
+	code := binary.BigEndian.Uint16(codebytes)
+
+	r, ok := lookupCode(code)
+	if !ok {
+		return "", fmt.Errorf("%w [%v] %v", ErrUnknownHasher, codebytes, code)
 	}
 
-	return nil, fmt.Errorf("Unknown hasher [%v] %v", codebytes, code)
+	return r.name, nil
 }
@@ -62,14 +62,15 @@ func (h *PolyrollHasher) SingleHash(data []byte) ([]byte, error) {
 }
 
 func (h *PolyrollHasher) Hash(data []byte) ([]byte, error) {
-	if len(h.pos) == 0 {
-		pos := h.calculatePositionFactors(len(data))
-		h.pos = pos
-	}
-
 	var hash int
 
 	if !h.memory {
+		// The factors depend on the length, which may change
+		// after Reset, such as for the last block of a base.
+		if len(h.pos) != len(data) {
+			h.pos = h.calculatePositionFactors(len(data))
+		}
+
 		var first int
 
 		for i := 0; i < len(data); i++ {
@@ -163,5 +163,22 @@ func TestPolyrollHasher(t *testing.T) {
 
 		})
 
+		g.It("should hash inputs of different lengths after Reset", func() {
+			h := &PolyrollHasher{
+				Base: POLYROLL_BASE,
+				Mod:  POLYROLL_MOD,
+			}
+
+			for _, input := range []string{"abcdefgh", "abc", "abcdefghijkl", "ab"} {
+				h.Reset()
+				hash, err := h.Hash([]byte(input))
+				g.Assert(err).Equal(nil)
+
+				expected, err := h.SingleHash([]byte(input))
+				g.Assert(err).Equal(nil)
+				g.Assert(hash).Equal(expected)
+			}
+		})
+
 	})
 }
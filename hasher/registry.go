@@ -0,0 +1,155 @@
+package hasher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory returns a new hasher, ready to be used.
+type Factory func() Hasher
+
+// Info describes a registered hasher.
+type Info struct {
+	Name     string
+	Code     uint16
+	HashSize int
+}
+
+type registration struct {
+	name    string
+	code    uint16
+	factory Factory
+}
+
+var registry = struct {
+	sync.RWMutex
+	byName map[string]*registration
+	byCode map[uint16]*registration
+}{
+	byName: make(map[string]*registration),
+	byCode: make(map[uint16]*registration),
+}
+
+func init() {
+	mustRegister("polyroll", HASHER_CODE_POLYROLL, func() Hasher {
+		return &PolyrollHasher{
+			Base: POLYROLL_BASE,
+			Mod:  POLYROLL_MOD,
+		}
+	})
+
+	mustRegister("md5", HASHER_CODE_MD5, func() Hasher {
+		return &MD5Hasher{}
+	})
+
+	mustRegister("crc32", HASHER_CODE_CRC32, func() Hasher {
+		return &CRC32Hasher{}
+	})
+}
+
+// Register makes a hasher available under name and code, so
+// it can be picked in SignatureConfig and found again from the
+// code written in signatures. code must be at least
+// HASHER_CODE_USER_MIN, and the hashers made by factory must
+// return it from Code.
+//
+// Signatures made with a registered hasher can only be used by
+// programs that register it too, under the same code.
+func Register(name string, code uint16, factory Factory) error {
+	if code < HASHER_CODE_USER_MIN {
+		return fmt.Errorf("Hasher code %d is reserved, must be at least %d", code, HASHER_CODE_USER_MIN)
+	}
+
+	return register(name, code, factory)
+}
+
+// Hashers lists the registered hashers, ordered by code.
+func Hashers() []*Info {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	infos := make([]*Info, 0, len(registry.byCode))
+
+	for _, r := range registry.byCode {
+		infos = append(infos, &Info{
+			Name:     r.name,
+			Code:     r.code,
+			HashSize: r.factory().HashSize(),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Code < infos[j].Code
+	})
+
+	return infos
+}
+
+func register(name string, code uint16, factory Factory) error {
+	if name == "" {
+		return fmt.Errorf("Hasher name can't be empty")
+	}
+
+	if factory == nil {
+		return fmt.Errorf("Hasher %s has no factory", name)
+	}
+
+	h := factory()
+	if h == nil {
+		return fmt.Errorf("Factory of hasher %s returned nil", name)
+	}
+
+	if len(h.Code()) != 2 || binary.BigEndian.Uint16(h.Code()) != code {
+		return fmt.Errorf("Hasher %s returns code %v from Code instead of %d", name, h.Code(), code)
+	}
+
+	if h.HashSize() <= 0 {
+		return fmt.Errorf("Hasher %s has invalid hash size %d", name, h.HashSize())
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.byName[name]; ok {
+		return fmt.Errorf("Hasher %s is already registered", name)
+	}
+
+	if r, ok := registry.byCode[code]; ok {
+		return fmt.Errorf("Hasher code %d is already registered by %s", code, r.name)
+	}
+
+	r := &registration{
+		name:    name,
+		code:    code,
+		factory: factory,
+	}
+
+	registry.byName[name] = r
+	registry.byCode[code] = r
+
+	return nil
+}
+
+func mustRegister(name string, code uint16, factory Factory) {
+	if err := register(name, code, factory); err != nil {
+		panic(err)
+	}
+}
+
+func lookupName(name string) (*registration, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	r, ok := registry.byName[name]
+	return r, ok
+}
+
+func lookupCode(code uint16) (*registration, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	r, ok := registry.byCode[code]
+	return r, ok
+}
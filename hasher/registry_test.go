@@ -0,0 +1,89 @@
+package hasher
+
+import (
+	"encoding/binary"
+	"github.com/franela/goblin"
+	"testing"
+)
+
+type sumHasher struct {
+	code uint16
+}
+
+func (h *sumHasher) Hash(data []byte) ([]byte, error) {
+	sum := 0
+	for _, b := range data {
+		sum += int(b)
+	}
+
+	return []byte{byte(sum), byte(sum >> 8)}, nil
+}
+
+func (h *sumHasher) HashSize() int {
+	return 2
+}
+
+func (h *sumHasher) Code() []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, h.code)
+	return b
+}
+
+func (h *sumHasher) Reset() {}
+
+func TestRegistry(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("registry", func() {
+
+		g.It("should have the built-in hashers", func() {
+			infos := Hashers()
+
+			g.Assert(len(infos) >= 3).Equal(true)
+			g.Assert(*infos[0]).Equal(Info{Name: "polyroll", Code: HASHER_CODE_POLYROLL, HashSize: 4})
+			g.Assert(*infos[1]).Equal(Info{Name: "md5", Code: HASHER_CODE_MD5, HashSize: 16})
+			g.Assert(*infos[2]).Equal(Info{Name: "crc32", Code: HASHER_CODE_CRC32, HashSize: 4})
+		})
+
+		g.It("should find registered hashers by name and code", func() {
+			code := HASHER_CODE_USER_MIN + 10
+
+			err := Register("sum-test", code, func() Hasher {
+				return &sumHasher{code: code}
+			})
+			g.Assert(err).Equal(nil)
+
+			h, err := GetHasherByName("sum-test")
+			g.Assert(err).Equal(nil)
+			g.Assert(h.HashSize()).Equal(2)
+
+			h, err = GetHasherByCode(h.Code())
+			g.Assert(err).Equal(nil)
+			g.Assert(h.HashSize()).Equal(2)
+
+			name, err := GetHasherNameByCode(h.Code())
+			g.Assert(err).Equal(nil)
+			g.Assert(name).Equal("sum-test")
+		})
+
+		g.It("should refuse invalid registrations", func() {
+			factory := func(code uint16) Factory {
+				return func() Hasher {
+					return &sumHasher{code: code}
+				}
+			}
+
+			user := HASHER_CODE_USER_MIN + 20
+
+			g.Assert(Register("sum-reserved", HASHER_CODE_CRC32+1, factory(HASHER_CODE_CRC32+1)) == nil).Equal(false)
+			g.Assert(Register("", user, factory(user)) == nil).Equal(false)
+			g.Assert(Register("sum-nil", user, nil) == nil).Equal(false)
+			g.Assert(Register("sum-wrong-code", user, factory(user+1)) == nil).Equal(false)
+			g.Assert(Register("md5", user, factory(user)) == nil).Equal(false)
+
+			g.Assert(Register("sum-first", user, factory(user))).Equal(nil)
+			g.Assert(Register("sum-second", user, factory(user)) == nil).Equal(false)
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package deltadiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/xrash/deltadiff/hasher"
+	"io"
+)
+
+type FileKind int
+
+const (
+	FileKindUnknown FileKind = iota
+	FileKindSignature
+	FileKindDelta
+)
+
+func (k FileKind) String() string {
+	switch k {
+	case FileKindSignature:
+		return "signature"
+	case FileKindDelta:
+		return "delta"
+	}
+
+	return "unknown"
+}
+
+// DetectFileKind tells signatures and deltas apart. Only CDC
+// signatures carry a magic number, so the content of the rest
+// is checked against each layout: a signature must have a
+// known hasher and exactly one hash per block of base, and a
+// delta must decode into valid ops up to the last byte.
+func DetectFileKind(data []byte) FileKind {
+	if looksLikeSignature(data) {
+		return FileKindSignature
+	}
+
+	if looksLikeDelta(data) {
+		return FileKindDelta
+	}
+
+	return FileKindUnknown
+}
+
+func looksLikeSignature(data []byte) bool {
+	if bytes.HasPrefix(data, []byte(CDC_SIGNATURE_MAGIC)) {
+		_, err := ReadSignatureFile(bytes.NewReader(data))
+		return err == nil
+	}
+
+	if len(data) < 10 {
+		return false
+	}
+
+	h, err := hasher.GetHasherByCode(data[0:2])
+	if err != nil {
+		return false
+	}
+
+	blockSize := int(binary.BigEndian.Uint32(data[2:6]))
+	baseSize := int(binary.BigEndian.Uint32(data[6:10]))
+
+	if blockSize <= 0 {
+		return false
+	}
+
+	blocks := (baseSize + blockSize - 1) / blockSize
+
+	return len(data)-10 == blocks*h.HashSize()
+}
+
+func looksLikeDelta(data []byte) bool {
+	decoder := NewDeltaDecoder(bytes.NewReader(data))
+
+	for {
+		_, err := decoder.Next()
+		if err == io.EOF {
+			return true
+		}
+
+		if err != nil {
+			return false
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package deltadiff
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/franela/goblin"
+	"io"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("inspect", func() {
+
+		base := "aaaabbbbccccddeeeeee"
+		target := "aaaabbbbccccddddeeee"
+
+		makeSignature := func() []byte {
+			sc := &SignatureConfig{
+				Hasher:    "polyroll",
+				BlockSize: 4,
+				BaseSize:  len(base),
+			}
+
+			signatureBuffer := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewBufferString(base), signatureBuffer, sc)
+			g.Assert(err).Equal(nil)
+
+			return signatureBuffer.Bytes()
+		}
+
+		makeDelta := func() []byte {
+			deltaBuffer := bytes.NewBuffer(nil)
+			err := Delta(bytes.NewBuffer(makeSignature()), bytes.NewBufferString(target), deltaBuffer, &DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			return deltaBuffer.Bytes()
+		}
+
+		g.It("should detect signatures and deltas", func() {
+			g.Assert(DetectFileKind(makeSignature())).Equal(FileKindSignature)
+			g.Assert(DetectFileKind(makeDelta())).Equal(FileKindDelta)
+			g.Assert(DetectFileKind([]byte{0, 9, 1})).Equal(FileKindUnknown)
+		})
+
+		g.It("should read signature files", func() {
+			sig, err := ReadSignatureFile(bytes.NewBuffer(makeSignature()))
+			g.Assert(err).Equal(nil)
+			g.Assert(sig.Hasher).Equal("polyroll")
+			g.Assert(sig.BlockSize).Equal(4)
+			g.Assert(sig.BaseSize).Equal(len(base))
+			g.Assert(len(sig.Blocks)).Equal(5)
+		})
+
+		g.It("should decode the ops of a delta", func() {
+			decoder := NewDeltaDecoder(bytes.NewBuffer(makeDelta()))
+
+			expected := []string{
+				"read:0-12",
+				"write:dd",
+				"read:12-16",
+				"write:ee",
+			}
+
+			for _, e := range expected {
+				op, err := decoder.Next()
+				g.Assert(err).Equal(nil)
+
+				switch op := op.(type) {
+				case *ReadOp:
+					g.Assert(fmt.Sprintf("%s:%d-%d", op.Kind(), op.From, op.To)).Equal(e)
+				case *WriteOp:
+					g.Assert(op.Kind() + ":" + string(op.Data)).Equal(e)
+				}
+			}
+
+			_, err := decoder.Next()
+			g.Assert(err).Equal(io.EOF)
+		})
+
+		g.It("should fail on truncated deltas", func() {
+			delta := makeDelta()
+			decoder := NewDeltaDecoder(bytes.NewBuffer(delta[:len(delta)-1]))
+
+			var err error
+			for err == nil {
+				_, err = decoder.Next()
+			}
+
+			g.Assert(err == io.EOF).Equal(false)
+		})
+	})
+}
@@ -0,0 +1,191 @@
+// Package binfmt writes and reads the length prefixed, big
+// endian fields the container formats are made of. Writer
+// and Reader keep the first error in Err, so a format can be
+// written and read field by field without checking each one.
+package binfmt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+type Writer struct {
+	w       *bufio.Writer
+	written int64
+	Err     error
+}
+
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{
+		w: bufio.NewWriter(out),
+	}
+}
+
+func (w *Writer) Raw(b []byte) {
+	if w.Err != nil {
+		return
+	}
+
+	n, err := w.w.Write(b)
+	w.written += int64(n)
+	w.Err = err
+}
+
+func (w *Writer) Magic(magic string) {
+	w.Raw([]byte(magic))
+}
+
+func (w *Writer) Uint8(n uint8) {
+	w.Raw([]byte{n})
+}
+
+func (w *Writer) Uint32(n uint32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	w.Raw(b)
+}
+
+func (w *Writer) Uint64(n uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	w.Raw(b)
+}
+
+func (w *Writer) Bytes(b []byte) {
+	w.Uint32(uint32(len(b)))
+	w.Raw(b)
+}
+
+func (w *Writer) String(s string) {
+	w.Bytes([]byte(s))
+}
+
+func (w *Writer) Flush() (int64, error) {
+	if w.Err != nil {
+		return w.written, w.Err
+	}
+
+	return w.written, w.w.Flush()
+}
+
+type Reader struct {
+	r   io.Reader
+	Err error
+}
+
+func NewReader(in io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReader(in),
+	}
+}
+
+func (r *Reader) Fixed(n int) []byte {
+	if r.Err != nil {
+		return nil
+	}
+
+	// Lengths come from the input, so memory grows with the
+	// bytes actually read rather than with n.
+	b, err := ioutil.ReadAll(io.LimitReader(r.r, int64(n)))
+	if err == nil && len(b) < n {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		r.Err = err
+		return nil
+	}
+
+	return b
+}
+
+func (r *Reader) Magic(magic string) {
+	b := r.Fixed(len(magic))
+	if r.Err == nil && string(b) != magic {
+		r.Err = fmt.Errorf("Bad magic %q, expected %q", b, magic)
+	}
+}
+
+func (r *Reader) Uint8() uint8 {
+	b := r.Fixed(1)
+	if r.Err != nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (r *Reader) Uint32() uint32 {
+	b := r.Fixed(4)
+	if r.Err != nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *Reader) Uint64() uint64 {
+	b := r.Fixed(8)
+	if r.Err != nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+// Bytes reads through a LimitReader instead of allocating
+// the announced length up front, so a corrupt length can't
+// make it allocate more than what's actually there.
+func (r *Reader) Bytes() []byte {
+	n := r.Uint32()
+	if r.Err != nil {
+		return nil
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	copied, err := io.Copy(buffer, io.LimitReader(r.r, int64(n)))
+	if err != nil {
+		r.Err = err
+		return nil
+	}
+
+	if copied != int64(n) {
+		r.Err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	return buffer.Bytes()
+}
+
+func (r *Reader) String() string {
+	return string(r.Bytes())
+}
+
+// Path reads a path and makes sure it stays inside the tree,
+// as it will be joined to a directory when patching.
+func (r *Reader) Path() string {
+	p := string(r.Bytes())
+	if r.Err != nil || p == "" {
+		return p
+	}
+
+	clean := path.Clean(p)
+	escapes := clean != p ||
+		path.IsAbs(p) ||
+		clean == "." ||
+		clean == ".." ||
+		strings.HasPrefix(clean, "../") ||
+		strings.Contains(p, "\\")
+
+	if escapes {
+		r.Err = fmt.Errorf("Invalid path %q", p)
+	}
+
+	return p
+}
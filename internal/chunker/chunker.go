@@ -0,0 +1,190 @@
+// Package chunker splits streams into chunks, either of a fixed
+// size or content-defined, with FastCDC.
+package chunker
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Chunker splits a stream into chunks.
+type Chunker interface {
+	// Next returns the next chunk, which is only valid until
+	// the next call, or io.EOF once there are no more.
+	Next() ([]byte, error)
+}
+
+type fixed struct {
+	r      io.Reader
+	buffer []byte
+}
+
+// NewFixed splits r into chunks of size bytes, but for the
+// last one, which may be shorter.
+func NewFixed(r io.Reader, size int) Chunker {
+	return &fixed{
+		r:      r,
+		buffer: make([]byte, size),
+	}
+}
+
+func (c *fixed) Next() ([]byte, error) {
+	n, err := io.ReadFull(c.r, c.buffer)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.buffer[:n], nil
+}
+
+// CDC splits r into content-defined chunks with FastCDC: a gear
+// hash is rolled over the data, and a chunk ends where enough of
+// its bits are zero, which takes more of them before avg bytes
+// and fewer after, so sizes gather around avg. Chunks are at
+// least min bytes long and at most max, but for the last one.
+// Since boundaries only depend on the bytes before them, an
+// insertion or removal only changes the chunks around it.
+type CDC struct {
+	r        io.Reader
+	buffer   []byte
+	begin    int
+	end      int
+	eof      bool
+	min      int
+	avg      int
+	max      int
+	maskHard uint64
+	maskEasy uint64
+}
+
+// NewCDC returns a CDC chunker, avg must be a power of 2 and
+// min <= avg <= max.
+func NewCDC(r io.Reader, min, avg, max int) (*CDC, error) {
+	if err := CheckCDC(min, avg, max); err != nil {
+		return nil, err
+	}
+
+	// Normalized chunking: two bits harder before avg and two
+	// bits easier after it. Masks take the top bits, which
+	// depend on the last 64 bytes rolled in.
+	level := bits.TrailingZeros(uint(avg))
+
+	return &CDC{
+		r:        r,
+		buffer:   make([]byte, 2*max),
+		min:      min,
+		avg:      avg,
+		max:      max,
+		maskHard: ^uint64(0) << (64 - (level + 2)),
+		maskEasy: ^uint64(0) << (64 - (level - 2)),
+	}, nil
+}
+
+// CheckCDC tells whether NewCDC takes the given sizes.
+func CheckCDC(min, avg, max int) error {
+	if avg < 64 || avg&(avg-1) != 0 {
+		return fmt.Errorf("Average chunk size %d must be a power of 2 of at least 64", avg)
+	}
+
+	if min < 1 || min > avg || avg > max {
+		return fmt.Errorf("Chunk sizes must be 0 < min <= avg <= max, got %d, %d and %d", min, avg, max)
+	}
+
+	return nil
+}
+
+func (c *CDC) Next() ([]byte, error) {
+	if c.end-c.begin < c.max && !c.eof {
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.begin == c.end {
+		return nil, io.EOF
+	}
+
+	n := c.cut(c.buffer[c.begin:c.end])
+	chunk := c.buffer[c.begin : c.begin+n]
+	c.begin += n
+
+	return chunk, nil
+}
+
+// fill moves what's left to the beginning of the buffer and
+// reads as much as fits after it.
+func (c *CDC) fill() error {
+	copy(c.buffer, c.buffer[c.begin:c.end])
+	c.end -= c.begin
+	c.begin = 0
+
+	n, err := io.ReadFull(c.r, c.buffer[c.end:])
+	c.end += n
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+
+	return err
+}
+
+// cut returns the length of the chunk data begins with.
+func (c *CDC) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+
+	if n > c.max {
+		n = c.max
+	}
+
+	normal := c.avg
+	if normal > n {
+		normal = n
+	}
+
+	hash := uint64(0)
+	i := c.min
+
+	for ; i < normal; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.maskHard == 0 {
+			return i + 1
+		}
+	}
+
+	for ; i < n; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.maskEasy == 0 {
+			return i + 1
+		}
+	}
+
+	return n
+}
+
+// gear maps bytes to random values. It's generated with a fixed
+// seed, since chunk boundaries, and anything computed from them,
+// must never change.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+
+	// splitmix64
+	state := uint64(0x6465_6c74_6164_6966)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+
+	return table
+}()
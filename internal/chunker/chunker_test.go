@@ -0,0 +1,91 @@
+package chunker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/franela/goblin"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestChunker(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("chunker", func() {
+
+		random := rand.New(rand.NewSource(47))
+
+		data := make([]byte, 1<<20)
+		random.Read(data)
+
+		chunks := func(c Chunker) [][]byte {
+			all := make([][]byte, 0)
+
+			for {
+				chunk, err := c.Next()
+				if err == io.EOF {
+					return all
+				}
+
+				g.Assert(err).Equal(nil)
+				all = append(all, append([]byte(nil), chunk...))
+			}
+		}
+
+		cdc := func(data []byte) [][]byte {
+			c, err := NewCDC(bytes.NewReader(data), 2048, 8192, 32768)
+			g.Assert(err).Equal(nil)
+			return chunks(c)
+		}
+
+		g.It("should split into fixed chunks", func() {
+			all := chunks(NewFixed(bytes.NewReader(data[:10000]), 4096))
+
+			g.Assert(len(all)).Equal(3)
+			g.Assert(len(all[2])).Equal(10000 - 8192)
+			g.Assert(bytes.Join(all, nil)).Equal(data[:10000])
+		})
+
+		g.It("should split into content-defined chunks around the average size", func() {
+			all := cdc(data)
+
+			g.Assert(bytes.Join(all, nil)).Equal(data)
+
+			for _, chunk := range all[:len(all)-1] {
+				g.Assert(len(chunk) >= 2048 && len(chunk) <= 32768).IsTrue()
+			}
+
+			average := len(data) / len(all)
+			g.Assert(average > 6000 && average < 12000).IsTrue()
+		})
+
+		g.It("should keep most chunks when data is shifted", func() {
+			before := make(map[[32]byte]bool)
+			for _, chunk := range cdc(data) {
+				before[sha256.Sum256(chunk)] = true
+			}
+
+			shifted := append([]byte("shifted by an insertion"), data...)
+			after := cdc(shifted)
+
+			kept := 0
+			for _, chunk := range after {
+				if before[sha256.Sum256(chunk)] {
+					kept++
+				}
+			}
+
+			g.Assert(kept >= len(after)-2).IsTrue()
+		})
+
+		g.It("should reject sizes it can't use", func() {
+			_, err := NewCDC(bytes.NewReader(nil), 2048, 5000, 32768)
+			g.Assert(err != nil).IsTrue()
+
+			_, err = NewCDC(bytes.NewReader(nil), 9000, 8192, 32768)
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}
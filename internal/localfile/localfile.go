@@ -0,0 +1,125 @@
+// Package localfile has what clients syncing a local file with
+// a remote one need: opening it as a base and replacing it.
+package localfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// File is a local file opened as a base.
+type File interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// OpenBase opens filename to be used as a base, or an empty
+// base if it doesn't exist, and returns its size.
+func OpenBase(filename string) (File, int64, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nopCloser{bytes.NewReader(nil)}, 0, nil
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, 0, fmt.Errorf("%s isn't a regular file", filename)
+	}
+
+	return file, info.Size(), nil
+}
+
+// Replace calls write with a temporary file next to filename,
+// which then replaces it, keeping its permissions, and returns
+// its size. If write fails, filename is left as it was.
+func Replace(filename string, write func(w io.Writer) error) (int64, error) {
+	out, err := ioutil.TempFile(filepath.Dir(filename), ".deltadiff-sync-")
+	if err != nil {
+		return 0, err
+	}
+
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+
+	if err := write(w); err != nil {
+		return 0, err
+	}
+
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := out.Chmod(mode); err != nil {
+		return 0, err
+	}
+
+	size, err := out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(out.Name(), filename); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// CountingReader counts the bytes read through it.
+type CountingReader struct {
+	R io.Reader
+	N int64
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	r.N += int64(n)
+	return n, err
+}
+
+// CountingWriter counts the bytes written through it.
+type CountingWriter struct {
+	W io.Writer
+	N int64
+}
+
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.W.Write(p)
+	w.N += int64(n)
+	return n, err
+}
@@ -0,0 +1,69 @@
+package deltadiff
+
+import (
+	"context"
+	"fmt"
+	"github.com/xrash/deltadiff/hasher"
+	"io"
+)
+
+type MatchConfig struct {
+	// If Progress is not nil, it's called as data is read and
+	// as blocks are looked for in it.
+	Progress ProgressFunc
+
+	// MemoryLimit and TempDir work as in DeltaConfig, with data
+	// in place of target.
+	MemoryLimit int64
+	TempDir     string
+}
+
+// BlockMatch is a block of the file a signature was made from,
+// found at Offset of another one.
+type BlockMatch struct {
+	Block  int
+	Offset int64
+}
+
+// MatchBlocks looks for the blocks of the file s was made from
+// in data, the same way Delta does, and returns the ones it
+// finds, in order. It's the other way around from Delta: given
+// the signature of a remote file, it tells which of its blocks
+// can be taken from a local one, and which must be fetched.
+func MatchBlocks(ctx context.Context, s *SignatureFile, data io.Reader, c *MatchConfig) ([]BlockMatch, error) {
+	if s.BlockSize <= 0 {
+		return nil, fmt.Errorf("%w: invalid block size %d", ErrCorruptSignature, s.BlockSize)
+	}
+
+	h, err := hasher.GetHasherByName(s.Hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	budget, window, err := targetBudget(s, h, c.MemoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := readTarget(data, budget, window, c.TempDir, c.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	defer src.Close()
+
+	matches, err := collectMatches(ctx, s, src, h, c.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]BlockMatch, 0, len(matches))
+	for _, m := range matches {
+		found = append(found, BlockMatch{
+			Block:  m.block,
+			Offset: int64(m.segmentBegin),
+		})
+	}
+
+	return found, nil
+}
@@ -0,0 +1,213 @@
+package deltadiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Rough sizes of what Delta keeps per block of base, used to
+// tell whether a signature fits DeltaConfig.MemoryLimit: the
+// hash and its slice header, a match, and up to two ops.
+const (
+	MEMORY_PER_BLOCK = 24 + 32 + 2*48
+
+	// The smallest window a target read from disk is
+	// accessed through, it's at least two blocks otherwise.
+	MIN_SPILL_WINDOW = 64 << 10
+)
+
+// deltaMemory estimates what Delta needs besides the target.
+func deltaMemory(blocks, hashSize, blockSize int) int64 {
+	return int64(blocks)*int64(MEMORY_PER_BLOCK+hashSize) + int64(blockSize)*8
+}
+
+func spillWindow(blockSize int) int {
+	if 2*blockSize > MIN_SPILL_WINDOW {
+		return 2 * blockSize
+	}
+
+	return MIN_SPILL_WINDOW
+}
+
+// source gives access to target, whether it's held in memory
+// or read from a file as needed.
+type source interface {
+	io.ReaderAt
+
+	Len() int
+
+	// Slice returns target[from:to], which is only valid until
+	// the next call. to-from must be at most the window size.
+	Slice(from, to int) ([]byte, error)
+
+	Close() error
+}
+
+type memorySource struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newMemorySource(data []byte) *memorySource {
+	return &memorySource{
+		Reader: bytes.NewReader(data),
+		data:   data,
+	}
+}
+
+func (s *memorySource) Len() int {
+	return len(s.data)
+}
+
+func (s *memorySource) Slice(from, to int) ([]byte, error) {
+	return s.data[from:to], nil
+}
+
+func (s *memorySource) Close() error {
+	return nil
+}
+
+// fileSource reads target from a file through a window, which
+// is refilled from wherever a slice begins when it's outside.
+type fileSource struct {
+	r      io.ReaderAt
+	size   int
+	window []byte
+	begin  int
+	end    int
+
+	// If spilled is not nil, it's a temporary file removed on
+	// Close.
+	spilled *os.File
+}
+
+func (s *fileSource) ReadAt(p []byte, off int64) (int, error) {
+	return s.r.ReadAt(p, off)
+}
+
+func (s *fileSource) Len() int {
+	return s.size
+}
+
+func (s *fileSource) Slice(from, to int) ([]byte, error) {
+	if from < s.begin || to > s.end {
+		end := from + len(s.window)
+		if end > s.size {
+			end = s.size
+		}
+
+		if _, err := s.r.ReadAt(s.window[:end-from], int64(from)); err != nil {
+			s.begin, s.end = 0, 0
+			return nil, fmt.Errorf("Error reading target at %d: %w", from, err)
+		}
+
+		s.begin, s.end = from, end
+	}
+
+	return s.window[from-s.begin : to-s.begin], nil
+}
+
+func (s *fileSource) Close() error {
+	if s.spilled == nil {
+		return nil
+	}
+
+	s.spilled.Close()
+
+	return os.Remove(s.spilled.Name())
+}
+
+// readTarget reads target into memory if budget allows it,
+// which it always does when it's 0. Otherwise a regular file is
+// read in place and anything else spilled to a temporary file
+// in tempDir, both read through a window of the given size.
+// Checking a file's size doesn't move its offset.
+func readTarget(in io.Reader, budget int64, window int, tempDir string, progress ProgressFunc) (source, error) {
+	if budget > 0 {
+		if s, ok := fileTarget(in); ok && int64(s.size) > budget {
+			s.window = make([]byte, window)
+			progress.report(PHASE_READING, int64(s.size), int64(s.size))
+			return s, nil
+		}
+	}
+
+	if progress != nil {
+		in = &progressReader{
+			r:        in,
+			phase:    PHASE_READING,
+			progress: progress,
+		}
+	}
+
+	if budget <= 0 {
+		content, err := ioutil.ReadAll(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return newMemorySource(content), nil
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(in, budget+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(content)) <= budget {
+		return newMemorySource(content), nil
+	}
+
+	return spill(content, in, window, tempDir)
+}
+
+// fileTarget returns a source reading in from where it's at,
+// if it's a regular file.
+func fileTarget(in io.Reader) (*fileSource, bool) {
+	file, ok := in.(*os.File)
+	if !ok {
+		return nil, false
+	}
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil || offset > info.Size() {
+		return nil, false
+	}
+
+	size := info.Size() - offset
+
+	return &fileSource{
+		r:    io.NewSectionReader(file, offset, size),
+		size: int(size),
+	}, true
+}
+
+func spill(head []byte, rest io.Reader, window int, tempDir string) (source, error) {
+	file, err := ioutil.TempFile(tempDir, "deltadiff-target-")
+	if err != nil {
+		return nil, fmt.Errorf("Error spilling target to disk: %w", err)
+	}
+
+	s := &fileSource{
+		r:       file,
+		window:  make([]byte, window),
+		spilled: file,
+	}
+
+	written, err := io.Copy(file, io.MultiReader(bytes.NewReader(head), rest))
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Error spilling target to disk: %w", err)
+	}
+
+	s.size = int(written)
+
+	return s, nil
+}
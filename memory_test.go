@@ -0,0 +1,103 @@
+package deltadiff
+
+import (
+	"bytes"
+	"errors"
+	"github.com/franela/goblin"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryLimit(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("memory limit", func() {
+
+		random := rand.New(rand.NewSource(41))
+
+		base := make([]byte, 200000)
+		random.Read(base)
+
+		target := append([]byte("a new beginning"), base[:50176]...)
+		target = append(target, base[51200:]...)
+		target = append(target, []byte("and a new end")...)
+
+		signature := bytes.NewBuffer(nil)
+		err := Signature(bytes.NewReader(base), signature, &SignatureConfig{
+			Hasher:    "md5",
+			BlockSize: 1024,
+			BaseSize:  len(base),
+		})
+		g.Assert(err).Equal(nil)
+
+		delta := func(target io.Reader, c *DeltaConfig) ([]byte, error) {
+			delta := bytes.NewBuffer(nil)
+			err := Delta(bytes.NewReader(signature.Bytes()), target, delta, c)
+			return delta.Bytes(), err
+		}
+
+		expected, err := delta(bytes.NewReader(target), &DeltaConfig{Checksum: true})
+		g.Assert(err).Equal(nil)
+
+		g.It("should spill targets that don't fit to disk", func() {
+			dir := t.TempDir()
+			stats := &DeltaStats{}
+
+			// Wrapping target so it can't be told from a pipe.
+			d, err := delta(struct{ io.Reader }{bytes.NewReader(target)}, &DeltaConfig{
+				Checksum:    true,
+				MemoryLimit: 150000,
+				TempDir:     dir,
+				Stats:       stats,
+			})
+
+			g.Assert(err).Equal(nil)
+			g.Assert(d).Equal(expected)
+			g.Assert(stats.TargetSize).Equal(len(target))
+
+			left, err := ioutil.ReadDir(dir)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(left)).Equal(0)
+		})
+
+		g.It("should read regular files in place", func() {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "target")
+			g.Assert(ioutil.WriteFile(filename, target, 0644)).Equal(nil)
+
+			file, err := os.Open(filename)
+			g.Assert(err).Equal(nil)
+			defer file.Close()
+
+			d, err := delta(file, &DeltaConfig{
+				Checksum:    true,
+				MemoryLimit: 150000,
+				TempDir:     filepath.Join(dir, "missing"),
+			})
+
+			g.Assert(err).Equal(nil)
+			g.Assert(d).Equal(expected)
+		})
+
+		g.It("should keep targets that fit in memory", func() {
+			d, err := delta(bytes.NewReader(target), &DeltaConfig{
+				Checksum:    true,
+				MemoryLimit: 1 << 30,
+				TempDir:     filepath.Join(t.TempDir(), "missing"),
+			})
+
+			g.Assert(err).Equal(nil)
+			g.Assert(d).Equal(expected)
+		})
+
+		g.It("should fail early when the signature doesn't fit", func() {
+			_, err := delta(bytes.NewReader(target), &DeltaConfig{MemoryLimit: 50000})
+			g.Assert(errors.Is(err, ErrMemoryLimit)).Equal(true)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+package netsync
+
+import (
+	"bufio"
+	"context"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/hasher"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"github.com/xrash/deltadiff/internal/localfile"
+	"io"
+)
+
+type ClientConfig struct {
+	// Hasher is the hasher the client would rather use. The
+	// others it knows are offered to the server after it.
+	Hasher string
+
+	// BlockSize is passed to Signature, 0 picks it from the
+	// size of the local file.
+	BlockSize int
+
+	// If MaxSize is positive, syncing a file larger than it
+	// fails, see PatchConfig.MaxOutputSize.
+	MaxSize int64
+
+	// If Progress is not nil, it's called as the local file is
+	// hashed and patched.
+	Progress deltadiff.ProgressFunc
+}
+
+// SyncResult describes a file that was synced.
+type SyncResult struct {
+	// Size is the size of the file, DeltaSize how many bytes
+	// of delta were received to sync it.
+	Size      int64
+	DeltaSize int64
+}
+
+// Client syncs files from a server, one at a time, over a
+// single connection.
+type Client struct {
+	r      io.Reader
+	w      *bufio.Writer
+	c      *ClientConfig
+	hasher string
+
+	// broken is set once the connection can't be used anymore.
+	broken error
+}
+
+// NewClient says hello to the server on the other side of rw
+// and agrees on a hasher with it.
+func NewClient(rw io.ReadWriter, c *ClientConfig) (*Client, error) {
+	cl := &Client{
+		r: rw,
+		w: bufio.NewWriter(rw),
+		c: c,
+	}
+
+	names := []string{c.Hasher}
+	for _, info := range hasher.Hashers() {
+		if info.Name != c.Hasher {
+			names = append(names, info.Name)
+		}
+	}
+
+	writeMagic(cl.w)
+	writeFrame(cl.w, FRAME_HELLO, encode(func(w *binfmt.Writer) {
+		w.Uint32(uint32(len(names)))
+		for _, name := range names {
+			w.String(name)
+		}
+	}))
+
+	if err := cl.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err := readMagic(rw); err != nil {
+		return nil, err
+	}
+
+	payload, err := expectFrame(rw, FRAME_HELLO)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decode(payload, func(r *binfmt.Reader) { cl.hasher = r.String() }); err != nil {
+		return nil, err
+	}
+
+	return cl, nil
+}
+
+// Hasher returns the hasher agreed on with the server.
+func (cl *Client) Hasher() string {
+	return cl.hasher
+}
+
+// Sync makes the file at local a copy of the file at remote
+// on the server, receiving only a delta from the server. If
+// local doesn't exist, it's created, and the whole file is
+// received. local is only replaced once the copy is complete
+// and its checksum matches.
+func (cl *Client) Sync(remote, local string) (*SyncResult, error) {
+	if cl.broken != nil {
+		return nil, cl.broken
+	}
+
+	base, baseSize, err := localfile.OpenBase(local)
+	if err != nil {
+		return nil, err
+	}
+	defer base.Close()
+
+	if err := cl.request(remote, base, baseSize); err != nil {
+		cl.broken = err
+		return nil, err
+	}
+
+	if _, err := base.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data := newDataReader(cl.r)
+	delta := &localfile.CountingReader{R: data}
+
+	size, err := cl.patch(base, delta, local)
+	if err != nil {
+		// The rest of the delta must go before anything else
+		// can be read.
+		if err := data.drain(); err != nil {
+			cl.broken = err
+		}
+
+		// Patch failed because the server did, its error is
+		// the one that matters.
+		if remote, ok := data.err.(*RemoteError); ok {
+			return nil, remote
+		}
+
+		return nil, err
+	}
+
+	return &SyncResult{
+		Size:      size,
+		DeltaSize: delta.N,
+	}, nil
+}
+
+// request sends the request for remote along with the
+// signature of base.
+func (cl *Client) request(remote string, base io.Reader, baseSize int64) error {
+	writeFrame(cl.w, FRAME_REQUEST, encode(func(w *binfmt.Writer) { w.String(remote) }))
+
+	c := &deltadiff.SignatureConfig{
+		Hasher:    cl.hasher,
+		BlockSize: cl.c.BlockSize,
+		BaseSize:  int(baseSize),
+		Progress:  cl.c.Progress,
+	}
+
+	dw := newDataWriter(cl.w)
+	if err := deltadiff.Signature(base, dw, c); err != nil {
+		return err
+	}
+
+	if err := dw.Close(); err != nil {
+		return err
+	}
+
+	return cl.w.Flush()
+}
+
+// patch applies delta to base into local.
+func (cl *Client) patch(base io.Reader, delta io.Reader, local string) (int64, error) {
+	c := &deltadiff.PatchConfig{
+		MaxOutputSize: cl.c.MaxSize,
+		Progress:      cl.c.Progress,
+	}
+
+	return localfile.Replace(local, func(w io.Writer) error {
+		return deltadiff.PatchWithConfig(context.Background(), base, delta, w, c)
+	})
+}
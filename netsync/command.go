@@ -0,0 +1,46 @@
+package netsync
+
+import (
+	"io"
+	"os/exec"
+)
+
+// Command starts cmd and returns a connection over its standard
+// input and output, such as a remote shell running a server
+// over its own standard input and output. Closing it closes the
+// standard input of cmd and waits for it to exit.
+func Command(cmd *exec.Cmd) (io.ReadWriteCloser, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &commandConn{
+		Reader: stdout,
+		Writer: stdin,
+		stdin:  stdin,
+		cmd:    cmd,
+	}, nil
+}
+
+type commandConn struct {
+	io.Reader
+	io.Writer
+
+	stdin io.Closer
+	cmd   *exec.Cmd
+}
+
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
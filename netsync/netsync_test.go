@@ -0,0 +1,202 @@
+package netsync
+
+import (
+	"bytes"
+	"errors"
+	"github.com/franela/goblin"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetsync(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("netsync", func() {
+
+		random := rand.New(rand.NewSource(42))
+
+		content := make([]byte, 100000)
+		random.Read(content)
+
+		root := t.TempDir()
+		local := t.TempDir()
+
+		err := ioutil.WriteFile(filepath.Join(root, "file"), content, 0644)
+		g.Assert(err).Equal(nil)
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		g.Assert(err).Equal(nil)
+
+		g.After(func() {
+			l.Close()
+		})
+
+		s := &Server{
+			Root: root,
+		}
+
+		go s.Serve(l)
+
+		dial := func() *Client {
+			conn, err := net.Dial("tcp", l.Addr().String())
+			g.Assert(err).Equal(nil)
+
+			cl, err := NewClient(conn, &ClientConfig{
+				Hasher:    "polyroll",
+				BlockSize: 1024,
+			})
+			g.Assert(err).Equal(nil)
+
+			return cl
+		}
+
+		g.It("should agree on the client's hasher", func() {
+			cl := dial()
+			g.Assert(cl.Hasher()).Equal("polyroll")
+		})
+
+		g.It("should create files that don't exist locally", func() {
+			cl := dial()
+			filename := filepath.Join(local, "new")
+
+			result, err := cl.Sync("file", filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Size).Equal(int64(len(content)))
+
+			synced, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(synced).Equal(content)
+		})
+
+		g.It("should only receive what changed", func() {
+			cl := dial()
+			filename := filepath.Join(local, "changed")
+
+			changed := append([]byte(nil), content...)
+			copy(changed[50000:], "something changed here")
+
+			err := ioutil.WriteFile(filename, changed, 0600)
+			g.Assert(err).Equal(nil)
+
+			result, err := cl.Sync("file", filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(result.DeltaSize < 4096).IsTrue()
+
+			synced, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(synced).Equal(content)
+
+			info, err := os.Stat(filename)
+			g.Assert(err).Equal(nil)
+			g.Assert(info.Mode().Perm()).Equal(os.FileMode(0600))
+		})
+
+		g.It("should report missing files and keep going", func() {
+			cl := dial()
+			filename := filepath.Join(local, "kept")
+
+			_, err := cl.Sync("missing", filename)
+
+			var remote *RemoteError
+			g.Assert(errors.As(err, &remote)).IsTrue()
+
+			_, err = os.Stat(filename)
+			g.Assert(os.IsNotExist(err)).IsTrue()
+
+			_, err = cl.Sync("file", filename)
+			g.Assert(err).Equal(nil)
+		})
+
+		g.It("should not serve files outside of root", func() {
+			secret := filepath.Join(filepath.Dir(root), "secret")
+			err := ioutil.WriteFile(secret, []byte("secret"), 0644)
+			g.Assert(err).Equal(nil)
+			defer os.Remove(secret)
+
+			cl := dial()
+
+			_, err = cl.Sync("../secret", filepath.Join(local, "secret"))
+
+			var remote *RemoteError
+			g.Assert(errors.As(err, &remote)).IsTrue()
+		})
+
+		g.It("should reject peers that don't speak the protocol", func() {
+			rw := &struct {
+				io.Reader
+				io.Writer
+			}{
+				bytes.NewReader([]byte("HTTP/1.1 400 Bad Request\r\n")),
+				ioutil.Discard,
+			}
+
+			_, err := NewClient(rw, &ClientConfig{Hasher: "polyroll"})
+			g.Assert(errors.Is(err, ErrProtocol)).IsTrue()
+		})
+	})
+}
+
+func TestCommand(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("command", func() {
+
+		g.It("should sync through a server speaking over stdin and stdout", func() {
+			content := []byte("content of a file served by a subprocess")
+
+			dir := t.TempDir()
+			remote := filepath.Join(dir, "remote")
+			local := filepath.Join(dir, "local")
+
+			err := ioutil.WriteFile(remote, content, 0644)
+			g.Assert(err).Equal(nil)
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestServerProcess$")
+			cmd.Env = append(os.Environ(), "NETSYNC_SERVER_PROCESS=1")
+
+			conn, err := Command(cmd)
+			g.Assert(err).Equal(nil)
+
+			cl, err := NewClient(conn, &ClientConfig{Hasher: "polyroll"})
+			g.Assert(err).Equal(nil)
+
+			_, err = cl.Sync(remote, local)
+			g.Assert(err).Equal(nil)
+
+			synced, err := ioutil.ReadFile(local)
+			g.Assert(err).Equal(nil)
+			g.Assert(synced).Equal(content)
+
+			g.Assert(conn.Close()).Equal(nil)
+		})
+	})
+}
+
+// TestServerProcess isn't a test, it's the server TestCommand
+// runs as a subprocess.
+func TestServerProcess(t *testing.T) {
+	if os.Getenv("NETSYNC_SERVER_PROCESS") != "1" {
+		return
+	}
+
+	s := &Server{}
+
+	err := s.ServeConn(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout})
+
+	if err != nil {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
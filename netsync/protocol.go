@@ -0,0 +1,268 @@
+// Package netsync syncs files over a connection: the client
+// sends the signature of its copy of a file, and the server
+// answers with a delta that turns it into the server's copy.
+//
+// Both sides begin by writing PROTOCOL_MAGIC. After that,
+// everything is a frame: a 1 byte type, a 4 byte length and
+// that many bytes of payload. The client says hello with the
+// hashers it knows, the server answers with the one to use,
+// and then, for each file, the client sends a request followed
+// by the signature in data frames, and the server answers with
+// the delta in data frames. An empty data frame ends both. The
+// server may send an error frame instead of any of its frames.
+package netsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+	"io/ioutil"
+)
+
+const PROTOCOL_MAGIC = "DDSYNC01"
+
+// DEFAULT_PORT is where servers listen unless told otherwise.
+const DEFAULT_PORT = "8722"
+
+const (
+	FRAME_HELLO   uint8 = 1
+	FRAME_REQUEST uint8 = 2
+	FRAME_DATA    uint8 = 3
+	FRAME_ERROR   uint8 = 4
+)
+
+const (
+	// Frames with a larger payload are a protocol error.
+	MAX_FRAME_SIZE = 1 << 20
+
+	// Data is sent in frames of at most this size.
+	DATA_FRAME_SIZE = 32 << 10
+)
+
+// ErrProtocol means the other side doesn't speak the protocol,
+// or not the same version of it.
+var ErrProtocol = errors.New("Protocol error")
+
+// RemoteError is an error the server reported, such as a file
+// that doesn't exist.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("Remote error: %s", e.Message)
+}
+
+func writeMagic(w io.Writer) error {
+	_, err := io.WriteString(w, PROTOCOL_MAGIC)
+	return err
+}
+
+func readMagic(r io.Reader) error {
+	magic := make([]byte, len(PROTOCOL_MAGIC))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fmt.Errorf("%w: %v", ErrProtocol, err)
+	}
+
+	if string(magic) != PROTOCOL_MAGIC {
+		return fmt.Errorf("%w: bad magic %q, expected %q", ErrProtocol, magic, PROTOCOL_MAGIC)
+	}
+
+	return nil
+}
+
+func writeFrame(w io.Writer, kind uint8, payload []byte) error {
+	header := make([]byte, 5)
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads the next frame. Headers are read as is
+// rather than through a buffer, so nothing past the frame is
+// consumed.
+func readFrame(r io.Reader) (uint8, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MAX_FRAME_SIZE {
+		return 0, nil, fmt.Errorf("%w: frame of %d bytes is larger than %d", ErrProtocol, size, MAX_FRAME_SIZE)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return 0, nil, err
+	}
+
+	return header[0], payload, nil
+}
+
+// expectFrame reads a frame of the given kind, turning error
+// frames into a *RemoteError.
+func expectFrame(r io.Reader, kind uint8) ([]byte, error) {
+	got, payload, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if got == FRAME_ERROR {
+		return nil, &RemoteError{Message: string(payload)}
+	}
+
+	if got != kind {
+		return nil, fmt.Errorf("%w: got frame %d, expected %d", ErrProtocol, got, kind)
+	}
+
+	return payload, nil
+}
+
+func writeError(w io.Writer, err error) error {
+	return writeFrame(w, FRAME_ERROR, []byte(err.Error()))
+}
+
+// encode builds a payload out of binfmt fields.
+func encode(f func(w *binfmt.Writer)) []byte {
+	buffer := bytes.NewBuffer(nil)
+	w := binfmt.NewWriter(buffer)
+	f(w)
+	w.Flush()
+
+	return buffer.Bytes()
+}
+
+// decode reads binfmt fields out of a payload.
+func decode(payload []byte, f func(r *binfmt.Reader)) error {
+	r := binfmt.NewReader(bytes.NewReader(payload))
+	f(r)
+
+	if r.Err != nil {
+		return fmt.Errorf("%w: %v", ErrProtocol, r.Err)
+	}
+
+	return nil
+}
+
+// dataWriter sends what's written to it as data frames, and
+// an empty one on Close.
+type dataWriter struct {
+	w      io.Writer
+	buffer []byte
+}
+
+func newDataWriter(w io.Writer) *dataWriter {
+	return &dataWriter{
+		w:      w,
+		buffer: make([]byte, 0, DATA_FRAME_SIZE),
+	}
+}
+
+func (dw *dataWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := copy(dw.buffer[len(dw.buffer):cap(dw.buffer)], p)
+		dw.buffer = dw.buffer[:len(dw.buffer)+n]
+		p = p[n:]
+		written += n
+
+		if len(dw.buffer) == cap(dw.buffer) {
+			if err := dw.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (dw *dataWriter) flush() error {
+	if len(dw.buffer) == 0 {
+		return nil
+	}
+
+	err := writeFrame(dw.w, FRAME_DATA, dw.buffer)
+	dw.buffer = dw.buffer[:0]
+
+	return err
+}
+
+func (dw *dataWriter) Close() error {
+	if err := dw.flush(); err != nil {
+		return err
+	}
+
+	return writeFrame(dw.w, FRAME_DATA, nil)
+}
+
+// dataReader reads the data frames sent by a dataWriter, up to
+// the empty one, which is io.EOF. An error frame ends the data
+// too, with a *RemoteError.
+type dataReader struct {
+	r       io.Reader
+	pending []byte
+	done    bool
+	err     error
+}
+
+func newDataReader(r io.Reader) *dataReader {
+	return &dataReader{
+		r: r,
+	}
+}
+
+func (dr *dataReader) Read(p []byte) (int, error) {
+	for len(dr.pending) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+
+		if dr.done {
+			return 0, io.EOF
+		}
+
+		payload, err := expectFrame(dr.r, FRAME_DATA)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			dr.err = err
+			return 0, err
+		}
+
+		dr.pending = payload
+		dr.done = len(payload) == 0
+	}
+
+	n := copy(p, dr.pending)
+	dr.pending = dr.pending[n:]
+
+	return n, nil
+}
+
+// drain reads what's left of the data, so the next frame can
+// be read. It only fails if the connection is broken.
+func (dr *dataReader) drain() error {
+	_, err := io.Copy(ioutil.Discard, dr)
+	if _, ok := err.(*RemoteError); ok {
+		return nil
+	}
+
+	return err
+}
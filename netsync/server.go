@@ -0,0 +1,191 @@
+package netsync
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/hasher"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Server serves the files under Root to clients.
+type Server struct {
+	// Root is the directory files are served from. Requests
+	// can't reach outside of it. If it's empty, requests are
+	// taken as paths as they are, which is meant for servers
+	// started through a remote shell, where the client could
+	// read any file anyway.
+	Root string
+
+	// MemoryLimit is passed to Delta, see DeltaConfig.
+	MemoryLimit int64
+
+	// If ErrorLog is not nil, errors of connections and
+	// requests are logged to it.
+	ErrorLog *log.Logger
+}
+
+// Serve accepts connections on l and serves each of them in
+// its own goroutine, until accepting fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+
+			if err := s.ServeConn(conn); err != nil {
+				s.logf("Error serving %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// ServeConn speaks the protocol over rw until the client is
+// done with it. Errors about a single file are sent to the
+// client, and only errors that break the connection are
+// returned.
+func (s *Server) ServeConn(rw io.ReadWriter) error {
+	w := bufio.NewWriter(rw)
+
+	if err := writeMagic(w); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := readMagic(rw); err != nil {
+		return err
+	}
+
+	if err := s.hello(rw, w); err != nil {
+		return err
+	}
+
+	for {
+		kind, payload, err := readFrame(rw)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if kind != FRAME_REQUEST {
+			return fmt.Errorf("%w: got frame %d, expected a request", ErrProtocol, kind)
+		}
+
+		var remote string
+		if err := decode(payload, func(r *binfmt.Reader) { remote = r.String() }); err != nil {
+			return err
+		}
+
+		if err := s.serveFile(rw, w, remote); err != nil {
+			return err
+		}
+	}
+}
+
+// hello picks the first hasher of the client's that the
+// server knows too.
+func (s *Server) hello(r io.Reader, w *bufio.Writer) error {
+	payload, err := expectFrame(r, FRAME_HELLO)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+
+	err = decode(payload, func(r *binfmt.Reader) {
+		n := r.Uint32()
+		for i := uint32(0); i < n && r.Err == nil; i++ {
+			names = append(names, r.String())
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := hasher.GetHasherByName(name); err == nil {
+			writeFrame(w, FRAME_HELLO, encode(func(w *binfmt.Writer) { w.String(name) }))
+			return w.Flush()
+		}
+	}
+
+	err = fmt.Errorf("No hasher in common, the client knows %s", strings.Join(names, ", "))
+	writeError(w, err)
+	w.Flush()
+
+	return err
+}
+
+// serveFile answers a request with the delta of remote, or
+// with an error frame if it can't be made.
+func (s *Server) serveFile(r io.Reader, w *bufio.Writer, remote string) error {
+	signature := newDataReader(r)
+
+	err := s.delta(signature, w, remote)
+	if err != nil {
+		s.logf("Error serving %s: %v", remote, err)
+		writeError(w, err)
+	}
+
+	// Whatever Delta didn't read of the signature must go
+	// before the next request can be read.
+	if err := signature.drain(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func (s *Server) delta(signature io.Reader, w io.Writer, remote string) error {
+	filename := remote
+	if s.Root != "" {
+		filename = filepath.Join(s.Root, filepath.FromSlash(path.Clean("/"+remote)))
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Can't open %s", remote)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return fmt.Errorf("%s isn't a regular file", remote)
+	}
+
+	c := &deltadiff.DeltaConfig{
+		Checksum:    true,
+		MemoryLimit: s.MemoryLimit,
+	}
+
+	dw := newDataWriter(w)
+	if err := deltadiff.Delta(signature, file, dw, c); err != nil {
+		return err
+	}
+
+	return dw.Close()
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	}
+}
@@ -1,14 +1,129 @@
 package deltadiff
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 )
 
 const (
 	OP_WRITE uint16 = 0
 	OP_READ  uint16 = 1
+
+	// OP_ABORT is written when making a delta is canceled
+	// halfway through, so what was written so far can't be
+	// mistaken for a complete delta. It has no operands.
+	OP_ABORT uint16 = 2
+
+	// OP_CHECKSUM holds the SHA-256 of everything the ops
+	// before it output. It's optional, see DeltaConfig.Checksum.
+	OP_CHECKSUM uint16 = 3
 )
 
+// Op is a single delta operation, either a *ReadOp, a
+// *WriteOp or a *ChecksumOp. MarshalBinary returns the op as it is laid out
+// in a delta.
+type Op interface {
+	// Kind returns "read", "write" or "checksum".
+	Kind() string
+
+	// Len returns how many bytes the op contributes to
+	// the patched output.
+	Len() int
+
+	MarshalBinary() ([]byte, error)
+}
+
+// ReadOp copies base[From:To] to the output.
+type ReadOp struct {
+	From int
+	To   int
+}
+
+func (op *ReadOp) Kind() string {
+	return "read"
+}
+
+func (op *ReadOp) Len() int {
+	return op.To - op.From
+}
+
+func (op *ReadOp) MarshalBinary() ([]byte, error) {
+	if op.From < 0 || op.To < op.From || uint64(op.To) > 0xffffffff {
+		return nil, fmt.Errorf("Invalid read op %d-%d", op.From, op.To)
+	}
+
+	return opRead(op.From, op.To), nil
+}
+
+// WriteOp writes Data, which was taken from target, to the output.
+type WriteOp struct {
+	Data []byte
+}
+
+func (op *WriteOp) Kind() string {
+	return "write"
+}
+
+func (op *WriteOp) Len() int {
+	return len(op.Data)
+}
+
+func (op *WriteOp) MarshalBinary() ([]byte, error) {
+	if uint64(len(op.Data)) > 0xffffffff {
+		return nil, fmt.Errorf("Write op of %d bytes is too large", len(op.Data))
+	}
+
+	return opWrite(op.Data), nil
+}
+
+// ChecksumOp outputs nothing. Digest is the SHA-256 of the
+// output of the ops before it, which Patch checks.
+type ChecksumOp struct {
+	Digest []byte
+}
+
+func (op *ChecksumOp) Kind() string {
+	return "checksum"
+}
+
+func (op *ChecksumOp) Len() int {
+	return 0
+}
+
+func (op *ChecksumOp) MarshalBinary() ([]byte, error) {
+	if len(op.Digest) != sha256.Size {
+		return nil, fmt.Errorf("Checksum of %d bytes must have %d instead", len(op.Digest), sha256.Size)
+	}
+
+	return opChecksum(op.Digest), nil
+}
+
+// OpCounts tallies the ops of a delta by kind, so everything
+// that reports how many ops a delta has counts them the same.
+type OpCounts struct {
+	Reads     int
+	Writes    int
+	Checksums int
+}
+
+// Add counts op.
+func (c *OpCounts) Add(op Op) {
+	switch op.Kind() {
+	case "read":
+		c.Reads++
+	case "write":
+		c.Writes++
+	case "checksum":
+		c.Checksums++
+	}
+}
+
+// Total is how many ops were counted, checksum ops included.
+func (c *OpCounts) Total() int {
+	return c.Reads + c.Writes + c.Checksums
+}
+
 func opRead(from, to int) []byte {
 	opcodeBytes := make([]byte, 2)
 	fromBytes := make([]byte, 4)
@@ -40,3 +155,14 @@ func opWrite(data []byte) []byte {
 
 	return op
 }
+
+func opChecksum(digest []byte) []byte {
+	opcodeBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(opcodeBytes, OP_CHECKSUM)
+
+	op := make([]byte, 0)
+	op = append(op, opcodeBytes...)
+	op = append(op, digest...)
+
+	return op
+}
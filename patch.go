@@ -1,133 +1,181 @@
 package deltadiff
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"fmt"
+	"github.com/xrash/deltadiff/deltacrypt"
+	"github.com/xrash/deltadiff/deltasign"
 	"github.com/xrash/deltadiff/readseeker"
 	"io"
 )
 
+// Patch applies delta to base and writes the result to out.
+// Deltas made by Delta only read base forwards, so base can
+// be any reader. Deltas that read base out of order, such as
+// the ones made by tardiff, need base to be an io.ReadSeeker.
+// Checksum ops are checked against what was output before
+// them, failing with ErrChecksumMismatch.
 func Patch(base, delta io.Reader, out io.Writer) error {
-	basers := readseeker.NewBasicReadSeeker(base)
-
-	for {
-		opcodeBytes := make([]byte, 2)
-		bytesRead, err := delta.Read(opcodeBytes)
-		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
-
-			return err
-		}
-
-		if bytesRead != 2 {
-			return fmt.Errorf("Didn't read expected 2 bytes, read %d instead", bytesRead)
-		}
-
-		opcode := binary.BigEndian.Uint16(opcodeBytes)
+	return PatchWithConfig(context.Background(), base, delta, out, &PatchConfig{})
+}
 
-		switch opcode {
-		case OP_WRITE:
-			if err := doPatchWrite(delta, out); err != nil {
-				return fmt.Errorf("doPatchWrite: %v", err)
-			}
+// PatchContext is like Patch, but stops between ops once ctx
+// is done and returns ctx.Err(). Whatever was written to out
+// by then is incomplete and must be discarded.
+func PatchContext(ctx context.Context, base, delta io.Reader, out io.Writer) error {
+	return PatchWithConfig(ctx, base, delta, out, &PatchConfig{})
+}
 
-		case OP_READ:
-			if err := doPatchRead(basers, delta, out); err != nil {
-				return fmt.Errorf("doPatchRead: %v", err)
-			}
+type PatchConfig struct {
+	// If Progress is not nil, it's called as the output is
+	// written. The total isn't known while patching.
+	Progress ProgressFunc
+
+	// If MaxOutputSize is positive, deltas that output more
+	// bytes fail with ErrLimitExceeded before the op that goes
+	// past it is applied.
+	MaxOutputSize int64
+
+	// If MaxOpSize is positive, deltas with an op that outputs
+	// more bytes fail with ErrLimitExceeded.
+	MaxOpSize int64
+
+	// If DecryptKey is not nil, the delta is decrypted with it
+	// as it's read, see DeltaConfig.EncryptKey. Deltas that
+	// were tampered with fail with deltacrypt.ErrAuthentication
+	// before any tampered op is applied.
+	DecryptKey *deltacrypt.Key
+
+	// If TrustedKeys is not nil, the delta must be signed by
+	// one of them, see DeltaConfig.SignKey. It's read whole and
+	// its signature checked before anything is written, failing
+	// with deltasign.ErrUntrusted or deltasign.ErrBadSignature.
+	// Meanwhile, it's kept in a temporary file in TempDir,
+	// os.TempDir() if it's empty.
+	TrustedKeys []ed25519.PublicKey
+	TempDir     string
+}
 
-		default:
-			return fmt.Errorf("Unknown operation %v", opcode)
+// PatchWithConfig is like PatchContext, with the options in c.
+// Every op is checked before it's applied, and data is copied
+// in chunks, so memory use doesn't depend on what the delta
+// claims. Patching a delta from an untrusted source still
+// should set the limits in c.
+func PatchWithConfig(ctx context.Context, base, delta io.Reader, out io.Writer, c *PatchConfig) error {
+	done := int64(0)
 
+	if c.TrustedKeys != nil {
+		content, err := deltasign.Open(delta, c.TrustedKeys, c.TempDir)
+		if err != nil {
+			return err
 		}
-	}
 
-	return nil
+		defer content.Close()
 
-}
+		delta = content
+	}
 
-func doPatchRead(base io.ReadSeeker, delta io.Reader, out io.Writer) error {
-	fromBytes := make([]byte, 4)
-	fromRead, err := delta.Read(fromBytes)
+	if c.DecryptKey != nil {
+		decrypted, err := deltacrypt.NewReader(delta, c.DecryptKey)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
+		delta = decrypted
 	}
 
-	if fromRead != 4 {
-		return fmt.Errorf("Didn't read expected 4 bytes, read %d instead", fromRead)
+	basers, ok := base.(io.ReadSeeker)
+	if !ok {
+		basers = readseeker.NewBasicReadSeeker(base)
 	}
+	decoder := NewDeltaDecoder(delta)
 
-	toBytes := make([]byte, 4)
-	toRead, err := delta.Read(toBytes)
+	digest := sha256.New()
+	out = io.MultiWriter(out, digest)
 
-	if err != nil {
-		return err
-	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	if toRead != 4 {
-		return fmt.Errorf("Didn't read expected 4 bytes, read %d instead", toRead)
-	}
+		index, offset := decoder.Index(), decoder.Offset()
 
-	from := binary.BigEndian.Uint32(fromBytes)
-	to := binary.BigEndian.Uint32(toBytes)
+		op, err := decoder.nextHeader()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
 
-	seekd, err := base.Seek(int64(from), 0)
-	if err != nil {
-		return err
-	}
+			return err
+		}
 
-	if seekd != int64(from) {
-		return err
-	}
+		err = checkLimits(op, done, c)
+		if err == nil {
+			switch op := op.(type) {
+			case *literal:
+				err = decoder.copyLiteral(op, out)
+			case *ReadOp:
+				err = doPatchRead(basers, op, out)
+			case *ChecksumOp:
+				err = checkChecksum(op, digest.Sum(nil))
+			}
+		}
 
-	buffer := make([]byte, to-from)
-	bufferRead, err := base.Read(buffer)
-	if err != nil {
-		return err
+		if err != nil {
+			return &OpError{
+				Index:  index,
+				Offset: offset,
+				Err:    err,
+			}
+		}
+
+		done += int64(op.Len())
+		c.Progress.report(PHASE_PATCHING, done, -1)
 	}
+}
 
-	if bufferRead != len(buffer) {
-		return fmt.Errorf("Didn't read expected %d bytes, read %d instead", len(buffer), bufferRead)
+func checkLimits(op Op, done int64, c *PatchConfig) error {
+	size := int64(op.Len())
+
+	if c.MaxOpSize > 0 && size > c.MaxOpSize {
+		return fmt.Errorf("%w: op outputs %d bytes, more than %d", ErrLimitExceeded, size, c.MaxOpSize)
 	}
 
-	written, err := out.Write(buffer)
-	if written != len(buffer) {
-		return fmt.Errorf("Didnt write expected %d, wrote %d instead", len(buffer), written)
+	if c.MaxOutputSize > 0 && done+size > c.MaxOutputSize {
+		return fmt.Errorf("%w: output reaches %d bytes, more than %d", ErrLimitExceeded, done+size, c.MaxOutputSize)
 	}
 
 	return nil
 }
 
-func doPatchWrite(delta io.Reader, out io.Writer) error {
-	datalenBytes := make([]byte, 4)
-	datalenRead, err := delta.Read(datalenBytes)
+func doPatchRead(base io.ReadSeeker, op *ReadOp, out io.Writer) error {
+	if op.To < op.From {
+		return fmt.Errorf("%w: invalid read op %d-%d", ErrCorruptDelta, op.From, op.To)
+	}
 
+	seekd, err := base.Seek(int64(op.From), io.SeekStart)
 	if err != nil {
-		return err
+		return truncated(err, ErrBaseTooShort, "it ends before %d", op.From)
 	}
 
-	if datalenRead != 4 {
-		return fmt.Errorf("Didn't read expected 4 bytes, read %d instead", datalenRead)
+	if seekd != int64(op.From) {
+		return fmt.Errorf("%w: it ends at %d, before %d", ErrBaseTooShort, seekd, op.From)
 	}
 
-	datalen := binary.BigEndian.Uint32(datalenBytes)
-
-	data := make([]byte, datalen)
-	dataRead, err := delta.Read(data)
-	if err != nil {
-		return err
+	// Copying in chunks instead of holding the whole range.
+	if _, err := io.CopyN(out, base, int64(op.Len())); err != nil {
+		return truncated(err, ErrBaseTooShort, "it ends before %d", op.To)
 	}
 
-	if uint32(dataRead) != datalen {
-		return fmt.Errorf("Didn't read expected %d bytes, read %d instead", datalen, datalenRead)
-	}
+	return nil
+}
 
-	written, err := out.Write(data)
-	if written != len(data) {
-		return fmt.Errorf("Didnt write expected %d, wrote %d instead", len(data), written)
+func checkChecksum(op *ChecksumOp, digest []byte) error {
+	if !bytes.Equal(op.Digest, digest) {
+		return fmt.Errorf("%w: output is %x, expected %x", ErrChecksumMismatch, digest, op.Digest)
 	}
 
 	return nil
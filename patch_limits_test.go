@@ -0,0 +1,113 @@
+package deltadiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/franela/goblin"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPatchLimits(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("patch limits", func() {
+
+		base := strings.Repeat("0123456789abcdef", 64)
+
+		// allocated returns how many bytes f allocates.
+		allocated := func(f func()) uint64 {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			f()
+			runtime.ReadMemStats(&after)
+
+			return after.TotalAlloc - before.TotalAlloc
+		}
+
+		g.It("should not trust the lengths in crafted deltas", func() {
+			// A write op claiming 4GiB of data, and a read op of
+			// 4GiB, each 10 bytes or less.
+			crafted := [][]byte{
+				{0, 0, 0xff, 0xff, 0xff, 0xff},
+				{0, 1, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff},
+			}
+
+			sentinels := []error{ErrCorruptDelta, ErrBaseTooShort}
+
+			for i, delta := range crafted {
+				var err error
+
+				n := allocated(func() {
+					err = Patch(strings.NewReader(base), bytes.NewReader(delta), bytes.NewBuffer(nil))
+				})
+
+				g.Assert(errors.Is(err, sentinels[i])).Equal(true)
+				g.Assert(n < 1<<20).Equal(true)
+
+				_, err = DecodeDelta(bytes.NewReader(delta))
+				if i == 0 {
+					g.Assert(errors.Is(err, ErrCorruptDelta)).Equal(true)
+				}
+			}
+		})
+
+		g.It("should enforce the limits", func() {
+			delta := bytes.NewBuffer(nil)
+			err := EncodeDelta([]Op{
+				&ReadOp{From: 0, To: 100},
+				&WriteOp{Data: []byte(strings.Repeat("x", 50))},
+				&ReadOp{From: 100, To: 200},
+			}, delta)
+			g.Assert(err).Equal(nil)
+
+			patch := func(c *PatchConfig) (string, error) {
+				out := bytes.NewBuffer(nil)
+				err := PatchWithConfig(context.Background(), strings.NewReader(base), bytes.NewReader(delta.Bytes()), out, c)
+				return out.String(), err
+			}
+
+			out, err := patch(&PatchConfig{MaxOutputSize: 250, MaxOpSize: 100})
+			g.Assert(err).Equal(nil)
+			g.Assert(len(out)).Equal(250)
+
+			out, err = patch(&PatchConfig{MaxOutputSize: 249})
+			g.Assert(errors.Is(err, ErrLimitExceeded)).Equal(true)
+			g.Assert(len(out)).Equal(150)
+
+			var opErr *OpError
+			g.Assert(errors.As(err, &opErr)).Equal(true)
+			g.Assert(opErr.Index).Equal(2)
+
+			_, err = patch(&PatchConfig{MaxOpSize: 99})
+			g.Assert(errors.Is(err, ErrLimitExceeded)).Equal(true)
+			g.Assert(errors.As(err, &opErr)).Equal(true)
+			g.Assert(opErr.Index).Equal(0)
+		})
+
+		g.It("should stream large write ops", func() {
+			data := bytes.Repeat([]byte("y"), 8<<20)
+
+			delta := bytes.NewBuffer(nil)
+			err := EncodeDelta([]Op{&WriteOp{Data: data}}, delta)
+			g.Assert(err).Equal(nil)
+
+			n := allocated(func() {
+				err = Patch(strings.NewReader(base), bytes.NewReader(delta.Bytes()), discard{})
+			})
+
+			g.Assert(err).Equal(nil)
+			g.Assert(n < 1<<20).Equal(true)
+		})
+	})
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -0,0 +1,39 @@
+package deltadiff
+
+// Phases reported in Progress.
+const (
+	PHASE_HASHING  = "hashing"
+	PHASE_READING  = "reading"
+	PHASE_MATCHING = "matching"
+	PHASE_WRITING  = "writing"
+	PHASE_PATCHING = "patching"
+)
+
+// Progress tells how far Signature, Delta or Patch got in
+// their current phase.
+type Progress struct {
+	Phase string
+
+	// Done is how many bytes of the phase were processed:
+	// base bytes when hashing and matching, target bytes when
+	// reading and writing, and output bytes when patching.
+	Done int64
+
+	// Total is how many bytes the phase will process, or -1
+	// when it's not known.
+	Total int64
+}
+
+// ProgressFunc is called synchronously, on every block or op,
+// so it should return quickly.
+type ProgressFunc func(p Progress)
+
+func (f ProgressFunc) report(phase string, done, total int64) {
+	if f != nil {
+		f(Progress{
+			Phase: phase,
+			Done:  done,
+			Total: total,
+		})
+	}
+}
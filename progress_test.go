@@ -0,0 +1,74 @@
+package deltadiff
+
+import (
+	"bytes"
+	"context"
+	"github.com/franela/goblin"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("progress", func() {
+
+		g.It("should report every phase up to its total", func() {
+			base := strings.Repeat("0123456789abcdef", 64)
+			target := "xx" + base[:500] + "yy" + base[500:]
+
+			reports := make(map[string][]Progress)
+			record := func(p Progress) {
+				reports[p.Phase] = append(reports[p.Phase], p)
+			}
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 16,
+				BaseSize:  len(base),
+				Progress:  record,
+			})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, strings.NewReader(target), delta, &DeltaConfig{Progress: record})
+			g.Assert(err).Equal(nil)
+
+			out := bytes.NewBuffer(nil)
+			err = PatchWithConfig(context.Background(), strings.NewReader(base), delta, out, &PatchConfig{Progress: record})
+			g.Assert(err).Equal(nil)
+			g.Assert(out.String()).Equal(target)
+
+			totals := map[string]int64{
+				PHASE_HASHING:  int64(len(base)),
+				PHASE_READING:  -1,
+				PHASE_MATCHING: int64(len(base)),
+				PHASE_WRITING:  int64(len(target)),
+				PHASE_PATCHING: -1,
+			}
+
+			ends := map[string]int64{
+				PHASE_HASHING:  int64(len(base)),
+				PHASE_READING:  int64(len(target)),
+				PHASE_MATCHING: int64(len(base)),
+				PHASE_WRITING:  int64(len(target)),
+				PHASE_PATCHING: int64(len(target)),
+			}
+
+			for phase, total := range totals {
+				g.Assert(len(reports[phase]) > 0).Equal(true)
+
+				prev := int64(0)
+				for _, p := range reports[phase] {
+					g.Assert(p.Total).Equal(total)
+					g.Assert(p.Done >= prev).Equal(true)
+					prev = p.Done
+				}
+
+				g.Assert(prev).Equal(ends[phase])
+			}
+		})
+	})
+}
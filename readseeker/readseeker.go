@@ -1,7 +1,9 @@
 package readseeker
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
 )
 
 type BasicReadSeeker struct {
@@ -16,21 +18,20 @@ func NewBasicReadSeeker(r io.Reader) io.ReadSeeker {
 }
 
 // Whence doesn't work, this is forward seek from current
-// position only.
+// position only. Seeking backwards is an error.
 func (rs *BasicReadSeeker) Seek(offset int64, whence int) (int64, error) {
-	if int64(rs.cursor) >= offset {
-		return rs.cursor, nil
+	if offset < rs.cursor {
+		return rs.cursor, fmt.Errorf("Can't seek back to %d from %d", offset, rs.cursor)
 	}
 
-	todiscard := offset - rs.cursor
-	buffer := make([]byte, todiscard)
-	n, err := rs.reader.Read(buffer)
-
-	// Just in case it returns something < 0
-	if n > 0 {
-		rs.cursor += int64(n)
+	if offset == rs.cursor {
+		return rs.cursor, nil
 	}
 
+	// Seeking past the end stops there with io.EOF.
+	n, err := io.CopyN(ioutil.Discard, rs.reader, offset-rs.cursor)
+	rs.cursor += n
+
 	return rs.cursor, err
 }
 
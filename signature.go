@@ -1,33 +1,96 @@
 package deltadiff
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/xrash/deltadiff/hasher"
 	"io"
+	"math"
+)
+
+const (
+	AUTO_BLOCK_SIZE_MIN = 700
+	AUTO_BLOCK_SIZE_MAX = 1 << 17
 )
 
 type SignatureConfig struct {
-	Hasher    string
+	Hasher string
+
+	// If BlockSize is 0, it's chosen from BaseSize with
+	// AutoBlockSize.
 	BlockSize int
 	BaseSize  int
+
+	// If CDC is true, blocks are cut where the content says so,
+	// with FastCDC, rather than every BlockSize bytes, so an
+	// insertion or removal in base only changes the blocks
+	// around it. BlockSize is then the average size, and must
+	// be a power of 2. Blocks are between MinBlockSize and
+	// MaxBlockSize long, BlockSize/4 and BlockSize*4 if they're
+	// 0. If BlockSize is 0, AutoBlockSize is rounded down to a
+	// power of 2.
+	CDC          bool
+	MinBlockSize int
+	MaxBlockSize int
+
+	// If Progress is not nil, it's called as base is hashed.
+	Progress ProgressFunc
+}
+
+// AutoBlockSize picks a block size for a base of the given
+// size the way rsync does: the square root of the size,
+// rounded down to a multiple of 8, and kept between
+// AUTO_BLOCK_SIZE_MIN and AUTO_BLOCK_SIZE_MAX.
+func AutoBlockSize(baseSize int) int {
+	if baseSize <= AUTO_BLOCK_SIZE_MIN*AUTO_BLOCK_SIZE_MIN {
+		return AUTO_BLOCK_SIZE_MIN
+	}
+
+	blockSize := int(math.Sqrt(float64(baseSize))) &^ 7
+
+	if blockSize > AUTO_BLOCK_SIZE_MAX {
+		return AUTO_BLOCK_SIZE_MAX
+	}
+
+	return blockSize
 }
 
 func Signature(base io.Reader, out io.Writer, c *SignatureConfig) error {
+	return SignatureContext(context.Background(), base, out, c)
+}
+
+// SignatureContext is like Signature, but stops between blocks
+// once ctx is done and returns ctx.Err(). The signature written
+// so far lacks blocks, so reading it fails.
+func SignatureContext(ctx context.Context, base io.Reader, out io.Writer, c *SignatureConfig) error {
 	if c.BaseSize < 0 {
-		return fmt.Errorf("Must provide valid BaseSize in config")
+		return fmt.Errorf("%w: must provide valid BaseSize", ErrInvalidConfig)
+	}
+
+	if c.BlockSize < 0 {
+		return fmt.Errorf("%w: must provide valid BlockSize", ErrInvalidConfig)
 	}
 
 	h, err := hasher.GetHasherByName(c.Hasher)
 	if err != nil {
-		return fmt.Errorf("Didn't find hasher %s", c.Hasher)
+		return err
+	}
+
+	if c.CDC {
+		return cdcSignature(ctx, base, out, c, h)
+	}
+
+	blockSize := c.BlockSize
+	if blockSize == 0 {
+		blockSize = AutoBlockSize(c.BaseSize)
 	}
 
 	if err := writeHasherCode(out, h); err != nil {
 		return fmt.Errorf("Couldn't write hasher code %s", err)
 	}
 
-	if err := writeBlockSize(out, c.BlockSize); err != nil {
+	if err := writeBlockSize(out, blockSize); err != nil {
 		return fmt.Errorf("Couldn't write hasher code %s", err)
 	}
 
@@ -35,20 +98,29 @@ func Signature(base io.Reader, out io.Writer, c *SignatureConfig) error {
 		return fmt.Errorf("Couldn't write hasher code %s", err)
 	}
 
+	done := int64(0)
+
 	for {
-		b := make([]byte, c.BlockSize)
-		_, err := base.Read(b)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+		// Reads are retried until a block is full, whatever the
+		// reader returns at once. The last block is hashed as
+		// is, without padding, and only skipped if it's empty.
+		b := make([]byte, blockSize)
+		read, err := io.ReadFull(base, b)
 
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return err
 		}
 
 		h.Reset()
-		hashed, err := h.Hash(b)
+		hashed, err := h.Hash(b[:read])
 		if err != nil {
 			return err
 		}
@@ -61,11 +133,195 @@ func Signature(base io.Reader, out io.Writer, c *SignatureConfig) error {
 		if written != h.HashSize() {
 			return fmt.Errorf("Wrote %d instead of expected hash size %d", written, h.HashSize())
 		}
+
+		done += int64(read)
+		c.Progress.report(PHASE_HASHING, done, int64(c.BaseSize))
+	}
+
+	return nil
+}
+
+// SignatureFile is the parsed content of a signature.
+type SignatureFile struct {
+	Hasher    string
+	BlockSize int
+	BaseSize  int
+	Blocks    [][]byte
+
+	// CDC is true for signatures made with SignatureConfig.CDC,
+	// whose BlockSize is the average size of their blocks.
+	// Offsets holds where each of their blocks begins in base,
+	// followed by BaseSize.
+	CDC          bool
+	MinBlockSize int
+	MaxBlockSize int
+	Offsets      []int
+}
+
+func ReadSignatureFile(signature io.Reader) (*SignatureFile, error) {
+	s, h, err := readSignatureHeader(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.readBlocks(signature, h); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// readSignatureHeader reads the fields before the blocks.
+func readSignatureHeader(signature io.Reader) (*SignatureFile, hasher.Hasher, error) {
+	hashcode, err := readHashCode(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if string(hashcode) == CDC_SIGNATURE_MAGIC[:2] {
+		return readCDCHeader(signature)
+	}
+
+	blockSize, err := readBlockSize(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseSize, err := readBaseSize(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Base can't be split in blocks of no bytes.
+	if blockSize <= 0 && baseSize > 0 {
+		return nil, nil, fmt.Errorf("%w: invalid block size %d", ErrCorruptSignature, blockSize)
 	}
 
+	h, name, err := lookupHasher(hashcode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &SignatureFile{
+		Hasher:    name,
+		BlockSize: blockSize,
+		BaseSize:  baseSize,
+	}, h, nil
+}
+
+func lookupHasher(hashcode []byte) (hasher.Hasher, string, error) {
+	h, err := hasher.GetHasherByCode(hashcode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	name, err := hasher.GetHasherNameByCode(hashcode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return h, name, nil
+}
+
+// BlockBounds returns the range of base block i was hashed
+// from.
+func (s *SignatureFile) BlockBounds(i int) (int, int) {
+	if s.CDC {
+		return s.Offsets[i], s.Offsets[i+1]
+	}
+
+	from := i * s.BlockSize
+	to := from + s.BlockSize
+
+	if to > s.BaseSize {
+		to = s.BaseSize
+	}
+
+	return from, to
+}
+
+// maxBlockSize returns how long the longest block can be.
+func (s *SignatureFile) maxBlockSize() int {
+	if s.CDC {
+		return s.MaxBlockSize
+	}
+
+	return s.BlockSize
+}
+
+// blockCount returns how many blocks base is made of. For CDC
+// signatures, it's only an estimate until the blocks are read.
+func (s *SignatureFile) blockCount() int {
+	if s.BlockSize <= 0 {
+		return 0
+	}
+
+	return (s.BaseSize + s.BlockSize - 1) / s.BlockSize
+}
+
+func (s *SignatureFile) readBlocks(signature io.Reader, h hasher.Hasher) error {
+	if s.CDC {
+		return s.readCDCBlocks(signature, h)
+	}
+
+	blocks, err := readBlocks(signature, h)
+	if err != nil {
+		return err
+	}
+
+	// A signature that was cut short, for instance because
+	// making it was canceled, has fewer blocks than base, and
+	// one with more would give blocks past the end of base.
+	if len(blocks) != s.blockCount() {
+		return fmt.Errorf("%w: it has %d blocks instead of %d", ErrCorruptSignature, len(blocks), s.blockCount())
+	}
+
+	s.Blocks = blocks
+
 	return nil
 }
 
+// WriteTo writes s in the signature format, so it can be
+// given to Delta.
+func (s *SignatureFile) WriteTo(out io.Writer) (int64, error) {
+	h, err := hasher.GetHasherByName(s.Hasher)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.CDC {
+		return s.writeCDC(out, h)
+	}
+
+	if err := writeHasherCode(out, h); err != nil {
+		return 0, err
+	}
+
+	if err := writeBlockSize(out, s.BlockSize); err != nil {
+		return 2, err
+	}
+
+	if err := writeBaseSize(out, s.BaseSize); err != nil {
+		return 6, err
+	}
+
+	total := int64(10)
+
+	for i, block := range s.Blocks {
+		if len(block) != h.HashSize() {
+			return total, fmt.Errorf("Block %d has %d bytes instead of hash size %d", i, len(block), h.HashSize())
+		}
+
+		written, err := out.Write(block)
+		total += int64(written)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
 func writeHasherCode(out io.Writer, h hasher.Hasher) error {
 	written, err := out.Write(h.Code())
 	if err != nil {
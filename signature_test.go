@@ -0,0 +1,84 @@
+package deltadiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/franela/goblin"
+	"strings"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("signature", func() {
+
+		g.It("should pick block sizes like rsync", func() {
+			g.Assert(AutoBlockSize(0)).Equal(AUTO_BLOCK_SIZE_MIN)
+			g.Assert(AutoBlockSize(1000)).Equal(AUTO_BLOCK_SIZE_MIN)
+			g.Assert(AutoBlockSize(700 * 700)).Equal(AUTO_BLOCK_SIZE_MIN)
+			g.Assert(AutoBlockSize(1000 * 1000)).Equal(1000)
+			g.Assert(AutoBlockSize(1001 * 1001)).Equal(1000)
+			g.Assert(AutoBlockSize(1 << 40)).Equal(AUTO_BLOCK_SIZE_MAX)
+		})
+
+		g.It("should record the automatic block size in the header", func() {
+			base := strings.Repeat("abcdefghij", 100)
+			target := "0123" + base[:500] + "4567" + base[500:]
+
+			sc := &SignatureConfig{
+				Hasher:    "polyroll",
+				BlockSize: 0,
+				BaseSize:  len(base),
+			}
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewBufferString(base), signature, sc)
+			g.Assert(err).Equal(nil)
+
+			sig, err := ReadSignatureFile(bytes.NewBuffer(signature.Bytes()))
+			g.Assert(err).Equal(nil)
+			g.Assert(sig.BlockSize).Equal(AUTO_BLOCK_SIZE_MIN)
+			g.Assert(len(sig.Blocks)).Equal(2)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, bytes.NewBufferString(target), delta, &DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			out := bytes.NewBuffer(nil)
+			err = Patch(bytes.NewBufferString(base), delta, out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.String()).Equal(target)
+		})
+
+		g.It("should refuse negative block sizes", func() {
+			sc := &SignatureConfig{
+				Hasher:    "polyroll",
+				BlockSize: -1,
+				BaseSize:  4,
+			}
+
+			err := Signature(bytes.NewBufferString("aaaa"), bytes.NewBuffer(nil), sc)
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("should refuse signatures without a block size", func() {
+			signature := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 16, 1, 2, 3, 4}
+
+			_, err := ReadSignatureFile(bytes.NewReader(signature))
+			g.Assert(errors.Is(err, ErrCorruptSignature)).IsTrue()
+
+			sig := &SignatureFile{
+				Hasher:    "polyroll",
+				BlockSize: 0,
+				BaseSize:  16,
+				Blocks:    [][]byte{{1, 2, 3, 4}},
+			}
+
+			_, err = MatchBlocks(context.Background(), sig, strings.NewReader("some data to match"), &MatchConfig{})
+			g.Assert(errors.Is(err, ErrCorruptSignature)).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package deltadiff
+
+import (
+	"time"
+)
+
+// DeltaStats describes how effective a delta is. Set
+// DeltaConfig.Stats to have Delta fill one in.
+type DeltaStats struct {
+	TargetSize int `json:"target_size"`
+
+	// DeltaSize is what was written to the result of Delta,
+	// including what encryption and signing add.
+	DeltaSize int64 `json:"delta_size"`
+
+	// BaseBytes are the bytes copied from base by read ops,
+	// LiteralBytes are the bytes carried in the delta by
+	// write ops.
+	BaseBytes    int `json:"base_bytes"`
+	LiteralBytes int `json:"literal_bytes"`
+
+	ReadOps  int `json:"read_ops"`
+	WriteOps int `json:"write_ops"`
+
+	MatchedBlocks int `json:"matched_blocks"`
+	TotalBlocks   int `json:"total_blocks"`
+
+	// CompressionRatio is DeltaSize / TargetSize, so the
+	// lower the better. It's 0 when target is empty.
+	CompressionRatio float64 `json:"compression_ratio"`
+
+	Duration time.Duration `json:"duration_ns"`
+}
+
+func (s *DeltaStats) collect(matches []*match, operations []*operation, targetSize int, blocks int) {
+	s.TargetSize = targetSize
+	s.MatchedBlocks = len(matches)
+	s.TotalBlocks = blocks
+
+	for _, o := range operations {
+		switch o.kind {
+		case "read":
+			s.ReadOps++
+			s.BaseBytes += o.to - o.from
+		case "write":
+			s.WriteOps++
+			s.LiteralBytes += o.to - o.from
+		}
+	}
+}
+
+func (s *DeltaStats) finish(deltaSize int64, start time.Time) {
+	s.SetDeltaSize(deltaSize)
+	s.Duration = time.Since(start)
+}
+
+// SetDeltaSize sets DeltaSize, and CompressionRatio with it, for
+// callers that write the delta through something that changes
+// its size, such as encryption.
+func (s *DeltaStats) SetDeltaSize(deltaSize int64) {
+	s.DeltaSize = deltaSize
+	s.CompressionRatio = 0
+
+	if s.TargetSize > 0 {
+		s.CompressionRatio = float64(s.DeltaSize) / float64(s.TargetSize)
+	}
+}
+
+// Add sums o into s, for callers that build one delta out of
+// several, such as tree deltas.
+func (s *DeltaStats) Add(o *DeltaStats) {
+	s.TargetSize += o.TargetSize
+	s.DeltaSize += o.DeltaSize
+	s.BaseBytes += o.BaseBytes
+	s.LiteralBytes += o.LiteralBytes
+	s.ReadOps += o.ReadOps
+	s.WriteOps += o.WriteOps
+	s.MatchedBlocks += o.MatchedBlocks
+	s.TotalBlocks += o.TotalBlocks
+	s.Duration += o.Duration
+	s.CompressionRatio = 0
+
+	if s.TargetSize > 0 {
+		s.CompressionRatio = float64(s.DeltaSize) / float64(s.TargetSize)
+	}
+}
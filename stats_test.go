@@ -0,0 +1,50 @@
+package deltadiff
+
+import (
+	"bytes"
+	"github.com/franela/goblin"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("delta stats", func() {
+
+		g.It("should describe the README example", func() {
+			base := "aaaabbbbccccddeeeeee"
+			target := "aaaabbbbccccddddeeee"
+
+			sc := &SignatureConfig{
+				Hasher:    "polyroll",
+				BlockSize: 4,
+				BaseSize:  len(base),
+			}
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewBufferString(base), signature, sc)
+			g.Assert(err).Equal(nil)
+
+			dc := &DeltaConfig{
+				Stats: &DeltaStats{},
+			}
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, bytes.NewBufferString(target), delta, dc)
+			g.Assert(err).Equal(nil)
+
+			stats := dc.Stats
+			g.Assert(stats.TargetSize).Equal(20)
+			g.Assert(stats.DeltaSize).Equal(int64(delta.Len()))
+			g.Assert(stats.BaseBytes).Equal(16)
+			g.Assert(stats.LiteralBytes).Equal(4)
+			g.Assert(stats.ReadOps).Equal(2)
+			g.Assert(stats.WriteOps).Equal(2)
+			g.Assert(stats.MatchedBlocks).Equal(4)
+			g.Assert(stats.TotalBlocks).Equal(5)
+			g.Assert(stats.CompressionRatio).Equal(float64(delta.Len()) / 20)
+			g.Assert(stats.Duration > 0).Equal(true)
+		})
+	})
+}
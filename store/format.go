@@ -0,0 +1,92 @@
+package store
+
+import (
+	"fmt"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+	"time"
+)
+
+// The index of a store begins with a magic string, like the
+// other formats that aren't a plain signature or delta.
+const INDEX_MAGIC = "DDSTOR01"
+
+const (
+	// The version is stored whole.
+	KIND_SNAPSHOT uint8 = 0
+
+	// The version is stored as a delta to be applied to the
+	// version at Base.
+	KIND_DELTA uint8 = 1
+)
+
+type index struct {
+	maxChain  int
+	hasher    string
+	blockSize int
+	versions  []*Version
+}
+
+func (ix *index) WriteTo(out io.Writer) (int64, error) {
+	w := binfmt.NewWriter(out)
+	w.Magic(INDEX_MAGIC)
+	w.Uint32(uint32(ix.maxChain))
+	w.String(ix.hasher)
+	w.Uint32(uint32(ix.blockSize))
+	w.Uint32(uint32(len(ix.versions)))
+
+	for _, v := range ix.versions {
+		w.Uint8(v.Kind)
+		w.Uint32(uint32(v.Base))
+		w.Uint64(uint64(v.Size))
+		w.Uint64(uint64(v.StoredSize))
+		w.Bytes(v.Digest)
+		w.Uint64(uint64(v.Time.UnixNano()))
+		w.String(v.Message)
+	}
+
+	return w.Flush()
+}
+
+func readIndex(in io.Reader) (*index, error) {
+	r := binfmt.NewReader(in)
+	r.Magic(INDEX_MAGIC)
+
+	ix := &index{
+		maxChain:  int(r.Uint32()),
+		hasher:    r.String(),
+		blockSize: int(r.Uint32()),
+		versions:  make([]*Version, 0),
+	}
+
+	count := r.Uint32()
+
+	for i := uint32(0); i < count && r.Err == nil; i++ {
+		v := &Version{
+			Number:     int(i) + 1,
+			Kind:       r.Uint8(),
+			Base:       int(r.Uint32()),
+			Size:       int64(r.Uint64()),
+			StoredSize: int64(r.Uint64()),
+			Digest:     r.Bytes(),
+			Time:       time.Unix(0, int64(r.Uint64())),
+			Message:    r.String(),
+		}
+
+		ix.versions = append(ix.versions, v)
+	}
+
+	if r.Err != nil {
+		return nil, fmt.Errorf("Error reading store index: %v", r.Err)
+	}
+
+	// Deltas can only be applied to earlier versions, which
+	// keeps chains from looping.
+	for _, v := range ix.versions {
+		if v.Kind == KIND_DELTA && (v.Base < 1 || v.Base >= v.Number) {
+			return nil, fmt.Errorf("Error reading store index: version %d is a delta of version %d", v.Number, v.Base)
+		}
+	}
+
+	return ix, nil
+}
@@ -0,0 +1,523 @@
+// Package store keeps the history of a file as a chain of
+// deltas: each version is stored as a delta of the one before
+// it, except for periodic full snapshots, so any version can be
+// rebuilt by patching its snapshot with at most MaxChain
+// deltas. Every version is checked against its SHA-256 when
+// it's rebuilt.
+//
+// A store is a directory holding an index and one file per
+// version. Only one process should change it at a time.
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"github.com/xrash/deltadiff/hasher"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Unless Config says otherwise, a snapshot is taken at least
+// every DEFAULT_MAX_CHAIN versions.
+const DEFAULT_MAX_CHAIN = 16
+
+const INDEX_FILENAME = "index"
+
+// ErrNotFound means there's no such version in the store.
+var ErrNotFound = errors.New("Version not found")
+
+type Config struct {
+	// MaxChain is how many deltas may be chained after a
+	// snapshot, DEFAULT_MAX_CHAIN if it's 0, the same as in
+	// Compact.
+	MaxChain int
+
+	// Hasher and BlockSize are passed to Signature when
+	// versions are diffed, see SignatureConfig.
+	Hasher    string
+	BlockSize int
+}
+
+// Version is one version of the file kept in a store, numbered
+// from 1.
+type Version struct {
+	Number int
+	Kind   uint8
+
+	// Base is the version the delta of a KIND_DELTA version is
+	// applied to.
+	Base int
+
+	// Size is the size of the version and StoredSize that of
+	// its snapshot or delta.
+	Size       int64
+	StoredSize int64
+
+	// Digest is the SHA-256 of the version.
+	Digest []byte
+
+	Time    time.Time
+	Message string
+}
+
+type Store struct {
+	// If Progress is not nil, it's called as versions are read,
+	// diffed, patched and written.
+	Progress deltadiff.ProgressFunc
+
+	dir   string
+	index *index
+}
+
+// Init creates a store in dir, which may exist but must not
+// be a store already.
+func Init(dir string, c *Config) (*Store, error) {
+	if c.MaxChain < 0 {
+		return nil, fmt.Errorf("%w: MaxChain can't be negative", deltadiff.ErrInvalidConfig)
+	}
+
+	if _, err := hasher.GetHasherByName(c.Hasher); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, INDEX_FILENAME)); err == nil {
+		return nil, fmt.Errorf("%s is a store already", dir)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	maxChain := c.MaxChain
+	if maxChain == 0 {
+		maxChain = DEFAULT_MAX_CHAIN
+	}
+
+	s := &Store{
+		dir: dir,
+		index: &index{
+			maxChain:  maxChain,
+			hasher:    c.Hasher,
+			blockSize: c.BlockSize,
+			versions:  make([]*Version, 0),
+		},
+	}
+
+	if err := s.writeIndex(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Open opens the store in dir.
+func Open(dir string) (*Store, error) {
+	file, err := os.Open(filepath.Join(dir, INDEX_FILENAME))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ix, err := readIndex(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir:   dir,
+		index: ix,
+	}, nil
+}
+
+// Versions returns the versions in the store, oldest first.
+func (s *Store) Versions() []*Version {
+	return s.index.versions
+}
+
+// MaxChain returns how many deltas may be chained after a
+// snapshot.
+func (s *Store) MaxChain() int {
+	return s.index.maxChain
+}
+
+func (s *Store) version(number int) (*Version, error) {
+	if number < 1 || number > len(s.index.versions) {
+		return nil, fmt.Errorf("%w: %d", ErrNotFound, number)
+	}
+
+	return s.index.versions[number-1], nil
+}
+
+// Add stores content as a new version, as a delta of the latest
+// one unless it's time for a snapshot, or the delta would be
+// no smaller than content.
+func (s *Store) Add(content io.Reader, message string) (*Version, error) {
+	target, err := s.tempFile()
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(target.Name())
+	defer target.Close()
+
+	digest := sha256.New()
+
+	w := io.MultiWriter(target, digest)
+	if s.Progress != nil {
+		w = &progressWriter{w: w, phase: deltadiff.PHASE_READING, total: -1, progress: s.Progress}
+	}
+
+	size, err := io.Copy(w, content)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Version{
+		Number:     len(s.index.versions) + 1,
+		Kind:       KIND_SNAPSHOT,
+		Size:       size,
+		StoredSize: size,
+		Digest:     digest.Sum(nil),
+		Time:       time.Now(),
+		Message:    message,
+	}
+
+	stored := target
+
+	if latest := len(s.index.versions); latest > 0 && s.chain(latest)+1 <= s.index.maxChain {
+		delta, err := s.diff(latest, target)
+		if err != nil {
+			return nil, err
+		}
+
+		defer os.Remove(delta.Name())
+		defer delta.Close()
+
+		info, err := delta.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Size() < size {
+			v.Kind = KIND_DELTA
+			v.Base = latest
+			v.StoredSize = info.Size()
+			stored = delta
+		}
+	}
+
+	if err := s.store(v, stored); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// diff writes the delta from version base to target into a
+// temporary file.
+func (s *Store) diff(base int, target *os.File) (*os.File, error) {
+	signature := bytes.NewBuffer(nil)
+
+	err := s.rebuild(base, func(r io.Reader, size int64) error {
+		return deltadiff.Signature(r, signature, &deltadiff.SignatureConfig{
+			Hasher:    s.index.hasher,
+			BlockSize: s.index.blockSize,
+			BaseSize:  int(size),
+			Progress:  s.Progress,
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := target.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	delta, err := s.tempFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := deltadiff.Delta(signature, target, delta, &deltadiff.DeltaConfig{Checksum: true, Progress: s.Progress}); err != nil {
+		delta.Close()
+		os.Remove(delta.Name())
+		return nil, err
+	}
+
+	return delta, nil
+}
+
+// store moves file into place as the data of v and adds v to
+// the index.
+func (s *Store) store(v *Version, file *os.File) error {
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), s.filename(v)); err != nil {
+		return err
+	}
+
+	s.index.versions = append(s.index.versions, v)
+
+	if err := s.writeIndex(); err != nil {
+		s.index.versions = s.index.versions[:len(s.index.versions)-1]
+		return err
+	}
+
+	return nil
+}
+
+// Get writes version number to out, failing with
+// ErrChecksumMismatch if it's not what was stored.
+func (s *Store) Get(number int, out io.Writer) error {
+	return s.rebuild(number, func(r io.Reader, size int64) error {
+		if s.Progress != nil {
+			out = &progressWriter{w: out, phase: deltadiff.PHASE_WRITING, total: size, progress: s.Progress}
+		}
+
+		_, err := io.Copy(out, r)
+		return err
+	})
+}
+
+// chain returns how many deltas must be applied to rebuild
+// version number.
+func (s *Store) chain(number int) int {
+	n := 0
+
+	for v := s.index.versions[number-1]; v.Kind == KIND_DELTA; v = s.index.versions[v.Base-1] {
+		n++
+	}
+
+	return n
+}
+
+// rebuild calls f with version number, patching its snapshot
+// with the deltas leading to it in temporary files. f must read
+// all of it, so its checksum can be checked.
+func (s *Store) rebuild(number int, f func(r io.Reader, size int64) error) error {
+	v, err := s.version(number)
+	if err != nil {
+		return err
+	}
+
+	chain := []*Version{v}
+	for chain[0].Kind == KIND_DELTA {
+		chain = append([]*Version{s.index.versions[chain[0].Base-1]}, chain...)
+	}
+
+	current, err := os.Open(s.filename(chain[0]))
+	if err != nil {
+		return err
+	}
+
+	// Only the latest of the temporary files is kept around.
+	temporary := false
+	release := func() {
+		current.Close()
+		if temporary {
+			os.Remove(current.Name())
+		}
+	}
+
+	defer release()
+
+	for _, next := range chain[1:] {
+		patched, err := s.patch(current, next)
+		if err != nil {
+			return fmt.Errorf("Error rebuilding version %d: %w", next.Number, err)
+		}
+
+		release()
+		current, temporary = patched, true
+	}
+
+	digest := sha256.New()
+
+	if err := f(io.TeeReader(current, digest), v.Size); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(digest.Sum(nil), v.Digest) {
+		return fmt.Errorf("%w: version %d is %x, expected %x", deltadiff.ErrChecksumMismatch, v.Number, digest.Sum(nil), v.Digest)
+	}
+
+	return nil
+}
+
+// patch applies the delta of v to base into a temporary file,
+// rewound so it can be read.
+func (s *Store) patch(base *os.File, v *Version) (*os.File, error) {
+	delta, err := os.Open(s.filename(v))
+	if err != nil {
+		return nil, err
+	}
+	defer delta.Close()
+
+	out, err := s.tempFile()
+	if err != nil {
+		return nil, err
+	}
+
+	err = deltadiff.PatchWithConfig(context.Background(), base, delta, out, &deltadiff.PatchConfig{Progress: s.Progress})
+	if err == nil {
+		_, err = out.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Compact turns versions into snapshots where needed so that
+// no chain of deltas is longer than maxChain, which becomes the
+// MaxChain of the store, and returns how many were turned. As
+// in Config, a maxChain of 0 means DEFAULT_MAX_CHAIN.
+func (s *Store) Compact(maxChain int) (int, error) {
+	if maxChain < 0 {
+		return 0, fmt.Errorf("%w: MaxChain can't be negative", deltadiff.ErrInvalidConfig)
+	}
+
+	if maxChain == 0 {
+		maxChain = DEFAULT_MAX_CHAIN
+	}
+
+	compacted := 0
+
+	for _, v := range s.index.versions {
+		if v.Kind != KIND_DELTA || s.chain(v.Number) <= maxChain {
+			continue
+		}
+
+		if err := s.snapshot(v); err != nil {
+			return compacted, err
+		}
+
+		compacted++
+	}
+
+	s.index.maxChain = maxChain
+
+	return compacted, s.writeIndex()
+}
+
+// snapshot stores v whole in place of its delta.
+func (s *Store) snapshot(v *Version) error {
+	file, err := s.tempFile()
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := s.Get(v.Number, file); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	old := s.filename(v)
+	snapshot := *v
+	snapshot.Kind = KIND_SNAPSHOT
+	snapshot.Base = 0
+	snapshot.StoredSize = snapshot.Size
+
+	if err := os.Rename(file.Name(), s.filename(&snapshot)); err != nil {
+		return err
+	}
+
+	*v = snapshot
+
+	if err := s.writeIndex(); err != nil {
+		return err
+	}
+
+	return os.Remove(old)
+}
+
+// Verify rebuilds every version and checks it against its
+// checksum, returning the first that fails.
+func (s *Store) Verify() error {
+	for _, v := range s.index.versions {
+		err := s.Get(v.Number, ioutil.Discard)
+		if err != nil {
+			return fmt.Errorf("Version %d is corrupt: %w", v.Number, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) filename(v *Version) string {
+	extension := "snapshot"
+	if v.Kind == KIND_DELTA {
+		extension = "delta"
+	}
+
+	return filepath.Join(s.dir, fmt.Sprintf("%08d.%s", v.Number, extension))
+}
+
+func (s *Store) tempFile() (*os.File, error) {
+	return ioutil.TempFile(s.dir, ".tmp-")
+}
+
+// writeIndex replaces the index, so a crash leaves either the
+// old or the new one.
+func (s *Store) writeIndex() error {
+	file, err := s.tempFile()
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := s.index.WriteTo(file); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filepath.Join(s.dir, INDEX_FILENAME))
+}
+
+// progressWriter reports what's written through it to progress.
+type progressWriter struct {
+	w        io.Writer
+	phase    string
+	done     int64
+	total    int64
+	progress deltadiff.ProgressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.done += int64(n)
+
+	w.progress(deltadiff.Progress{
+		Phase: w.phase,
+		Done:  w.done,
+		Total: w.total,
+	})
+
+	return n, err
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("store", func() {
+
+		random := rand.New(rand.NewSource(46))
+
+		// Each version changes a few bytes of the one before.
+		versions := make([][]byte, 10)
+		versions[0] = make([]byte, 50000)
+		random.Read(versions[0])
+
+		for i := 1; i < len(versions); i++ {
+			versions[i] = append([]byte(nil), versions[i-1]...)
+			random.Read(versions[i][random.Intn(49000):][:100])
+		}
+
+		c := &Config{
+			MaxChain:  3,
+			Hasher:    "polyroll",
+			BlockSize: 1024,
+		}
+
+		add := func(s *Store) {
+			for i, content := range versions {
+				v, err := s.Add(bytes.NewReader(content), "message")
+				g.Assert(err).Equal(nil)
+				g.Assert(v.Number).Equal(i + 1)
+			}
+		}
+
+		g.It("should give back every version", func() {
+			dir := t.TempDir()
+
+			s, err := Init(dir, c)
+			g.Assert(err).Equal(nil)
+
+			add(s)
+
+			s, err = Open(dir)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(s.Versions())).Equal(len(versions))
+
+			for i, content := range versions {
+				out := bytes.NewBuffer(nil)
+				g.Assert(s.Get(i+1, out)).Equal(nil)
+				g.Assert(out.Bytes()).Equal(content)
+			}
+		})
+
+		g.It("should take a snapshot when chains get long", func() {
+			s, err := Init(t.TempDir(), c)
+			g.Assert(err).Equal(nil)
+
+			add(s)
+
+			kinds := make([]uint8, 0)
+			for _, v := range s.Versions() {
+				kinds = append(kinds, v.Kind)
+			}
+
+			g.Assert(kinds).Equal([]uint8{
+				KIND_SNAPSHOT, KIND_DELTA, KIND_DELTA, KIND_DELTA,
+				KIND_SNAPSHOT, KIND_DELTA, KIND_DELTA, KIND_DELTA,
+				KIND_SNAPSHOT, KIND_DELTA,
+			})
+
+			g.Assert(s.Versions()[1].StoredSize < 2048).IsTrue()
+		})
+
+		g.It("should store versions that don't diff well whole", func() {
+			s, err := Init(t.TempDir(), c)
+			g.Assert(err).Equal(nil)
+
+			_, err = s.Add(bytes.NewReader(versions[0]), "")
+			g.Assert(err).Equal(nil)
+
+			other := make([]byte, 1000)
+			random.Read(other)
+
+			v, err := s.Add(bytes.NewReader(other), "")
+			g.Assert(err).Equal(nil)
+			g.Assert(v.Kind).Equal(KIND_SNAPSHOT)
+		})
+
+		g.It("should compact long chains", func() {
+			dir := t.TempDir()
+
+			s, err := Init(dir, &Config{MaxChain: 100, Hasher: "polyroll", BlockSize: 1024})
+			g.Assert(err).Equal(nil)
+
+			add(s)
+
+			compacted, err := s.Compact(3)
+			g.Assert(err).Equal(nil)
+			g.Assert(compacted).Equal(2)
+			g.Assert(s.MaxChain()).Equal(3)
+
+			for _, v := range s.Versions() {
+				g.Assert(s.chain(v.Number) <= 3).IsTrue()
+			}
+
+			g.Assert(s.Verify()).Equal(nil)
+
+			files, err := filepath.Glob(filepath.Join(dir, "*.*"))
+			g.Assert(err).Equal(nil)
+			g.Assert(len(files)).Equal(len(versions))
+		})
+
+		g.It("should take a MaxChain of 0 as the default", func() {
+			s, err := Init(t.TempDir(), &Config{MaxChain: 0, Hasher: "polyroll", BlockSize: 1024})
+			g.Assert(err).Equal(nil)
+			g.Assert(s.MaxChain()).Equal(DEFAULT_MAX_CHAIN)
+
+			add(s)
+
+			_, err = s.Compact(2)
+			g.Assert(err).Equal(nil)
+			g.Assert(s.MaxChain()).Equal(2)
+
+			compacted, err := s.Compact(0)
+			g.Assert(err).Equal(nil)
+			g.Assert(compacted).Equal(0)
+			g.Assert(s.MaxChain()).Equal(DEFAULT_MAX_CHAIN)
+		})
+
+		g.It("should notice corrupt versions", func() {
+			dir := t.TempDir()
+
+			s, err := Init(dir, c)
+			g.Assert(err).Equal(nil)
+
+			add(s)
+
+			snapshot := filepath.Join(dir, "00000001.snapshot")
+			content, err := ioutil.ReadFile(snapshot)
+			g.Assert(err).Equal(nil)
+
+			content[100] ^= 1
+			g.Assert(ioutil.WriteFile(snapshot, content, 0644)).Equal(nil)
+
+			err = s.Get(1, ioutil.Discard)
+			g.Assert(errors.Is(err, deltadiff.ErrChecksumMismatch)).IsTrue()
+
+			// Deltas carry checksums of their own, which catch
+			// it before the version's.
+			err = s.Get(2, ioutil.Discard)
+			g.Assert(errors.Is(err, deltadiff.ErrChecksumMismatch)).IsTrue()
+
+			err = s.Verify()
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("should report progress on add and get", func() {
+			s, err := Init(t.TempDir(), c)
+			g.Assert(err).Equal(nil)
+
+			phases := make(map[string]deltadiff.Progress)
+			s.Progress = func(p deltadiff.Progress) {
+				phases[p.Phase] = p
+			}
+
+			add(s)
+			g.Assert(phases[deltadiff.PHASE_READING].Done > 0).IsTrue()
+			g.Assert(phases[deltadiff.PHASE_MATCHING].Done > 0).IsTrue()
+
+			phases = make(map[string]deltadiff.Progress)
+			g.Assert(s.Get(len(versions), ioutil.Discard)).Equal(nil)
+
+			written := phases[deltadiff.PHASE_WRITING]
+			g.Assert(written.Done).Equal(int64(len(versions[len(versions)-1])))
+			g.Assert(written.Total).Equal(written.Done)
+			g.Assert(phases[deltadiff.PHASE_PATCHING].Done > 0).IsTrue()
+		})
+
+		g.It("should report versions that don't exist", func() {
+			s, err := Init(t.TempDir(), c)
+			g.Assert(err).Equal(nil)
+
+			err = s.Get(1, ioutil.Discard)
+			g.Assert(errors.Is(err, ErrNotFound)).IsTrue()
+		})
+
+		g.It("should not init a store twice", func() {
+			dir := t.TempDir()
+
+			_, err := Init(dir, c)
+			g.Assert(err).Equal(nil)
+
+			_, err = Init(dir, c)
+			g.Assert(err != nil).IsTrue()
+
+			_, err = os.Stat(filepath.Join(dir, INDEX_FILENAME))
+			g.Assert(err).Equal(nil)
+		})
+	})
+}
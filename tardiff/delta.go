@@ -0,0 +1,226 @@
+package tardiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Delta reads the tar archive in target and writes a regular
+// delta that turns base into target, byte for byte. Members
+// are matched by name, so they can move around the archive
+// freely: the content of each target member is diffed with the
+// regular engine against the base member of the same name only,
+// and its headers are read from base when they're identical.
+//
+// Since members are read from base out of order, the delta
+// must be applied with a base that's an io.ReadSeeker.
+func Delta(signature, target io.Reader, out io.Writer, c *deltadiff.DeltaConfig) error {
+	start := time.Now()
+
+	s, err := ReadSignature(signature)
+	if err != nil {
+		return err
+	}
+
+	members := make(map[string]*Member)
+	for _, m := range s.Members {
+		members[m.Name] = m
+	}
+
+	content, err := ioutil.ReadAll(target)
+	if err != nil {
+		return err
+	}
+
+	l, err := scan(bytes.NewReader(content), func(reg *region, header []byte, data io.Reader) error {
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("Error reading target archive: %v", err)
+	}
+
+	stats := &deltadiff.DeltaStats{}
+	ops := newOpList(s)
+	prevEnd := int64(0)
+
+	for _, reg := range l.regions {
+		ops.padding(content[prevEnd:reg.headerOffset])
+
+		m, ok := members[reg.hdr.Name]
+
+		header := content[reg.headerOffset:reg.dataOffset]
+		digest := sha256.Sum256(header)
+
+		if ok && m.DataOffset-m.HeaderOffset == int64(len(header)) && bytes.Equal(m.HeaderDigest, digest[:]) {
+			ops.read(m.HeaderOffset, m.DataOffset)
+		} else {
+			ops.write(header)
+		}
+
+		data := content[reg.dataOffset:reg.dataEnd]
+
+		if ok && reg.diffable && m.Signature != nil {
+			if err := deltaMember(m, data, ops, stats, c); err != nil {
+				return err
+			}
+		} else {
+			ops.write(data)
+		}
+
+		prevEnd = reg.dataEnd
+	}
+
+	ops.padding(content[prevEnd:])
+
+	encoder := deltadiff.NewDeltaEncoder(out)
+
+	for _, op := range ops.ops {
+		if err := encoder.Encode(op); err != nil {
+			return fmt.Errorf("Error writing delta: %v", err)
+		}
+	}
+
+	if c.Checksum {
+		digest := sha256.Sum256(content)
+		if err := encoder.Encode(&deltadiff.ChecksumOp{Digest: digest[:]}); err != nil {
+			return fmt.Errorf("Error writing delta: %v", err)
+		}
+	}
+
+	if c.Stats != nil {
+		stats.TargetSize = len(content)
+		stats.DeltaSize = encoder.Offset()
+		stats.Duration = time.Since(start)
+
+		for _, op := range ops.ops {
+			switch op := op.(type) {
+			case *deltadiff.ReadOp:
+				stats.ReadOps++
+				stats.BaseBytes += op.Len()
+			case *deltadiff.WriteOp:
+				stats.WriteOps++
+				stats.LiteralBytes += op.Len()
+			}
+		}
+
+		c.Stats.Add(stats)
+	}
+
+	return nil
+}
+
+// deltaMember diffs the content of a target member with the
+// regular engine and moves the resulting reads to where the
+// base member's content is in the base archive.
+func deltaMember(m *Member, data []byte, ops *opList, stats *deltadiff.DeltaStats, c *deltadiff.DeltaConfig) error {
+	mc := &deltadiff.DeltaConfig{
+		Debug:       c.Debug,
+		DebugWriter: c.DebugWriter,
+		Progress:    c.Progress,
+		Stats:       &deltadiff.DeltaStats{},
+		MemoryLimit: c.MemoryLimit,
+		TempDir:     c.TempDir,
+	}
+
+	delta := bytes.NewBuffer(nil)
+	if err := deltadiff.Delta(bytes.NewReader(m.Signature), bytes.NewReader(data), delta, mc); err != nil {
+		return fmt.Errorf("Error calculating delta of %s: %w", m.Name, err)
+	}
+
+	stats.MatchedBlocks += mc.Stats.MatchedBlocks
+	stats.TotalBlocks += mc.Stats.TotalBlocks
+
+	memberOps, err := deltadiff.DecodeDelta(delta)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range memberOps {
+		switch op := op.(type) {
+		case *deltadiff.ReadOp:
+			ops.read(m.DataOffset+int64(op.From), m.DataOffset+int64(op.To))
+		case *deltadiff.WriteOp:
+			ops.write(op.Data)
+		}
+	}
+
+	return nil
+}
+
+// opList merges contiguous reads and consecutive writes as
+// they're appended.
+type opList struct {
+	ops []deltadiff.Op
+	s   *TarSignature
+}
+
+func newOpList(s *TarSignature) *opList {
+	return &opList{
+		ops: make([]deltadiff.Op, 0),
+		s:   s,
+	}
+}
+
+// padding is like write, except that runs of zeros are read
+// from the zeros at the end of base when possible.
+func (l *opList) padding(data []byte) {
+	if !isZeros(data) || l.s.ZeroSize == 0 {
+		l.write(data)
+		return
+	}
+
+	for remaining := int64(len(data)); remaining > 0; {
+		n := remaining
+		if n > l.s.ZeroSize {
+			n = l.s.ZeroSize
+		}
+
+		l.read(l.s.ZeroOffset, l.s.ZeroOffset+n)
+		remaining -= n
+	}
+}
+
+func (l *opList) last() deltadiff.Op {
+	if len(l.ops) == 0 {
+		return nil
+	}
+
+	return l.ops[len(l.ops)-1]
+}
+
+func (l *opList) read(from, to int64) {
+	if from == to {
+		return
+	}
+
+	if prev, ok := l.last().(*deltadiff.ReadOp); ok && int64(prev.To) == from {
+		prev.To = int(to)
+		return
+	}
+
+	l.ops = append(l.ops, &deltadiff.ReadOp{
+		From: int(from),
+		To:   int(to),
+	})
+}
+
+func (l *opList) write(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	if prev, ok := l.last().(*deltadiff.WriteOp); ok {
+		prev.Data = append(prev.Data, data...)
+		return
+	}
+
+	l.ops = append(l.ops, &deltadiff.WriteOp{
+		Data: append([]byte(nil), data...),
+	})
+}
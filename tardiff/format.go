@@ -0,0 +1,111 @@
+package tardiff
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+)
+
+// Tar signatures begin with a magic string, so they can't be
+// mistaken for regular signatures, which begin with a hasher
+// code. Tar deltas are regular deltas and have no magic.
+const SIGNATURE_MAGIC = "DDTARS01"
+
+// Member describes one member of the base archive. The bytes
+// from HeaderOffset to DataOffset are the member's headers,
+// including any PAX or GNU long name records, and the Size
+// bytes from DataOffset are its content.
+type Member struct {
+	Name         string
+	HeaderOffset int64
+	DataOffset   int64
+	Size         int64
+	HeaderDigest []byte
+
+	// Signature is the regular signature of the member's
+	// content. It's only set for regular files, everything
+	// else is sent as is when it changes.
+	Signature []byte
+}
+
+type TarSignature struct {
+	BaseSize int64
+	Members  []*Member
+
+	// ZeroSize bytes from ZeroOffset in base are all zeros,
+	// which is where the padding and end of archive marker
+	// of target are read from.
+	ZeroOffset int64
+	ZeroSize   int64
+}
+
+func IsSignature(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(SIGNATURE_MAGIC))
+}
+
+func (s *TarSignature) WriteTo(out io.Writer) (int64, error) {
+	w := binfmt.NewWriter(out)
+	w.Magic(SIGNATURE_MAGIC)
+	w.Uint64(uint64(s.BaseSize))
+	w.Uint64(uint64(s.ZeroOffset))
+	w.Uint64(uint64(s.ZeroSize))
+	w.Uint32(uint32(len(s.Members)))
+
+	for _, m := range s.Members {
+		w.String(m.Name)
+		w.Uint64(uint64(m.HeaderOffset))
+		w.Uint64(uint64(m.DataOffset))
+		w.Uint64(uint64(m.Size))
+		w.Bytes(m.HeaderDigest)
+		w.Bytes(m.Signature)
+	}
+
+	return w.Flush()
+}
+
+func ReadSignature(in io.Reader) (*TarSignature, error) {
+	r := binfmt.NewReader(in)
+	r.Magic(SIGNATURE_MAGIC)
+
+	s := &TarSignature{
+		BaseSize:   int64(r.Uint64()),
+		ZeroOffset: int64(r.Uint64()),
+		ZeroSize:   int64(r.Uint64()),
+		Members:    make([]*Member, 0),
+	}
+
+	if r.Err == nil && (s.ZeroOffset < 0 || s.ZeroSize < 0 || s.ZeroOffset+s.ZeroSize > s.BaseSize) {
+		r.Err = fmt.Errorf("Zeros are out of the archive bounds")
+	}
+
+	count := r.Uint32()
+
+	for i := uint32(0); i < count && r.Err == nil; i++ {
+		m := &Member{
+			Name:         string(r.Bytes()),
+			HeaderOffset: int64(r.Uint64()),
+			DataOffset:   int64(r.Uint64()),
+			Size:         int64(r.Uint64()),
+			HeaderDigest: r.Bytes(),
+			Signature:    r.Bytes(),
+		}
+
+		valid := m.HeaderOffset >= 0 &&
+			m.HeaderOffset <= m.DataOffset &&
+			m.Size >= 0 &&
+			m.DataOffset+m.Size <= s.BaseSize
+
+		if r.Err == nil && !valid {
+			r.Err = fmt.Errorf("Member %s is out of the archive bounds", m.Name)
+		}
+
+		s.Members = append(s.Members, m)
+	}
+
+	if r.Err != nil {
+		return nil, fmt.Errorf("Error reading tar signature: %v", r.Err)
+	}
+
+	return s, nil
+}
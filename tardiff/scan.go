@@ -0,0 +1,163 @@
+package tardiff
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const blockSize = 512
+
+// region is where one member lies in an archive. Between the
+// end of the previous member's content and headerOffset
+// there's only padding.
+type region struct {
+	hdr          *tar.Header
+	headerOffset int64
+	dataOffset   int64
+	dataEnd      int64
+	diffable     bool
+}
+
+// layout is where every member lies in an archive, and
+// where the run of zeros at its end lies.
+type layout struct {
+	regions    []*region
+	size       int64
+	zeroOffset int64
+	zeroSize   int64
+}
+
+// tracker counts how many bytes went through it and, while
+// record is set, keeps a copy of them.
+type tracker struct {
+	r      io.Reader
+	offset int64
+	record *bytes.Buffer
+}
+
+func (t *tracker) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+
+	if n > 0 {
+		t.offset += int64(n)
+
+		if t.record != nil {
+			t.record.Write(p[:n])
+		}
+	}
+
+	return n, err
+}
+
+// scan walks the archive in r. For every member, fn is given
+// the member's region, its header bytes and a reader over its
+// content. The archive size in the layout includes whatever
+// follows the last member.
+func scan(r io.Reader, fn func(reg *region, header []byte, data io.Reader) error) (*layout, error) {
+	t := &tracker{
+		r: r,
+	}
+
+	tr := tar.NewReader(t)
+	l := &layout{
+		regions: make([]*region, 0),
+	}
+
+	prevEnd := int64(0)
+
+	for {
+		t.record = bytes.NewBuffer(nil)
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			// What was read to find out there are no more
+			// members is the last padding and the end of
+			// archive marker, normally all zeros.
+			if isZeros(t.record.Bytes()) {
+				l.zeroOffset = prevEnd
+				l.zeroSize = int64(t.record.Len())
+			}
+
+			t.record = nil
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		recorded := t.record.Bytes()
+		t.record = nil
+
+		reg := &region{
+			hdr:          hdr,
+			headerOffset: align(prevEnd),
+			dataOffset:   t.offset,
+			diffable:     isDiffable(hdr),
+		}
+
+		if reg.headerOffset > reg.dataOffset {
+			reg.headerOffset = prevEnd
+		}
+
+		header := recorded[reg.headerOffset-prevEnd:]
+
+		if err := fn(reg, header, tr); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return nil, err
+		}
+
+		reg.dataEnd = t.offset
+
+		if reg.dataEnd-reg.dataOffset != hdr.Size {
+			reg.diffable = false
+		}
+
+		l.regions = append(l.regions, reg)
+		prevEnd = reg.dataEnd
+	}
+
+	if _, err := io.Copy(ioutil.Discard, t); err != nil {
+		return nil, err
+	}
+
+	l.size = t.offset
+
+	return l, nil
+}
+
+// isDiffable tells if the member's content is stored as is,
+// so that offsets in it are offsets in the archive.
+func isDiffable(hdr *tar.Header) bool {
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != '\x00' {
+		return false
+	}
+
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isZeros(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func align(offset int64) int64 {
+	return (offset + blockSize - 1) / blockSize * blockSize
+}
@@ -0,0 +1,79 @@
+package tardiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+)
+
+// Signature reads the tar archive in base and writes a tar
+// signature, with the layout of every member and a regular
+// signature of the content of every regular file, built with
+// c. c.BaseSize is ignored in favour of the size of each
+// member.
+func Signature(base io.Reader, out io.Writer, c *deltadiff.SignatureConfig) error {
+	members := make([]*Member, 0)
+
+	l, err := scan(base, func(reg *region, header []byte, data io.Reader) error {
+		digest := sha256.Sum256(header)
+
+		m := &Member{
+			Name:         reg.hdr.Name,
+			HeaderOffset: reg.headerOffset,
+			DataOffset:   reg.dataOffset,
+			HeaderDigest: digest[:],
+		}
+
+		if reg.diffable {
+			signature := bytes.NewBuffer(nil)
+
+			mc := &deltadiff.SignatureConfig{
+				Hasher:       c.Hasher,
+				BlockSize:    c.BlockSize,
+				CDC:          c.CDC,
+				MinBlockSize: c.MinBlockSize,
+				MaxBlockSize: c.MaxBlockSize,
+				BaseSize:     int(reg.hdr.Size),
+				Progress:     c.Progress,
+			}
+
+			if err := deltadiff.Signature(data, signature, mc); err != nil {
+				return fmt.Errorf("Error calculating signature of %s: %w", reg.hdr.Name, err)
+			}
+
+			m.Signature = signature.Bytes()
+		}
+
+		members = append(members, m)
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("Error reading base archive: %v", err)
+	}
+
+	for i, reg := range l.regions {
+		members[i].Size = reg.dataEnd - reg.dataOffset
+
+		// The content turned out not to be stored as is.
+		if !reg.diffable {
+			members[i].Signature = nil
+		}
+	}
+
+	s := &TarSignature{
+		BaseSize:   l.size,
+		Members:    members,
+		ZeroOffset: l.zeroOffset,
+		ZeroSize:   l.zeroSize,
+	}
+
+	if _, err := s.WriteTo(out); err != nil {
+		return fmt.Errorf("Error writing tar signature: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package tardiff
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTarDiff(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("tar diff", func() {
+
+		makeTar := func(names []string, files map[string]string) []byte {
+			buffer := bytes.NewBuffer(nil)
+			tw := tar.NewWriter(buffer)
+
+			for _, name := range names {
+				hdr := &tar.Header{
+					Name:    name,
+					Mode:    0644,
+					Size:    int64(len(files[name])),
+					ModTime: time.Unix(1600000000, 0),
+				}
+
+				err := tw.WriteHeader(hdr)
+				g.Assert(err).Equal(nil)
+				_, err = tw.Write([]byte(files[name]))
+				g.Assert(err).Equal(nil)
+			}
+
+			err := tw.Close()
+			g.Assert(err).Equal(nil)
+
+			return buffer.Bytes()
+		}
+
+		lines := func(prefix string, n int) string {
+			b := strings.Builder{}
+			for i := 0; i < n; i++ {
+				fmt.Fprintf(&b, "%s line %d of the file\n", prefix, i)
+			}
+			return b.String()
+		}
+
+		diff := func(base, target []byte) ([]byte, *deltadiff.DeltaStats) {
+			signature := bytes.NewBuffer(nil)
+			sc := &deltadiff.SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 64,
+			}
+			err := Signature(bytes.NewReader(base), signature, sc)
+			g.Assert(err).Equal(nil)
+
+			dc := &deltadiff.DeltaConfig{
+				Stats: &deltadiff.DeltaStats{},
+			}
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, bytes.NewReader(target), delta, dc)
+			g.Assert(err).Equal(nil)
+
+			out := bytes.NewBuffer(nil)
+			err = deltadiff.Patch(bytes.NewReader(base), bytes.NewReader(delta.Bytes()), out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.Bytes()).Equal(target)
+
+			return delta.Bytes(), dc.Stats
+		}
+
+		files := map[string]string{
+			"a.txt":       lines("a", 200),
+			"b.txt":       lines("b", 300),
+			"c/d.txt":     lines("d", 100),
+			"removed.txt": lines("removed", 50),
+		}
+
+		g.It("should patch reordered and modified members byte for byte", func() {
+			base := makeTar([]string{"a.txt", "b.txt", "c/d.txt", "removed.txt"}, files)
+
+			modified := map[string]string{
+				"a.txt":   files["a.txt"],
+				"b.txt":   strings.Replace(files["b.txt"], "b line 150", "B LINE 150, CHANGED", 1),
+				"c/d.txt": files["c/d.txt"] + "appended\n",
+				"new.txt": "brand new",
+			}
+
+			target := makeTar([]string{"new.txt", "c/d.txt", "b.txt", "a.txt"}, modified)
+
+			delta, stats := diff(base, target)
+
+			g.Assert(len(delta) < len(target)/8).Equal(true)
+			g.Assert(stats.TargetSize).Equal(len(target))
+			g.Assert(stats.BaseBytes + stats.LiteralBytes).Equal(len(target))
+			g.Assert(stats.DeltaSize).Equal(int64(len(delta)))
+		})
+
+		g.It("should handle empty and identical archives", func() {
+			base := makeTar([]string{"a.txt"}, files)
+			empty := makeTar([]string{}, files)
+
+			diff(base, base)
+			diff(base, empty)
+			diff(empty, base)
+		})
+
+		g.It("should record the layout of the base archive", func() {
+			base := makeTar([]string{"a.txt", "b.txt"}, files)
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewReader(base), signature, &deltadiff.SignatureConfig{Hasher: "polyroll"})
+			g.Assert(err).Equal(nil)
+			g.Assert(IsSignature(signature.Bytes())).Equal(true)
+
+			s, err := ReadSignature(signature)
+			g.Assert(err).Equal(nil)
+			g.Assert(s.BaseSize).Equal(int64(len(base)))
+			g.Assert(len(s.Members)).Equal(2)
+
+			for _, m := range s.Members {
+				content := string(base[m.DataOffset : m.DataOffset+m.Size])
+				g.Assert(content).Equal(files[m.Name])
+				g.Assert(m.DataOffset - m.HeaderOffset).Equal(int64(512))
+			}
+		})
+
+		g.It("should refuse patching with a base that can't seek", func() {
+			base := makeTar([]string{"a.txt", "b.txt"}, files)
+			target := makeTar([]string{"b.txt", "a.txt"}, files)
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewReader(base), signature, &deltadiff.SignatureConfig{Hasher: "md5", BlockSize: 64})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, bytes.NewReader(target), delta, &deltadiff.DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			err = deltadiff.Patch(bytes.NewBuffer(base), delta, bytes.NewBuffer(nil))
+			g.Assert(err == nil).Equal(false)
+		})
+	})
+}
@@ -0,0 +1,307 @@
+package deltadiff
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The text form of a delta has one op per line, using the
+// same notation as the README, except that write data is
+// quoted so any byte survives the round trip:
+//
+//	read:0-12
+//	write:"ccdd"
+//	checksum:<hex SHA-256>
+//
+// Blank lines and lines starting with # are ignored when
+// assembling, which is handy for hand-written fixtures.
+
+type jsonDelta struct {
+	Ops []*jsonOp `json:"ops"`
+}
+
+type jsonOp struct {
+	Op     string `json:"op"`
+	From   *int   `json:"from,omitempty"`
+	To     *int   `json:"to,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+	Digest []byte `json:"digest,omitempty"`
+}
+
+// DumpDeltaText converts a binary delta into its text form.
+func DumpDeltaText(delta io.Reader, out io.Writer) error {
+	decoder := NewDeltaDecoder(delta)
+	w := bufio.NewWriter(out)
+
+	for {
+		op, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch op := op.(type) {
+		case *ReadOp:
+			fmt.Fprintf(w, "read:%d-%d\n", op.From, op.To)
+		case *WriteOp:
+			fmt.Fprintf(w, "write:%s\n", strconv.Quote(string(op.Data)))
+		case *ChecksumOp:
+			fmt.Fprintf(w, "checksum:%x\n", op.Digest)
+		}
+	}
+
+	return w.Flush()
+}
+
+// DumpDeltaJSON converts a binary delta into JSON, one op
+// per line. Write data and checksums are base64 encoded.
+func DumpDeltaJSON(delta io.Reader, out io.Writer) error {
+	decoder := NewDeltaDecoder(delta)
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, "{\"ops\":[")
+
+	for i := 0; ; i++ {
+		op, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		jop := &jsonOp{
+			Op: op.Kind(),
+		}
+
+		switch op := op.(type) {
+		case *ReadOp:
+			jop.From = &op.From
+			jop.To = &op.To
+		case *WriteOp:
+			jop.Data = op.Data
+		case *ChecksumOp:
+			jop.Digest = op.Digest
+		}
+
+		encoded, err := json.Marshal(jop)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			fmt.Fprintf(w, ",")
+		}
+
+		fmt.Fprintf(w, "\n  %s", encoded)
+	}
+
+	fmt.Fprintf(w, "\n]}\n")
+
+	return w.Flush()
+}
+
+// AssembleDelta turns the text or JSON form of a delta back
+// into a binary delta. The format is detected from the first
+// non-blank character.
+func AssembleDelta(in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+
+	for {
+		b, err := r.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !isSpace(b[0]) {
+			break
+		}
+
+		r.ReadByte()
+	}
+
+	b, _ := r.Peek(1)
+	if b[0] == '{' {
+		return assembleDeltaJSON(r, out)
+	}
+
+	return assembleDeltaText(r, out)
+}
+
+func assembleDeltaText(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<30)
+
+	ops := make([]Op, 0)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		op, err := parseTextOp(text)
+		if err != nil {
+			return fmt.Errorf("Line %d: %v", line, err)
+		}
+
+		ops = append(ops, op)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return EncodeDelta(ops, out)
+}
+
+func parseTextOp(text string) (Op, error) {
+	sep := strings.Index(text, ":")
+	if sep < 0 {
+		return nil, fmt.Errorf("Expected <op>:<args>, got %q", text)
+	}
+
+	kind := text[:sep]
+	args := text[sep+1:]
+
+	switch kind {
+	case "read":
+		return parseTextRead(args)
+	case "write":
+		data, err := strconv.Unquote(args)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid write data %s: %v", args, err)
+		}
+
+		return &WriteOp{
+			Data: []byte(data),
+		}, nil
+	case "checksum":
+		digest, err := hex.DecodeString(args)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("Invalid checksum %s, expected %d hex encoded bytes", args, sha256.Size)
+		}
+
+		return &ChecksumOp{
+			Digest: digest,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown op %q", kind)
+}
+
+func parseTextRead(args string) (Op, error) {
+	parts := strings.Split(args, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Expected read:<from>-<to>, got read:%s", args)
+	}
+
+	from, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid read start %q: %v", parts[0], err)
+	}
+
+	to, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid read end %q: %v", parts[1], err)
+	}
+
+	if to < from {
+		return nil, fmt.Errorf("Invalid read range %d-%d", from, to)
+	}
+
+	return &ReadOp{
+		From: int(from),
+		To:   int(to),
+	}, nil
+}
+
+func assembleDeltaJSON(in io.Reader, out io.Writer) error {
+	decoder := json.NewDecoder(in)
+	decoder.DisallowUnknownFields()
+
+	jdelta := &jsonDelta{}
+	if err := decoder.Decode(jdelta); err != nil {
+		return fmt.Errorf("Invalid JSON delta: %v", err)
+	}
+
+	ops := make([]Op, 0, len(jdelta.Ops))
+
+	for i, jop := range jdelta.Ops {
+		op, err := parseJSONOp(jop)
+		if err != nil {
+			return fmt.Errorf("Op %d: %v", i, err)
+		}
+
+		ops = append(ops, op)
+	}
+
+	return EncodeDelta(ops, out)
+}
+
+func parseJSONOp(jop *jsonOp) (Op, error) {
+	switch jop.Op {
+	case "read":
+		if jop.From == nil || jop.To == nil {
+			return nil, fmt.Errorf("Read op requires from and to")
+		}
+
+		if *jop.From < 0 || *jop.To < *jop.From || uint64(*jop.To) > 0xffffffff {
+			return nil, fmt.Errorf("Invalid read range %d-%d", *jop.From, *jop.To)
+		}
+
+		return &ReadOp{
+			From: *jop.From,
+			To:   *jop.To,
+		}, nil
+
+	case "write":
+		if jop.From != nil || jop.To != nil || jop.Digest != nil {
+			return nil, fmt.Errorf("Write op only takes data")
+		}
+
+		data := jop.Data
+		if data == nil {
+			data = []byte{}
+		}
+
+		return &WriteOp{
+			Data: data,
+		}, nil
+
+	case "checksum":
+		if jop.From != nil || jop.To != nil || jop.Data != nil {
+			return nil, fmt.Errorf("Checksum op only takes digest")
+		}
+
+		if len(jop.Digest) != sha256.Size {
+			return nil, fmt.Errorf("Invalid checksum of %d bytes, expected %d", len(jop.Digest), sha256.Size)
+		}
+
+		return &ChecksumOp{
+			Digest: jop.Digest,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown op %q", jop.Op)
+}
+
+func isSpace(b byte) bool {
+	return bytes.IndexByte([]byte(" \t\r\n"), b) >= 0
+}
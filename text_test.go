@@ -0,0 +1,106 @@
+package deltadiff
+
+import (
+	"bytes"
+	"github.com/franela/goblin"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("text and json deltas", func() {
+
+		makeDelta := func(base, target string) []byte {
+			sc := &SignatureConfig{
+				Hasher:    "polyroll",
+				BlockSize: 4,
+				BaseSize:  len(base),
+			}
+
+			signatureBuffer := bytes.NewBuffer(nil)
+			err := Signature(bytes.NewBufferString(base), signatureBuffer, sc)
+			g.Assert(err).Equal(nil)
+
+			deltaBuffer := bytes.NewBuffer(nil)
+			err = Delta(signatureBuffer, bytes.NewBufferString(target), deltaBuffer, &DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			return deltaBuffer.Bytes()
+		}
+
+		testcases := [][]string{
+			[]string{"aaaabbbbccccddeeeeee", "aaaabbbbccccddddeeee"},
+			[]string{"", "a\x00\xff\n\"quoted\":é"},
+			[]string{"aaaabbbb", ""},
+		}
+
+		g.It("should dump text in the README notation", func() {
+			delta := makeDelta("aaaabbbbccccddeeeeee", "aaaabbbbccccddddeeee")
+
+			out := bytes.NewBuffer(nil)
+			err := DumpDeltaText(bytes.NewBuffer(delta), out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.String()).Equal("read:0-12\nwrite:\"dd\"\nread:12-16\nwrite:\"ee\"\n")
+		})
+
+		g.It("should round trip through text and json", func() {
+			dumpers := []func(delta []byte) ([]byte, error){
+				func(delta []byte) ([]byte, error) {
+					out := bytes.NewBuffer(nil)
+					err := DumpDeltaText(bytes.NewBuffer(delta), out)
+					return out.Bytes(), err
+				},
+				func(delta []byte) ([]byte, error) {
+					out := bytes.NewBuffer(nil)
+					err := DumpDeltaJSON(bytes.NewBuffer(delta), out)
+					return out.Bytes(), err
+				},
+			}
+
+			for _, testcase := range testcases {
+				for _, dump := range dumpers {
+					delta := makeDelta(testcase[0], testcase[1])
+
+					dumped, err := dump(delta)
+					g.Assert(err).Equal(nil)
+
+					assembled := bytes.NewBuffer(nil)
+					err = AssembleDelta(bytes.NewBuffer(dumped), assembled)
+					g.Assert(err).Equal(nil)
+					g.Assert(assembled.Bytes()).Equal(delta)
+				}
+			}
+		})
+
+		g.It("should assemble hand written text", func() {
+			text := "# fixture\n\nread:0-4\nwrite:\"XY\\x00\"\n  read:4-8\n"
+
+			delta := bytes.NewBuffer(nil)
+			err := AssembleDelta(bytes.NewBufferString(text), delta)
+			g.Assert(err).Equal(nil)
+
+			out := bytes.NewBuffer(nil)
+			err = Patch(bytes.NewBufferString("aaaabbbb"), delta, out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.String()).Equal("aaaaXY\x00bbbb")
+		})
+
+		g.It("should reject malformed input", func() {
+			inputs := []string{
+				"read:4-0\n",
+				"read:1\n",
+				"write:unquoted\n",
+				"copy:1-2\n",
+				"{\"ops\":[{\"op\":\"read\",\"from\":1}]}",
+				"{\"ops\":[{\"op\":\"write\",\"from\":1,\"to\":2}]}",
+			}
+
+			for _, input := range inputs {
+				err := AssembleDelta(bytes.NewBufferString(input), bytes.NewBuffer(nil))
+				g.Assert(err == nil).Equal(false)
+			}
+		})
+	})
+}
@@ -0,0 +1,213 @@
+package treediff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Delta compares the tree signature of base with the target
+// directory dir and writes a tree delta. For each target file:
+//
+//   - if base has a file at the same path, it's either copied
+//     unchanged or patched with the single file Delta engine;
+//   - otherwise, if base has a file with the same content
+//     somewhere else, it's copied from there, which covers
+//     renames;
+//   - otherwise the file is new and is patched from an empty
+//     base, that is, sent as literal data.
+//
+// Base files whose path isn't in target get a remove entry.
+func Delta(signature io.Reader, dir string, out io.Writer, c *deltadiff.DeltaConfig) error {
+	start := time.Now()
+
+	s, err := ReadSignature(signature)
+	if err != nil {
+		return err
+	}
+
+	byPath := make(map[string]*SignatureEntry)
+	byDigest := make(map[string]*SignatureEntry)
+
+	for _, e := range s.Entries {
+		byPath[e.Path] = e
+
+		if e.Mode.IsRegular() {
+			if _, ok := byDigest[string(e.Digest)]; !ok {
+				byDigest[string(e.Digest)] = e
+			}
+		}
+	}
+
+	d := &TreeDelta{
+		Entries: make([]*DeltaEntry, 0),
+	}
+
+	seen := make(map[string]bool)
+
+	err = walk(dir, func(relpath string, info fs.FileInfo) error {
+		seen[relpath] = true
+
+		if info.IsDir() {
+			d.Entries = append(d.Entries, &DeltaEntry{
+				Kind: ENTRY_DIR,
+				Path: relpath,
+				Mode: info.Mode(),
+			})
+
+			return nil
+		}
+
+		e, err := deltaFile(filepath.Join(dir, relpath), relpath, info, byPath, byDigest, c)
+		if err != nil {
+			return err
+		}
+
+		d.Entries = append(d.Entries, e)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range s.Entries {
+		if !seen[e.Path] {
+			d.Entries = append(d.Entries, &DeltaEntry{
+				Kind: ENTRY_REMOVE,
+				Path: e.Path,
+				Mode: e.Mode,
+			})
+		}
+	}
+
+	written, err := d.WriteTo(out)
+	if err != nil {
+		return fmt.Errorf("Error writing tree delta: %v", err)
+	}
+
+	if c.Stats != nil {
+		c.Stats.Add(&deltadiff.DeltaStats{
+			DeltaSize: written,
+			Duration:  time.Since(start),
+		})
+	}
+
+	return nil
+}
+
+func deltaFile(
+	filename string,
+	relpath string,
+	info fs.FileInfo,
+	byPath map[string]*SignatureEntry,
+	byDigest map[string]*SignatureEntry,
+	c *deltadiff.DeltaConfig,
+) (*DeltaEntry, error) {
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	digest := sum[:]
+
+	e := &DeltaEntry{
+		Path:   relpath,
+		Mode:   info.Mode(),
+		Digest: digest,
+	}
+
+	base, ok := byPath[relpath]
+	if ok && base.Mode.IsRegular() && bytes.Equal(base.Digest, digest) {
+		e.Kind = ENTRY_COPY
+		e.From = relpath
+		addStats(c, len(content), 0, len(content))
+		return e, nil
+	}
+
+	if !ok || !base.Mode.IsRegular() {
+		if same, ok := byDigest[string(digest)]; ok {
+			e.Kind = ENTRY_COPY
+			e.From = same.Path
+			addStats(c, len(content), 0, len(content))
+			return e, nil
+		}
+	}
+
+	e.Kind = ENTRY_PATCH
+	delta := bytes.NewBuffer(nil)
+
+	if ok && base.Mode.IsRegular() {
+		e.From = relpath
+
+		fc := &deltadiff.DeltaConfig{
+			Debug:       c.Debug,
+			DebugWriter: c.DebugWriter,
+			Progress:    c.Progress,
+			MemoryLimit: c.MemoryLimit,
+			TempDir:     c.TempDir,
+		}
+
+		if c.Stats != nil {
+			fc.Stats = &deltadiff.DeltaStats{}
+		}
+
+		err := deltadiff.Delta(bytes.NewReader(base.Signature), bytes.NewReader(content), delta, fc)
+		if err != nil {
+			return nil, fmt.Errorf("Error calculating delta of %s: %w", filename, err)
+		}
+
+		// Size and time are accounted for the tree as a whole.
+		if c.Stats != nil {
+			fc.Stats.DeltaSize = 0
+			fc.Stats.Duration = 0
+			c.Stats.Add(fc.Stats)
+		}
+	} else {
+		ops := []deltadiff.Op{}
+		if len(content) > 0 {
+			ops = append(ops, &deltadiff.WriteOp{Data: content})
+		}
+
+		if err := deltadiff.EncodeDelta(ops, delta); err != nil {
+			return nil, err
+		}
+
+		addStats(c, len(content), len(content), 0)
+	}
+
+	e.Delta = delta.Bytes()
+
+	return e, nil
+}
+
+func addStats(c *deltadiff.DeltaConfig, size, literal, copied int) {
+	if c.Stats == nil {
+		return
+	}
+
+	s := &deltadiff.DeltaStats{
+		TargetSize:   size,
+		LiteralBytes: literal,
+		BaseBytes:    copied,
+	}
+
+	if literal > 0 {
+		s.WriteOps = 1
+	}
+
+	if copied > 0 {
+		s.ReadOps = 1
+	}
+
+	c.Stats.Add(s)
+}
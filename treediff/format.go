@@ -0,0 +1,167 @@
+package treediff
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xrash/deltadiff/internal/binfmt"
+	"io"
+	"os"
+)
+
+// Tree signatures and tree deltas begin with a magic string,
+// so they can't be mistaken for the single file formats,
+// which begin with a hasher code or an opcode.
+const (
+	SIGNATURE_MAGIC = "DDTSIG01"
+	DELTA_MAGIC     = "DDTDLT01"
+)
+
+const (
+	// The file at Path is a directory.
+	ENTRY_DIR uint8 = 0
+
+	// The file at Path is a copy of the base file at From.
+	// When From equals Path the file is unchanged, otherwise
+	// it was renamed or copied.
+	ENTRY_COPY uint8 = 1
+
+	// The file at Path is the result of applying Delta to the
+	// base file at From, or to an empty base when From is "".
+	ENTRY_PATCH uint8 = 2
+
+	// The base file at Path was removed. These entries are
+	// informational, Patch doesn't need them.
+	ENTRY_REMOVE uint8 = 3
+)
+
+// SignatureEntry describes one file or directory of the base
+// tree. Path is relative to the root of the tree and always
+// uses forward slashes.
+type SignatureEntry struct {
+	Path      string
+	Mode      os.FileMode
+	Size      int64
+	Digest    []byte
+	Signature []byte
+}
+
+type TreeSignature struct {
+	Entries []*SignatureEntry
+}
+
+// DeltaEntry describes how to produce one file or directory
+// of the target tree, see the ENTRY_* constants.
+type DeltaEntry struct {
+	Kind   uint8
+	Path   string
+	From   string
+	Mode   os.FileMode
+	Digest []byte
+	Delta  []byte
+}
+
+type TreeDelta struct {
+	Entries []*DeltaEntry
+}
+
+func IsSignature(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(SIGNATURE_MAGIC))
+}
+
+func IsDelta(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(DELTA_MAGIC))
+}
+
+func (s *TreeSignature) WriteTo(out io.Writer) (int64, error) {
+	w := binfmt.NewWriter(out)
+	w.Magic(SIGNATURE_MAGIC)
+	w.Uint32(uint32(len(s.Entries)))
+
+	for _, e := range s.Entries {
+		w.String(e.Path)
+		w.Uint32(uint32(e.Mode))
+		w.Uint64(uint64(e.Size))
+		w.Bytes(e.Digest)
+		w.Bytes(e.Signature)
+	}
+
+	return w.Flush()
+}
+
+func ReadSignature(in io.Reader) (*TreeSignature, error) {
+	r := binfmt.NewReader(in)
+	r.Magic(SIGNATURE_MAGIC)
+	count := r.Uint32()
+
+	s := &TreeSignature{
+		Entries: make([]*SignatureEntry, 0),
+	}
+
+	for i := uint32(0); i < count && r.Err == nil; i++ {
+		e := &SignatureEntry{
+			Path:      r.Path(),
+			Mode:      os.FileMode(r.Uint32()),
+			Size:      int64(r.Uint64()),
+			Digest:    r.Bytes(),
+			Signature: r.Bytes(),
+		}
+
+		s.Entries = append(s.Entries, e)
+	}
+
+	if r.Err != nil {
+		return nil, fmt.Errorf("Error reading tree signature: %v", r.Err)
+	}
+
+	return s, nil
+}
+
+func (d *TreeDelta) WriteTo(out io.Writer) (int64, error) {
+	w := binfmt.NewWriter(out)
+	w.Magic(DELTA_MAGIC)
+	w.Uint32(uint32(len(d.Entries)))
+
+	for _, e := range d.Entries {
+		w.Uint8(e.Kind)
+		w.String(e.Path)
+		w.String(e.From)
+		w.Uint32(uint32(e.Mode))
+		w.Bytes(e.Digest)
+		w.Bytes(e.Delta)
+	}
+
+	return w.Flush()
+}
+
+func ReadDelta(in io.Reader) (*TreeDelta, error) {
+	r := binfmt.NewReader(in)
+	r.Magic(DELTA_MAGIC)
+	count := r.Uint32()
+
+	d := &TreeDelta{
+		Entries: make([]*DeltaEntry, 0),
+	}
+
+	for i := uint32(0); i < count && r.Err == nil; i++ {
+		e := &DeltaEntry{
+			Kind:   r.Uint8(),
+			Path:   r.Path(),
+			From:   r.Path(),
+			Mode:   os.FileMode(r.Uint32()),
+			Digest: r.Bytes(),
+			Delta:  r.Bytes(),
+		}
+
+		if r.Err == nil && e.Kind > ENTRY_REMOVE {
+			r.Err = fmt.Errorf("Unknown entry kind %d for %s", e.Kind, e.Path)
+		}
+
+		d.Entries = append(d.Entries, e)
+	}
+
+	if r.Err != nil {
+		return nil, fmt.Errorf("Error reading tree delta: %v", r.Err)
+	}
+
+	return d, nil
+}
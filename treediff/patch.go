@@ -0,0 +1,182 @@
+package treediff
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Patch rebuilds the target tree described by delta into
+// outDir, reading unchanged and patched files from baseDir.
+// outDir must not be baseDir, and must not exist or be empty.
+//
+// The tree is built in a temporary directory next to outDir,
+// which only becomes outDir once every file checks out, so a
+// failed patch leaves nothing that looks like a complete tree.
+func Patch(baseDir string, delta io.Reader, outDir string) error {
+	return PatchContext(context.Background(), baseDir, delta, outDir)
+}
+
+// PatchContext is like Patch, but stops between files and ops
+// once ctx is done, and returns ctx.Err().
+func PatchContext(ctx context.Context, baseDir string, delta io.Reader, outDir string) error {
+	d, err := ReadDelta(delta)
+	if err != nil {
+		return err
+	}
+
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return err
+	}
+
+	if absBase == absOut {
+		return fmt.Errorf("Output directory must not be the base directory")
+	}
+
+	if _, err := os.Stat(outDir); err == nil {
+		entries, err := ioutil.ReadDir(outDir)
+		if err != nil || len(entries) > 0 {
+			return fmt.Errorf("Output directory %s must not exist or be empty", outDir)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absOut), 0755); err != nil {
+		return err
+	}
+
+	tempDir, err := ioutil.TempDir(filepath.Dir(absOut), ".deltadiff-tree-")
+	if err != nil {
+		return err
+	}
+
+	if err := patchTree(ctx, baseDir, d, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+
+	if err := os.Chmod(tempDir, 0755); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+
+	// An empty outDir is replaced, Rename can't do it.
+	os.Remove(outDir)
+
+	if err := os.Rename(tempDir, outDir); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+
+	return nil
+}
+
+// patchTree writes every entry of d into outDir.
+func patchTree(ctx context.Context, baseDir string, d *TreeDelta, outDir string) error {
+	// Directories are created writable and get their modes
+	// only at the end, children first, so a read-only
+	// directory doesn't prevent filling it.
+	dirs := make([]*DeltaEntry, 0)
+
+	for _, e := range d.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if e.Path == "" {
+			return fmt.Errorf("Entry without path in tree delta")
+		}
+
+		target := filepath.Join(outDir, filepath.FromSlash(e.Path))
+
+		switch e.Kind {
+		case ENTRY_DIR:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+
+			dirs = append(dirs, e)
+
+		case ENTRY_COPY:
+			if err := patchFile(ctx, baseDir, e, target, nil); err != nil {
+				return err
+			}
+
+		case ENTRY_PATCH:
+			if err := patchFile(ctx, baseDir, e, target, e.Delta); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target := filepath.Join(outDir, filepath.FromSlash(dirs[i].Path))
+		if err := os.Chmod(target, dirs[i].Mode.Perm()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// patchFile writes the file described by e to target. When
+// delta is nil, the base file is copied as is.
+func patchFile(ctx context.Context, baseDir string, e *DeltaEntry, target string, delta []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	var base io.Reader = bytes.NewReader(nil)
+
+	if e.From != "" {
+		file, err := os.Open(filepath.Join(baseDir, filepath.FromSlash(e.From)))
+		if err != nil {
+			return fmt.Errorf("Error opening base file for %s: %v", e.Path, err)
+		}
+		defer file.Close()
+
+		base = file
+	} else if delta == nil {
+		return fmt.Errorf("Copy entry %s without base file", e.Path)
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	digest := sha256.New()
+	w := io.MultiWriter(out, digest)
+
+	if delta == nil {
+		_, err = io.Copy(w, base)
+	} else {
+		err = deltadiff.PatchContext(ctx, base, bytes.NewReader(delta), w)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Error patching %s: %w", e.Path, err)
+	}
+
+	if !bytes.Equal(digest.Sum(nil), e.Digest) {
+		return fmt.Errorf("Checksum mismatch for %s, base tree differs from the one in the signature", e.Path)
+	}
+
+	if err := out.Chmod(e.Mode.Perm()); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,112 @@
+package treediff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Signature walks dir and writes a tree signature with one
+// entry per directory and regular file. Files get a block
+// signature built with c, where c.BaseSize is ignored in
+// favour of the size of each file.
+func Signature(dir string, out io.Writer, c *deltadiff.SignatureConfig) error {
+	s := &TreeSignature{
+		Entries: make([]*SignatureEntry, 0),
+	}
+
+	err := walk(dir, func(relpath string, info fs.FileInfo) error {
+		e := &SignatureEntry{
+			Path: relpath,
+			Mode: info.Mode(),
+		}
+
+		if info.Mode().IsRegular() {
+			digest, signature, err := signFile(filepath.Join(dir, relpath), info.Size(), c)
+			if err != nil {
+				return err
+			}
+
+			e.Size = info.Size()
+			e.Digest = digest
+			e.Signature = signature
+		}
+
+		s.Entries = append(s.Entries, e)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.WriteTo(out); err != nil {
+		return fmt.Errorf("Error writing tree signature: %v", err)
+	}
+
+	return nil
+}
+
+func signFile(filename string, size int64, c *deltadiff.SignatureConfig) ([]byte, []byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	signature := bytes.NewBuffer(nil)
+
+	fc := &deltadiff.SignatureConfig{
+		Hasher:       c.Hasher,
+		BlockSize:    c.BlockSize,
+		CDC:          c.CDC,
+		MinBlockSize: c.MinBlockSize,
+		MaxBlockSize: c.MaxBlockSize,
+		BaseSize:     int(size),
+		Progress:     c.Progress,
+	}
+
+	if err := deltadiff.Signature(io.TeeReader(file, digest), signature, fc); err != nil {
+		return nil, nil, fmt.Errorf("Error calculating signature of %s: %w", filename, err)
+	}
+
+	return digest.Sum(nil), signature.Bytes(), nil
+}
+
+// walk calls fn for everything under dir, in lexical order,
+// with paths relative to dir and using forward slashes. Only
+// directories and regular files are supported.
+func walk(dir string, fn func(relpath string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == dir {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return fmt.Errorf("Unsupported file type %s for %s", info.Mode().Type(), p)
+		}
+
+		relpath, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		return fn(filepath.ToSlash(relpath), info)
+	})
+}
@@ -0,0 +1,211 @@
+package treediff
+
+import (
+	"bytes"
+	"github.com/franela/goblin"
+	"github.com/xrash/deltadiff"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTreeDiff(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("tree diff", func() {
+
+		writeTree := func(dir string, files map[string]string) {
+			for name, content := range files {
+				p := filepath.Join(dir, filepath.FromSlash(name))
+
+				if strings.HasSuffix(name, "/") {
+					err := os.MkdirAll(p, 0755)
+					g.Assert(err).Equal(nil)
+					continue
+				}
+
+				err := os.MkdirAll(filepath.Dir(p), 0755)
+				g.Assert(err).Equal(nil)
+				err = os.WriteFile(p, []byte(content), 0644)
+				g.Assert(err).Equal(nil)
+			}
+		}
+
+		readTree := func(dir string) map[string]string {
+			files := make(map[string]string)
+
+			err := walk(dir, func(relpath string, info fs.FileInfo) error {
+				if info.IsDir() {
+					files[relpath+"/"] = info.Mode().String()
+					return nil
+				}
+
+				content, err := os.ReadFile(filepath.Join(dir, relpath))
+				files[relpath] = info.Mode().String() + ":" + string(content)
+				return err
+			})
+
+			g.Assert(err).Equal(nil)
+
+			return files
+		}
+
+		diff := func(baseDir, targetDir, outDir string) *TreeDelta {
+			signature := bytes.NewBuffer(nil)
+			sc := &deltadiff.SignatureConfig{
+				Hasher:    "polyroll",
+				BlockSize: 8,
+			}
+			err := Signature(baseDir, signature, sc)
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, targetDir, delta, &deltadiff.DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			d, err := ReadDelta(bytes.NewReader(delta.Bytes()))
+			g.Assert(err).Equal(nil)
+
+			err = Patch(baseDir, delta, outDir)
+			g.Assert(err).Equal(nil)
+
+			return d
+		}
+
+		long := strings.Repeat("0123456789abcdef", 20)
+
+		g.It("should rebuild the target tree", func() {
+			root := t.TempDir()
+			baseDir := filepath.Join(root, "base")
+			targetDir := filepath.Join(root, "target")
+			outDir := filepath.Join(root, "out")
+
+			writeTree(baseDir, map[string]string{
+				"same.txt":          "unchanged",
+				"modified.txt":      long,
+				"renamed.txt":       "renamed content",
+				"removed.txt":       "removed",
+				"sub/deep/file.txt": "deep",
+			})
+
+			writeTree(targetDir, map[string]string{
+				"same.txt":          "unchanged",
+				"modified.txt":      long[:100] + "CHANGED" + long[100:],
+				"sub/moved.txt":     "renamed content",
+				"sub/deep/file.txt": "deep",
+				"added.txt":         "added",
+				"empty/":            "",
+			})
+
+			err := os.Chmod(filepath.Join(targetDir, "added.txt"), 0755)
+			g.Assert(err).Equal(nil)
+
+			d := diff(baseDir, targetDir, outDir)
+
+			g.Assert(readTree(outDir)).Equal(readTree(targetDir))
+
+			kinds := make(map[string]string)
+			for _, e := range d.Entries {
+				kinds[e.Path] = []string{"dir", "copy", "patch", "remove"}[e.Kind] + ":" + e.From
+			}
+
+			g.Assert(kinds).Equal(map[string]string{
+				"added.txt":         "patch:",
+				"empty":             "dir:",
+				"modified.txt":      "patch:modified.txt",
+				"removed.txt":       "remove:",
+				"renamed.txt":       "remove:",
+				"same.txt":          "copy:same.txt",
+				"sub":               "dir:",
+				"sub/deep":          "dir:",
+				"sub/deep/file.txt": "copy:sub/deep/file.txt",
+				"sub/moved.txt":     "copy:renamed.txt",
+			})
+		})
+
+		g.It("should fail when base doesn't match the signature", func() {
+			root := t.TempDir()
+			baseDir := filepath.Join(root, "base")
+			targetDir := filepath.Join(root, "target")
+
+			writeTree(baseDir, map[string]string{"a.txt": long})
+			writeTree(targetDir, map[string]string{"a.txt": long + "!"})
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(baseDir, signature, &deltadiff.SignatureConfig{Hasher: "md5", BlockSize: 16})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, targetDir, delta, &deltadiff.DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			writeTree(baseDir, map[string]string{"a.txt": strings.ToUpper(long)})
+
+			err = Patch(baseDir, delta, filepath.Join(root, "out"))
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("should leave nothing behind when patching fails", func() {
+			root := t.TempDir()
+			baseDir := filepath.Join(root, "base")
+			targetDir := filepath.Join(root, "target")
+			outDir := filepath.Join(root, "out")
+
+			writeTree(baseDir, map[string]string{"a.txt": long, "b.txt": long})
+			writeTree(targetDir, map[string]string{"a.txt": long + "!", "b.txt": long + "?"})
+
+			signature := bytes.NewBuffer(nil)
+			err := Signature(baseDir, signature, &deltadiff.SignatureConfig{Hasher: "md5", BlockSize: 16})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, targetDir, delta, &deltadiff.DeltaConfig{})
+			g.Assert(err).Equal(nil)
+
+			// a.txt is rebuilt, b.txt fails.
+			writeTree(baseDir, map[string]string{"b.txt": strings.ToUpper(long)})
+
+			err = Patch(baseDir, bytes.NewReader(delta.Bytes()), outDir)
+			g.Assert(err == nil).Equal(false)
+
+			entries, err := os.ReadDir(root)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(entries)).Equal(2)
+
+			// Nor does it patch into a tree that's there already.
+			writeTree(outDir, map[string]string{"stale.txt": "stale"})
+
+			err = Patch(baseDir, bytes.NewReader(delta.Bytes()), outDir)
+			g.Assert(err == nil).Equal(false)
+			g.Assert(readTree(outDir)).Equal(map[string]string{"stale.txt": "-rw-r--r--:stale"})
+
+			err = os.WriteFile(filepath.Join(root, "file"), nil, 0644)
+			g.Assert(err).Equal(nil)
+
+			err = Patch(baseDir, bytes.NewReader(delta.Bytes()), filepath.Join(root, "file"))
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("should refuse paths escaping the tree", func() {
+			paths := []string{"../evil", "/etc/passwd", "a/../../b", "./a", "."}
+
+			for _, p := range paths {
+				d := &TreeDelta{
+					Entries: []*DeltaEntry{
+						&DeltaEntry{Kind: ENTRY_PATCH, Path: p},
+					},
+				}
+
+				encoded := bytes.NewBuffer(nil)
+				_, err := d.WriteTo(encoded)
+				g.Assert(err).Equal(nil)
+
+				_, err = ReadDelta(encoded)
+				g.Assert(err == nil).Equal(false)
+			}
+		})
+	})
+}
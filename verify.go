@@ -0,0 +1,106 @@
+package deltadiff
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/xrash/deltadiff/readseeker"
+	"io"
+)
+
+type VerifyConfig struct {
+	// BaseSize is the size of the base the delta is meant for,
+	// reads past it fail with ErrBaseTooShort. If it's negative
+	// the size isn't known and reads aren't checked against it.
+	BaseSize int64
+
+	// If Base is not nil, the delta is applied to it and the
+	// output thrown away, so checksum ops can be checked.
+	Base io.Reader
+}
+
+// VerifyResult describes a delta that passed Verify.
+type VerifyResult struct {
+	// Ops is how many ops the delta has, checksum ops
+	// included, counted as OpCounts.Total does.
+	Ops        int
+	OutputSize int64
+
+	// Checksums is how many checksum ops the delta has, and
+	// ChecksumsChecked tells whether they were checked, which
+	// takes VerifyConfig.Base.
+	Checksums        int
+	ChecksumsChecked bool
+}
+
+// Verify checks that delta is well formed and fits base
+// without writing any output. Every op is decoded, reads are
+// checked against c.BaseSize and, when c.Base is given, checksum
+// ops are checked against the output. Errors are the same
+// Patch would return, an *OpError telling which op failed.
+func Verify(delta io.Reader, c *VerifyConfig) (*VerifyResult, error) {
+	var basers io.ReadSeeker
+
+	if c.Base != nil {
+		ok := false
+		basers, ok = c.Base.(io.ReadSeeker)
+		if !ok {
+			basers = readseeker.NewBasicReadSeeker(c.Base)
+		}
+	}
+
+	decoder := NewDeltaDecoder(delta)
+	digest := sha256.New()
+	counts := &OpCounts{}
+	result := &VerifyResult{
+		ChecksumsChecked: c.Base != nil,
+	}
+
+	for {
+		index, offset := decoder.Index(), decoder.Offset()
+
+		op, err := decoder.nextHeader()
+		if err == io.EOF {
+			return result, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch op := op.(type) {
+		case *ReadOp:
+			err = verifyRead(basers, op, digest, c.BaseSize)
+		case *literal:
+			err = decoder.copyLiteral(op, digest)
+		case *ChecksumOp:
+			if basers != nil {
+				err = checkChecksum(op, digest.Sum(nil))
+			}
+		}
+
+		if err != nil {
+			return nil, &OpError{
+				Index:  index,
+				Offset: offset,
+				Err:    err,
+			}
+		}
+
+		counts.Add(op)
+		result.Ops = counts.Total()
+		result.Checksums = counts.Checksums
+		result.OutputSize += int64(op.Len())
+	}
+}
+
+func verifyRead(base io.ReadSeeker, op *ReadOp, out io.Writer, baseSize int64) error {
+	if baseSize >= 0 && int64(op.To) > baseSize {
+		return fmt.Errorf("%w: it has %d bytes, the op reads %d-%d", ErrBaseTooShort, baseSize, op.From, op.To)
+	}
+
+	if base == nil {
+		return nil
+	}
+
+	return doPatchRead(base, op, out)
+}
@@ -0,0 +1,128 @@
+package deltadiff
+
+import (
+	"bytes"
+	"errors"
+	"github.com/franela/goblin"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+
+	g := goblin.Goblin(t)
+
+	g.Describe("verify", func() {
+
+		base := strings.Repeat("0123456789abcdef", 64)
+		target := "head" + base[100:600] + "middle" + base[700:] + "tail"
+
+		delta := func(checksum bool) []byte {
+			signature := bytes.NewBuffer(nil)
+			err := Signature(strings.NewReader(base), signature, &SignatureConfig{
+				Hasher:    "md5",
+				BlockSize: 32,
+				BaseSize:  len(base),
+			})
+			g.Assert(err).Equal(nil)
+
+			delta := bytes.NewBuffer(nil)
+			err = Delta(signature, strings.NewReader(target), delta, &DeltaConfig{Checksum: checksum})
+			g.Assert(err).Equal(nil)
+
+			return delta.Bytes()
+		}
+
+		g.It("should end deltas with a checksum that patch checks", func() {
+			d := delta(true)
+
+			ops, err := DecodeDelta(bytes.NewReader(d))
+			g.Assert(err).Equal(nil)
+			g.Assert(ops[len(ops)-1].Kind()).Equal("checksum")
+
+			out := bytes.NewBuffer(nil)
+			err = Patch(strings.NewReader(base), bytes.NewReader(d), out)
+			g.Assert(err).Equal(nil)
+			g.Assert(out.String()).Equal(target)
+
+			other := strings.Replace(base, "0123", "3210", 1)
+			err = Patch(strings.NewReader(other), bytes.NewReader(d), bytes.NewBuffer(nil))
+			g.Assert(errors.Is(err, ErrChecksumMismatch)).Equal(true)
+
+			var opErr *OpError
+			g.Assert(errors.As(err, &opErr)).Equal(true)
+			g.Assert(opErr.Index).Equal(len(ops) - 1)
+		})
+
+		g.It("should survive dumping and assembling", func() {
+			d := delta(true)
+
+			for _, dump := range []func(*bytes.Reader, *bytes.Buffer) error{
+				func(in *bytes.Reader, out *bytes.Buffer) error { return DumpDeltaText(in, out) },
+				func(in *bytes.Reader, out *bytes.Buffer) error { return DumpDeltaJSON(in, out) },
+			} {
+				dumped := bytes.NewBuffer(nil)
+				g.Assert(dump(bytes.NewReader(d), dumped)).Equal(nil)
+
+				assembled := bytes.NewBuffer(nil)
+				g.Assert(AssembleDelta(dumped, assembled)).Equal(nil)
+				g.Assert(assembled.Bytes()).Equal(d)
+			}
+		})
+
+		g.It("should check a delta without a base", func() {
+			d := delta(true)
+
+			result, err := Verify(bytes.NewReader(d), &VerifyConfig{BaseSize: int64(len(base))})
+			g.Assert(err).Equal(nil)
+			g.Assert(result.OutputSize).Equal(int64(len(target)))
+			g.Assert(result.Checksums).Equal(1)
+			g.Assert(result.ChecksumsChecked).Equal(false)
+
+			_, err = Verify(bytes.NewReader(d), &VerifyConfig{BaseSize: 500})
+			g.Assert(errors.Is(err, ErrBaseTooShort)).Equal(true)
+
+			_, err = Verify(bytes.NewReader(d), &VerifyConfig{BaseSize: -1})
+			g.Assert(err).Equal(nil)
+
+			_, err = Verify(bytes.NewReader(d[:len(d)-1]), &VerifyConfig{BaseSize: -1})
+			g.Assert(errors.Is(err, ErrCorruptDelta)).Equal(true)
+		})
+
+		g.It("should count every op, checksum ops included", func() {
+			d := delta(true)
+
+			ops, err := DecodeDelta(bytes.NewReader(d))
+			g.Assert(err).Equal(nil)
+
+			counts := &OpCounts{}
+			for _, op := range ops {
+				counts.Add(op)
+			}
+
+			g.Assert(counts.Checksums).Equal(1)
+			g.Assert(counts.Total()).Equal(len(ops))
+
+			result, err := Verify(bytes.NewReader(d), &VerifyConfig{BaseSize: -1})
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Ops).Equal(counts.Total())
+			g.Assert(result.Checksums).Equal(counts.Checksums)
+		})
+
+		g.It("should check checksums with a base", func() {
+			d := delta(true)
+
+			result, err := Verify(bytes.NewReader(d), &VerifyConfig{BaseSize: -1, Base: strings.NewReader(base)})
+			g.Assert(err).Equal(nil)
+			g.Assert(result.ChecksumsChecked).Equal(true)
+
+			other := strings.Replace(base, "0123", "3210", 1)
+			_, err = Verify(bytes.NewReader(d), &VerifyConfig{BaseSize: -1, Base: strings.NewReader(other)})
+			g.Assert(errors.Is(err, ErrChecksumMismatch)).Equal(true)
+
+			result, err = Verify(bytes.NewReader(delta(false)), &VerifyConfig{BaseSize: -1, Base: strings.NewReader(other)})
+			g.Assert(err).Equal(nil)
+			g.Assert(result.Checksums).Equal(0)
+		})
+	})
+}